@@ -3,19 +3,34 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/pflag"
 	"go.uber.org/zap"
-	"k8s.io/client-go/informers"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 
+	"github.com/lqshow/access-kubernetes-cluster/pkg/alert"
+	"github.com/lqshow/access-kubernetes-cluster/pkg/history"
+	"github.com/lqshow/access-kubernetes-cluster/pkg/informer"
 	"github.com/lqshow/access-kubernetes-cluster/pkg/kubernetes/client"
+	"github.com/lqshow/access-kubernetes-cluster/pkg/leaderelection"
+	"github.com/lqshow/access-kubernetes-cluster/pkg/pipeline"
+	"github.com/lqshow/access-kubernetes-cluster/pkg/rules"
 	"github.com/lqshow/access-kubernetes-cluster/pkg/signals"
 	"github.com/lqshow/access-kubernetes-cluster/service"
 	"github.com/lqshow/access-kubernetes-cluster/version"
 
 	pkgcontroller "github.com/lqshow/access-kubernetes-cluster/pkg/controller"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
@@ -61,13 +76,694 @@ func main() {
 	if err != nil {
 		zap.S().Fatalf("Failed to get kube client: %v", err)
 	}
+	dynamicClient, err := client.NewDynamicClient("", config.KubeConfig, configModifier)
+	if err != nil {
+		zap.S().Fatalf("Failed to get dynamic client: %v", err)
+	}
 	zap.L().Info("Kubernetes connected")
 
-	// Create the shared informer factory and use the client to connect to Kubernetes
-	factory := informers.NewSharedInformerFactory(kubeClientSet, 0)
-	controller := pkgcontroller.NewController(factory)
+	// Record Kubernetes Events on behalf of the reconcilers
+	recorder, broadcaster := pkgcontroller.NewEventRecorder(kubeClientSet, pkgcontroller.EventOptions{
+		Component:            config.EventComponent,
+		BurstSize:            config.EventBurstSize,
+		QPS:                  config.EventQPS,
+		MaxEvents:            config.EventMaxEvents,
+		MaxIntervalInSeconds: config.EventMaxIntervalSeconds,
+	})
+	defer broadcaster.Shutdown()
+
+	// Create the shared informer factories and use the client to connect to Kubernetes
+	options := controllerOptions(config)
+	options.Recorder = recorder
+	options.DynamicClient = dynamicClient
+	controller, err := pkgcontroller.NewController(kubeClientSet, options)
+	if err != nil {
+		zap.S().Fatalf("Failed to create controller: %v", err)
+	}
+
+	var historyStore *history.Store
+	// historyDone is done once the queued events are written to the history
+	// at stop, the store is only closed after.
+	var historyDone sync.WaitGroup
+	if config.HistoryPath != "" {
+		historyStore, err = history.Open(history.Options{
+			Path:        config.HistoryPath,
+			MaxAge:      config.HistoryMaxAge,
+			MaxRecords:  config.HistoryMaxRecords,
+			MaxBytes:    config.HistoryMaxBytes,
+			PrunePeriod: config.HistoryPrunePeriod,
+			FlushPeriod: time.Second,
+		})
+		if err != nil {
+			zap.S().Fatalf("Failed to open history: %v", err)
+		}
+		defer func() {
+			historyDone.Wait()
+			historyStore.Close()
+		}()
+		controller.Dispatcher().AddHandler(historyStore.HandleEvent)
+	}
+
+	var fanOut *informer.FanOut
+	if config.EventSinksConfig != "" {
+		fanOut, err = informer.LoadFanOut(config.EventSinksConfig)
+		if err != nil {
+			zap.S().Fatalf("Failed to load event sinks: %v", err)
+		}
+		handler := fanOut.HandleEvent
+		if config.EventPipelineConfig != "" {
+			engine, err := pipeline.Load(config.EventPipelineConfig, fanOut)
+			if err != nil {
+				zap.S().Fatalf("Failed to load event pipeline: %v", err)
+			}
+			handler = engine.HandleEvent
+		}
+		controller.Dispatcher().AddHandler(handler)
+	} else if config.EventPipelineConfig != "" {
+		zap.S().Fatal("The event pipeline requires event sinks")
+	}
+
+	var rulesEngine *rules.Engine
+	if config.RulesConfig != "" {
+		rulesEngine, err = rules.Load(config.RulesConfig)
+		if err != nil {
+			zap.S().Fatalf("Failed to load rules: %v", err)
+		}
+		controller.Dispatcher().AddHandler(rulesEngine.HandleEvent)
+	}
+
+	var alertManager *alert.Manager
+	if config.AlertsConfig != "" {
+		alertManager, err = alert.Load(config.AlertsConfig)
+		if err != nil {
+			zap.S().Fatalf("Failed to load alerts config: %v", err)
+		}
+		if controller.PodHealth() != nil {
+			controller.PodHealth().AddHandler(alertManager.HandlePodAlert)
+		}
+		controller.Rollouts().AddHandler(alertManager.HandleRollout)
+		controller.NodeController().AddChangeHandler(alertManager.HandleNodeChange)
+	}
+
+	var clusterWatchController *pkgcontroller.ClusterWatchController
+	if config.ClusterWatchEnabled {
+		clusterWatchClient, err := client.NewClusterWatchClient("", config.KubeConfig, configModifier)
+		if err != nil {
+			zap.S().Fatalf("Failed to get ClusterWatch client: %v", err)
+		}
+		clusterWatchController, err = pkgcontroller.NewClusterWatchController(kubeClientSet, clusterWatchClient, dynamicClient,
+			pkgcontroller.ClusterWatchOptions{
+				StatusPeriod:    config.ClusterWatchStatusPeriod,
+				DiffIgnorePaths: config.DiffIgnorePaths,
+				Recorder:        recorder,
+			})
+		if err != nil {
+			zap.S().Fatalf("Failed to create ClusterWatch controller: %v", err)
+		}
+	}
+
+	var reloaderController *pkgcontroller.ReloaderController
+	if config.ReloaderEnabled {
+		reloaderController, err = pkgcontroller.NewReloaderController(kubeClientSet, pkgcontroller.ReloaderOptions{
+			Namespace: config.ReloaderNamespace,
+			Recorder:  recorder,
+		})
+		if err != nil {
+			zap.S().Fatalf("Failed to create reloader controller: %v", err)
+		}
+	}
+
+	var ttlController *pkgcontroller.TTLController
+	if config.TTLEnabled {
+		ttlController, err = pkgcontroller.NewTTLController(kubeClientSet, dynamicClient, pkgcontroller.TTLOptions{
+			Resources:         config.TTLResources,
+			Namespace:         config.TTLNamespace,
+			PropagationPolicy: metav1.DeletionPropagation(config.TTLPropagationPolicy),
+			DryRun:            config.TTLDryRun,
+			Recorder:          recorder,
+		})
+		if err != nil {
+			zap.S().Fatalf("Failed to create TTL controller: %v", err)
+		}
+	}
+
+	var downscalerController *pkgcontroller.DownscalerController
+	if config.DownscalerEnabled {
+		downscalerController, err = pkgcontroller.NewDownscalerController(kubeClientSet, pkgcontroller.DownscalerOptions{
+			Namespace: config.DownscalerNamespace,
+			Period:    config.DownscalerPeriod,
+			Recorder:  recorder,
+		})
+		if err != nil {
+			zap.S().Fatalf("Failed to create downscaler controller: %v", err)
+		}
+	}
+
+	var provisionerController *pkgcontroller.ProvisionerController
+	if config.NamespaceTemplatesConfig != "" {
+		templates, err := pkgcontroller.LoadNamespaceTemplates(config.NamespaceTemplatesConfig)
+		if err != nil {
+			zap.S().Fatalf("Failed to load namespace templates: %v", err)
+		}
+		provisionerController, err = pkgcontroller.NewProvisionerController(kubeClientSet, dynamicClient, pkgcontroller.ProvisionerOptions{
+			Config:       templates,
+			ResyncPeriod: config.NamespaceProvisionerResync,
+			Recorder:     recorder,
+		})
+		if err != nil {
+			zap.S().Fatalf("Failed to create provisioner controller: %v", err)
+		}
+	}
+
+	run := func(stopCh <-chan struct{}) {
+		if historyStore != nil {
+			historyDone.Add(1)
+			go func() {
+				defer historyDone.Done()
+				historyStore.Run(stopCh)
+			}()
+		}
+		if fanOut != nil {
+			go fanOut.Run(stopCh)
+		}
+		if alertManager != nil {
+			go alertManager.Run(stopCh)
+		}
+		if clusterWatchController != nil {
+			go func() {
+				if err := clusterWatchController.Run(config.WorkerThreadiness, stopCh); err != nil {
+					zap.S().Panicf("Failed to ClusterWatch controller run: %v", err)
+				}
+			}()
+		}
+		if reloaderController != nil {
+			go func() {
+				if err := reloaderController.Run(config.WorkerThreadiness, stopCh); err != nil {
+					zap.S().Panicf("Failed to reloader controller run: %v", err)
+				}
+			}()
+		}
+		if ttlController != nil {
+			go func() {
+				if err := ttlController.Run(config.WorkerThreadiness, stopCh); err != nil {
+					zap.S().Panicf("Failed to TTL controller run: %v", err)
+				}
+			}()
+		}
+		if downscalerController != nil {
+			go func() {
+				if err := downscalerController.Run(config.WorkerThreadiness, stopCh); err != nil {
+					zap.S().Panicf("Failed to downscaler controller run: %v", err)
+				}
+			}()
+		}
+		if provisionerController != nil {
+			go func() {
+				if err := provisionerController.Run(config.WorkerThreadiness, stopCh); err != nil {
+					zap.S().Panicf("Failed to provisioner controller run: %v", err)
+				}
+			}()
+		}
+		if err := controller.Run(config.WorkerThreadiness, stopCh); err != nil {
+			zap.S().Panicf("Failed to controller run: %v", err)
+		}
+	}
+
+	var elector *leaderelection.LeaderElector
+	if config.LeaderElect {
+		elector, err = leaderelection.NewLeaderElector(kubeClientSet, leaderelection.Config{
+			LeaseName:      config.LeaderElectionLeaseName,
+			LeaseNamespace: config.LeaderElectionNamespace,
+			LeaseDuration:  config.LeaderElectionLeaseDuration,
+			RenewDeadline:  config.LeaderElectionRenewDeadline,
+			RetryPeriod:    config.LeaderElectionRetryPeriod,
+		})
+		if err != nil {
+			zap.S().Fatalf("Failed to create leader elector: %v", err)
+		}
+	}
+
+	server := &http.Server{
+		Addr:    config.ListenAddress,
+		Handler: initRouter(controller, elector, historyStore, rulesEngine, alertManager, downscalerController),
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			zap.S().Fatalf("Failed to serve http: %v", err)
+		}
+	}()
+	defer server.Close()
+
+	if elector == nil {
+		run(stopCh)
+		return
+	}
+	if err := elector.Run(stopCh, run); err != nil {
+		zap.S().Fatalf("Failed to run leader election: %v", err)
+	}
+}
+
+// controllerOptions maps the environment config onto the controller options.
+func controllerOptions(config *service.Config) pkgcontroller.Options {
+	options := pkgcontroller.Options{
+		Namespaces:        config.WatchNamespaces,
+		NamespaceSelector: config.WatchNamespaceSelector,
+		Pods: pkgcontroller.ResourceOptions{
+			Selector: pkgcontroller.Selector{
+				LabelSelector: config.PodLabelSelector,
+				FieldSelector: config.PodFieldSelector,
+			},
+			ResyncPeriod:    config.PodResyncPeriod,
+			ReconcilePeriod: config.PodReconcilePeriod,
+		},
+		Deployments: pkgcontroller.ResourceOptions{
+			Selector: pkgcontroller.Selector{
+				LabelSelector: config.DeploymentLabelSelector,
+				FieldSelector: config.DeploymentFieldSelector,
+			},
+			ResyncPeriod:    config.DeploymentResyncPeriod,
+			ReconcilePeriod: config.DeploymentReconcilePeriod,
+		},
+		Nodes: pkgcontroller.ResourceOptions{
+			Selector: pkgcontroller.Selector{
+				LabelSelector: config.NodeLabelSelector,
+				FieldSelector: config.NodeFieldSelector,
+			},
+			ResyncPeriod: config.NodeResyncPeriod,
+		},
+		ReconcileJitter:       config.ReconcileJitter,
+		NodeTimelineSize:      config.NodeTimelineSize,
+		NodeTimelineRetention: config.NodeTimelineRetention,
+		RolloutHistorySize:    config.RolloutHistorySize,
+		DiffIgnorePaths:       config.DiffIgnorePaths,
+		OwnerGraph:            config.OwnerGraphEnabled,
+		SnapshotPath:          config.SnapshotPath,
+		SnapshotPeriod:        config.SnapshotPeriod,
+
+		Resources:            config.WatchResources,
+		CustomResourceGroups: config.WatchCustomResourceGroups,
+		Dynamic: pkgcontroller.ResourceOptions{
+			Selector: pkgcontroller.Selector{
+				LabelSelector: config.DynamicLabelSelector,
+				FieldSelector: config.DynamicFieldSelector,
+			},
+			ResyncPeriod: config.DynamicResyncPeriod,
+		},
+	}
+	if config.PodHealthEnabled {
+		options.PodHealth = &informer.PodHealthOptions{
+			RestartWindow:        config.PodRestartWindow,
+			RestartThreshold:     config.PodRestartThreshold,
+			InitContainerTimeout: config.PodInitContainerTimeout,
+		}
+	}
+	if config.PodGCEnabled {
+		options.PodGC = &informer.PodGCOptions{
+			MinAge:            config.PodGCMinAge,
+			KeepPerOwner:      config.PodGCKeepPerOwner,
+			Namespaces:        config.PodGCNamespaces,
+			ExcludeNamespaces: config.PodGCExcludeNamespaces,
+			DeleteRate:        config.PodGCDeleteRate,
+			DryRun:            config.PodGCDryRun,
+		}
+	}
+	if len(options.Namespaces) == 0 && options.NamespaceSelector == "" {
+		options.Namespaces = []string{config.KubeNamespace}
+	}
+
+	return options
+}
+
+func initRouter(controller *pkgcontroller.Controller, elector *leaderelection.LeaderElector, historyStore *history.Store, rulesEngine *rules.Engine, alertManager *alert.Manager, downscaler *pkgcontroller.DownscalerController) *gin.Engine {
+	r := gin.New()
+	r.Use(gin.Recovery())
+
+	r.GET("/healthz", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	r.GET("/readyz", func(c *gin.Context) {
+		if elector != nil && !elector.IsLeader() {
+			c.String(http.StatusServiceUnavailable, "leader not acquired")
+			return
+		}
+		if !controller.HasSynced() {
+			c.String(http.StatusServiceUnavailable, "informers not synced")
+			return
+		}
+
+		c.String(http.StatusOK, "ok")
+	})
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	r.GET("/nodes/timeline", func(c *gin.Context) {
+		since, err := parseSince(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, "invalid since: %v", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, controller.NodeController().Timeline().List(since))
+	})
+	r.GET("/nodes/timeline/:name", func(c *gin.Context) {
+		since, err := parseSince(c)
+		if err != nil {
+			c.String(http.StatusBadRequest, "invalid since: %v", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, controller.NodeController().Timeline().Get(c.Param("name"), since))
+	})
+
+	r.GET("/pods/health", func(c *gin.Context) {
+		if controller.PodHealth() == nil {
+			c.String(http.StatusNotFound, "pod health analysis disabled")
+			return
+		}
+
+		c.JSON(http.StatusOK, controller.PodHealth().Alerts(c.Query("namespace")))
+	})
+
+	r.GET("/rollouts", func(c *gin.Context) {
+		c.JSON(http.StatusOK, controller.Rollouts().Rollouts(c.Query("namespace")))
+	})
+	r.GET("/rollouts/:namespace/:name", func(c *gin.Context) {
+		current, history, ok := controller.Rollouts().Get(c.Param("namespace"), c.Param("name"))
+		if !ok {
+			c.String(http.StatusNotFound, "deployment %s/%s not found", c.Param("namespace"), c.Param("name"))
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"current": current, "history": history})
+	})
+
+	r.GET("/owners/ancestors", func(c *gin.Context) {
+		ownerQuery(c, controller.OwnerGraph(), (*informer.OwnerGraph).Ancestors)
+	})
+	r.GET("/owners/descendants", func(c *gin.Context) {
+		ownerQuery(c, controller.OwnerGraph(), (*informer.OwnerGraph).Descendants)
+	})
 
-	if err := controller.Run(config.WorkerThreadiness, stopCh); err != nil {
-		zap.S().Panicf("Failed to controller run: %v", err)
+	// queries are answered from the snapshot loaded at start until the
+	// informers have synchronized.
+	cacheGroup := r.Group("/cache", func(c *gin.Context) {
+		if controller.ServingSnapshot() {
+			c.Header("X-Cache-Source", "snapshot")
+		}
+	})
+	cacheGroup.GET("/pods", func(c *gin.Context) {
+		pods, err := controller.QueryPods(indexQuery(c, podQueryParams))
+		if err != nil {
+			c.String(http.StatusBadRequest, "%v", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, pods)
+	})
+	cacheGroup.GET("/deployments", func(c *gin.Context) {
+		deployments, err := controller.QueryDeployments(indexQuery(c, deploymentQueryParams))
+		if err != nil {
+			c.String(http.StatusBadRequest, "%v", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, deployments)
+	})
+
+	// the history routes are only registered when the history is enabled.
+	if historyStore != nil {
+		r.GET("/history/object", func(c *gin.Context) {
+			since, until, err := parseRange(c)
+			if err != nil {
+				c.String(http.StatusBadRequest, "%v", err)
+				return
+			}
+			records, err := historyStore.History(c.Query("kind"), c.Query("namespace"), c.Query("name"), since, until)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "failed to read history: %v", err)
+				return
+			}
+
+			c.JSON(http.StatusOK, records)
+		})
+		r.GET("/history/object/at", func(c *gin.Context) {
+			at, err := parseTime(c, "time")
+			if err != nil {
+				c.String(http.StatusBadRequest, "invalid time: %v", err)
+				return
+			}
+			if at.IsZero() {
+				at = time.Now()
+			}
+			record, ok, err := historyStore.At(c.Query("kind"), c.Query("namespace"), c.Query("name"), at)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "failed to read history: %v", err)
+				return
+			}
+			if !ok {
+				c.String(http.StatusNotFound, "object did not exist at %s", at.Format(time.RFC3339))
+				return
+			}
+
+			c.JSON(http.StatusOK, record)
+		})
+		r.GET("/history/changes", func(c *gin.Context) {
+			since, until, err := parseRange(c)
+			if err != nil {
+				c.String(http.StatusBadRequest, "%v", err)
+				return
+			}
+			limit, err := strconv.Atoi(c.DefaultQuery("limit", "1000"))
+			if err != nil {
+				c.String(http.StatusBadRequest, "invalid limit: %v", err)
+				return
+			}
+			records, err := historyStore.Changes(c.Query("namespace"), since, until, limit)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "failed to read history: %v", err)
+				return
+			}
+
+			c.JSON(http.StatusOK, records)
+		})
+	}
+
+	// the rules routes are only registered when rules are configured.
+	if rulesEngine != nil {
+		r.GET("/rules", func(c *gin.Context) {
+			c.JSON(http.StatusOK, rulesEngine.Rules())
+		})
+		r.GET("/rules/violations", func(c *gin.Context) {
+			c.JSON(http.StatusOK, rulesEngine.List(c.Query("kind"), c.Query("namespace"), c.Query("rule")))
+		})
+		r.GET("/rules/violations/object", func(c *gin.Context) {
+			violations, ok := rulesEngine.Violations(c.Query("kind"), c.Query("namespace"), c.Query("name"))
+			if !ok {
+				c.String(http.StatusNotFound, "no violations")
+				return
+			}
+
+			c.JSON(http.StatusOK, violations)
+		})
+	}
+
+	if alertManager != nil {
+		// every query parameter filters the alerts by the label of its name.
+		r.GET("/alerts", func(c *gin.Context) {
+			labels := make(map[string]string)
+			for name, values := range c.Request.URL.Query() {
+				labels[name] = values[0]
+			}
+
+			c.JSON(http.StatusOK, alertManager.Alerts(labels))
+		})
+		r.GET("/alerts/silences", func(c *gin.Context) {
+			c.JSON(http.StatusOK, alertManager.Silences())
+		})
+		r.POST("/alerts/silences", func(c *gin.Context) {
+			var request silenceRequest
+			if err := c.ShouldBindJSON(&request); err != nil {
+				c.String(http.StatusBadRequest, "invalid silence: %v", err)
+				return
+			}
+			if request.EndsAt.IsZero() && request.Duration != "" {
+				duration, err := time.ParseDuration(request.Duration)
+				if err != nil {
+					c.String(http.StatusBadRequest, "invalid duration: %v", err)
+					return
+				}
+				start := request.StartsAt
+				if start.IsZero() {
+					start = time.Now()
+				}
+				request.EndsAt = start.Add(duration)
+			}
+			silence, err := alertManager.AddSilence(request.Silence)
+			if err != nil {
+				c.String(http.StatusBadRequest, "%v", err)
+				return
+			}
+
+			c.JSON(http.StatusCreated, silence)
+		})
+		r.DELETE("/alerts/silences/:id", func(c *gin.Context) {
+			if !alertManager.DeleteSilence(c.Param("id")) {
+				c.String(http.StatusNotFound, "silence %s not found", c.Param("id"))
+				return
+			}
+
+			c.Status(http.StatusNoContent)
+		})
+	}
+
+	if downscaler != nil {
+		r.GET("/downscaler/overrides", func(c *gin.Context) {
+			c.JSON(http.StatusOK, downscaler.Overrides())
+		})
+		r.POST("/downscaler/overrides", func(c *gin.Context) {
+			var request overrideRequest
+			if err := c.ShouldBindJSON(&request); err != nil {
+				c.String(http.StatusBadRequest, "invalid override: %v", err)
+				return
+			}
+			if request.Until.IsZero() && request.Duration != "" {
+				duration, err := time.ParseDuration(request.Duration)
+				if err != nil {
+					c.String(http.StatusBadRequest, "invalid duration: %v", err)
+					return
+				}
+				request.Until = time.Now().Add(duration)
+			}
+			if err := downscaler.SetOverride(request.DownscalerOverride); err != nil {
+				switch _, apiErr := err.(errors.APIStatus); {
+				case errors.IsNotFound(err):
+					c.String(http.StatusNotFound, "%v", err)
+				case apiErr:
+					c.String(http.StatusInternalServerError, "%v", err)
+				default:
+					c.String(http.StatusBadRequest, "%v", err)
+				}
+				return
+			}
+
+			c.JSON(http.StatusCreated, request.DownscalerOverride)
+		})
+		// the kind and name query parameters select the override of a
+		// workload, the override of the namespace is deleted without them.
+		r.DELETE("/downscaler/overrides/:namespace", func(c *gin.Context) {
+			deleted, err := downscaler.DeleteOverride(c.Param("namespace"), c.Query("kind"), c.Query("name"))
+			if err != nil {
+				c.String(http.StatusInternalServerError, "%v", err)
+				return
+			}
+			if !deleted {
+				c.String(http.StatusNotFound, "override not found")
+				return
+			}
+
+			c.Status(http.StatusNoContent)
+		})
+	}
+
+	r.GET("/leader", func(c *gin.Context) {
+		if elector == nil {
+			c.JSON(http.StatusOK, gin.H{"leaderElection": false, "isLeader": true})
+			return
+		}
+
+		c.JSON(http.StatusOK, elector.Status())
+	})
+
+	return r
+}
+
+// silenceRequest is the body creating a silence, Duration sets EndsAt from
+// the start when EndsAt is unset, e.g. 2h.
+type silenceRequest struct {
+	alert.Silence
+	Duration string `json:"duration,omitempty"`
+}
+
+// overrideRequest is the body creating a downscaler override, Duration sets
+// Until from now when Until is unset, e.g. 3h.
+type overrideRequest struct {
+	pkgcontroller.DownscalerOverride
+	Duration string `json:"duration,omitempty"`
+}
+
+var (
+	// podQueryParams maps the query parameters of /cache/pods to indexes.
+	podQueryParams = map[string]string{
+		"namespace":        cache.NamespaceIndex,
+		"byNode":           informer.NodeNameIndex,
+		"byOwner":          informer.OwnerUIDIndex,
+		"byImage":          informer.ImageIndex,
+		"byLabel":          informer.LabelIndex,
+		"byServiceAccount": informer.ServiceAccountIndex,
+	}
+	// deploymentQueryParams maps the query parameters of /cache/deployments
+	// to indexes.
+	deploymentQueryParams = map[string]string{
+		"namespace": cache.NamespaceIndex,
+		"byImage":   informer.ImageIndex,
+		"byLabel":   informer.LabelIndex,
+	}
+)
+
+// indexQuery builds an index query from the query parameters that are set.
+func indexQuery(c *gin.Context, params map[string]string) informer.IndexQuery {
+	query := informer.IndexQuery{}
+	for param, index := range params {
+		if value, ok := c.GetQuery(param); ok {
+			query[index] = value
+		}
+	}
+
+	return query
+}
+
+// ownerQuery looks up the object given by the kind, namespace and name query
+// parameters and responds with the objects related to it by query.
+func ownerQuery(c *gin.Context, graph *informer.OwnerGraph, query func(*informer.OwnerGraph, types.UID) []informer.ObjectRef) {
+	if graph == nil {
+		c.String(http.StatusNotFound, "owner graph disabled")
+		return
+	}
+
+	object, ok := graph.Lookup(c.Query("kind"), c.Query("namespace"), c.Query("name"))
+	if !ok {
+		c.String(http.StatusNotFound, "object not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"object": object, "related": query(graph, object.UID)})
+}
+
+// parseSince parses the optional RFC3339 since query parameter.
+func parseSince(c *gin.Context) (time.Time, error) {
+	return parseTime(c, "since")
+}
+
+// parseRange parses the optional RFC3339 since and until query parameters.
+func parseRange(c *gin.Context) (time.Time, time.Time, error) {
+	since, err := parseTime(c, "since")
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid since: %v", err)
 	}
+	until, err := parseTime(c, "until")
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid until: %v", err)
+	}
+
+	return since, until, nil
+}
+
+// parseTime parses an optional RFC3339 query parameter, the zero time is
+// returned if it is not set.
+func parseTime(c *gin.Context, param string) (time.Time, error) {
+	value := c.Query(param)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
 }
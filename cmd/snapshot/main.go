@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/lqshow/access-kubernetes-cluster/pkg/informer"
+	"github.com/lqshow/access-kubernetes-cluster/pkg/snapshot"
+	"github.com/lqshow/access-kubernetes-cluster/version"
+)
+
+func main() {
+	showVersion := pflag.BoolP("version", "v", false, "Show version")
+	file := pflag.StringP("file", "f", "", "Snapshot file written by the informer")
+	kind := pflag.StringP("kind", "k", "", "Kind to query, e.g. Pod, Deployment or Node. The snapshot summary is printed when empty")
+	output := pflag.StringP("output", "o", "name", "Output format, name or json")
+	namespace := pflag.StringP("namespace", "n", "", "Only objects of the namespace")
+	byNode := pflag.String("by-node", "", "Only pods running on the node")
+	byOwner := pflag.String("by-owner", "", "Only objects owned by the UID")
+	byImage := pflag.String("by-image", "", "Only pods or deployments running the image")
+	byLabel := pflag.String("by-label", "", "Only objects with the label key or key=value")
+	byServiceAccount := pflag.String("by-service-account", "", "Only pods running as the service account")
+
+	pflag.Parse()
+	if *showVersion {
+		v, _ := json.MarshalIndent(version.Get(), "", "  ")
+		fmt.Println(string(v))
+		os.Exit(0)
+	}
+	if *file == "" {
+		fmt.Fprintln(os.Stderr, "--file is required")
+		pflag.Usage()
+		os.Exit(2)
+	}
+
+	s, err := snapshot.Read(*file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read snapshot: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *kind == "" {
+		printSummary(s)
+		return
+	}
+
+	query := informer.IndexQuery{}
+	for index, value := range map[string]string{
+		cache.NamespaceIndex:         *namespace,
+		informer.NodeNameIndex:       *byNode,
+		informer.OwnerUIDIndex:       *byOwner,
+		informer.ImageIndex:          *byImage,
+		informer.LabelIndex:          *byLabel,
+		informer.ServiceAccountIndex: *byServiceAccount,
+	} {
+		if value != "" {
+			query[index] = value
+		}
+	}
+
+	indexer, err := s.Indexer(*kind, indexers(*kind))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load %s: %v\n", *kind, err)
+		os.Exit(1)
+	}
+	keys, err := query.Query(indexer)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid query for %s: %v\n", *kind, err)
+		os.Exit(1)
+	}
+
+	var objects []interface{}
+	for _, key := range keys {
+		if obj, exists, _ := indexer.GetByKey(key); exists {
+			objects = append(objects, obj)
+		}
+	}
+
+	switch *output {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(objects); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to encode objects: %v\n", err)
+			os.Exit(1)
+		}
+	case "name":
+		for _, obj := range objects {
+			accessor, err := meta.Accessor(obj)
+			if err != nil {
+				continue
+			}
+			if accessor.GetNamespace() == "" {
+				fmt.Println(accessor.GetName())
+			} else {
+				fmt.Printf("%s/%s\n", accessor.GetNamespace(), accessor.GetName())
+			}
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown output format %q\n", *output)
+		os.Exit(2)
+	}
+}
+
+// indexers returns the indexers the informer adds to the caches of a kind.
+func indexers(kind string) cache.Indexers {
+	switch kind {
+	case "Pod":
+		return informer.PodIndexers()
+	case "Deployment":
+		return informer.DeploymentIndexers()
+	default:
+		return informer.ObjectIndexers()
+	}
+}
+
+func printSummary(s *snapshot.Snapshot) {
+	fmt.Printf("Version: %d\n", s.Version)
+	fmt.Printf("Time:    %s\n", s.Time)
+
+	kinds := make([]string, 0, len(s.Kinds))
+	for kind := range s.Kinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		k := s.Kinds[kind]
+		fmt.Printf("%s (%s): %d objects\n", kind, k.APIVersion, len(k.Objects))
+	}
+}
@@ -0,0 +1,175 @@
+package alert
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Statuses of an alert and of a notification.
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// Labels set on the alerts raised by the informer.
+const (
+	LabelAlertName = "alertname"
+	LabelNamespace = "namespace"
+	LabelWorkload  = "workload"
+	LabelSeverity  = "severity"
+)
+
+// Alert is a problem identified by its labels, alerts with the same labels
+// are the same alert.
+type Alert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	StartsAt    time.Time         `json:"startsAt"`
+	// EndsAt is set once the alert is resolved.
+	EndsAt *time.Time `json:"endsAt,omitempty"`
+	// Object is the object the alert was raised for, e.g. the Pod, it may be
+	// nil.
+	Object runtime.Object `json:"-"`
+}
+
+// Fingerprint identifies the alert by a hash of its labels.
+func (a *Alert) Fingerprint() string {
+	return fingerprint(a.Labels)
+}
+
+// Resolved returns whether the alert is resolved.
+func (a *Alert) Resolved() bool {
+	return a.EndsAt != nil
+}
+
+// Status returns firing or resolved.
+func (a *Alert) Status() string {
+	if a.Resolved() {
+		return StatusResolved
+	}
+
+	return StatusFiring
+}
+
+// Matcher matches the value of a label, a missing label has the empty value.
+type Matcher struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// Regex matches Value as a regular expression anchored at both ends.
+	Regex bool `json:"regex,omitempty"`
+
+	re *regexp.Regexp
+}
+
+func (m *Matcher) compile() error {
+	if m.Name == "" {
+		return fmt.Errorf("matcher label name is required")
+	}
+	if !m.Regex {
+		return nil
+	}
+
+	re, err := regexp.Compile("^(?:" + m.Value + ")$")
+	if err != nil {
+		return fmt.Errorf("invalid matcher regex %q: %v", m.Value, err)
+	}
+	m.re = re
+	return nil
+}
+
+// Matches returns whether the labels match.
+func (m *Matcher) Matches(labels map[string]string) bool {
+	if m.re != nil {
+		return m.re.MatchString(labels[m.Name])
+	}
+
+	return labels[m.Name] == m.Value
+}
+
+// matchAll returns whether the labels match every matcher.
+func matchAll(matchers []Matcher, labels map[string]string) bool {
+	for i := range matchers {
+		if !matchers[i].Matches(labels) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Silence mutes the alerts matching all its matchers from StartsAt until it
+// expires at EndsAt.
+type Silence struct {
+	ID        string    `json:"id"`
+	Matchers  []Matcher `json:"matchers"`
+	StartsAt  time.Time `json:"startsAt"`
+	EndsAt    time.Time `json:"endsAt"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+	Comment   string    `json:"comment,omitempty"`
+}
+
+// Active returns whether the silence mutes alerts at now.
+func (s *Silence) Active(now time.Time) bool {
+	return !now.Before(s.StartsAt) && now.Before(s.EndsAt)
+}
+
+// Notification is sent to the channels of a route for a group of alerts.
+type Notification struct {
+	Route string `json:"route"`
+	// GroupKey identifies the group the alerts belong to.
+	GroupKey    string            `json:"groupKey"`
+	GroupLabels map[string]string `json:"groupLabels"`
+	// Status is firing while any of the alerts is firing.
+	Status string  `json:"status"`
+	Alerts []Alert `json:"alerts"`
+}
+
+// Firing returns the firing alerts of the notification.
+func (n *Notification) Firing() []Alert {
+	return n.filter(false)
+}
+
+// Resolved returns the resolved alerts of the notification.
+func (n *Notification) Resolved() []Alert {
+	return n.filter(true)
+}
+
+func (n *Notification) filter(resolved bool) []Alert {
+	var alerts []Alert
+	for _, a := range n.Alerts {
+		if a.Resolved() == resolved {
+			alerts = append(alerts, a)
+		}
+	}
+
+	return alerts
+}
+
+// Notifier is a notification channel.
+type Notifier interface {
+	Name() string
+	Notify(notification *Notification) error
+}
+
+func fingerprint(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := fnv.New64a()
+	for _, name := range names {
+		h.Write([]byte(name))
+		h.Write([]byte{0xff})
+		h.Write([]byte(labels[name]))
+		h.Write([]byte{0xff})
+	}
+
+	return fmt.Sprintf("%016x", h.Sum64())
+}
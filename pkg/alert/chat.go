@@ -0,0 +1,166 @@
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Payload formats of the chat incoming webhooks.
+const (
+	ChatSlack      = "slack"
+	ChatMattermost = "mattermost"
+	ChatTeams      = "teams"
+)
+
+// Colors of the chat messages.
+const (
+	colorCritical = "#d63232"
+	colorWarning  = "#f2c744"
+	colorResolved = "#2eb886"
+)
+
+// ChatOptions configures a notifier posting messages to an incoming webhook
+// of Slack, Mattermost or Microsoft Teams.
+type ChatOptions struct {
+	URL string `json:"url"`
+	// Format is slack (default), mattermost or teams.
+	Format string `json:"format,omitempty"`
+	// Channel, Username and IconURL override the defaults of the webhook,
+	// Teams ignores them.
+	Channel  string `json:"channel,omitempty"`
+	Username string `json:"username,omitempty"`
+	IconURL  string `json:"iconURL,omitempty"`
+	// Title and Text are text/templates of the message executed with a
+	// TemplateData.
+	Title string `json:"title,omitempty"`
+	Text  string `json:"text,omitempty"`
+	// Timeout bounds a request.
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+}
+
+// ChatNotifier posts every notification as a chat message.
+type ChatNotifier struct {
+	name    string
+	options ChatOptions
+	title   *template.Template
+	text    *template.Template
+	client  *http.Client
+}
+
+// NewChatNotifier creates a chat notifier, unset options are defaulted.
+func NewChatNotifier(name string, options ChatOptions) (*ChatNotifier, error) {
+	if options.URL == "" {
+		return nil, fmt.Errorf("chat webhook url is required")
+	}
+	switch options.Format {
+	case "":
+		options.Format = ChatSlack
+	case ChatSlack, ChatMattermost, ChatTeams:
+	default:
+		return nil, fmt.Errorf("unknown chat format %q", options.Format)
+	}
+	if options.Timeout.Duration <= 0 {
+		options.Timeout.Duration = defaultWebhookTimeout
+	}
+
+	title, err := parseTemplate("title", options.Title, defaultTitleTemplate)
+	if err != nil {
+		return nil, err
+	}
+	text, err := parseTemplate("text", options.Text, defaultTextTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChatNotifier{
+		name:    name,
+		options: options,
+		title:   title,
+		text:    text,
+		client:  &http.Client{Timeout: options.Timeout.Duration},
+	}, nil
+}
+
+// Name implements Notifier.
+func (n *ChatNotifier) Name() string {
+	return n.name
+}
+
+// Notify implements Notifier.
+func (n *ChatNotifier) Notify(notification *Notification) error {
+	data := newTemplateData(notification)
+	title, err := render(n.title, data)
+	if err != nil {
+		return err
+	}
+	text, err := render(n.text, data)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(n.payload(notification, strings.TrimSpace(title), strings.TrimSpace(text)))
+	if err != nil {
+		return err
+	}
+
+	return post(n.client, n.options.URL, "application/json", nil, body)
+}
+
+// payload returns the message in the format of the webhook.
+func (n *ChatNotifier) payload(notification *Notification, title, text string) interface{} {
+	color := messageColor(notification)
+	if n.options.Format == ChatTeams {
+		// Teams renders the text as markdown, line breaks need a blank line.
+		return map[string]interface{}{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"themeColor": strings.TrimPrefix(color, "#"),
+			"summary":    title,
+			"title":      title,
+			"text":       strings.Replace(text, "\n", "\n\n", -1),
+		}
+	}
+
+	// Mattermost accepts the Slack payload.
+	payload := map[string]interface{}{
+		"text": title,
+		"attachments": []map[string]interface{}{{
+			"fallback": title,
+			"color":    color,
+			"text":     text,
+		}},
+	}
+	if n.options.Channel != "" {
+		payload["channel"] = n.options.Channel
+	}
+	if n.options.Username != "" {
+		payload["username"] = n.options.Username
+	}
+	if n.options.IconURL != "" {
+		payload["icon_url"] = n.options.IconURL
+	}
+
+	return payload
+}
+
+// messageColor is red while a critical alert fires, yellow while other
+// alerts fire and green once all are resolved.
+func messageColor(notification *Notification) string {
+	color := colorResolved
+	for _, a := range notification.Alerts {
+		if a.Resolved() {
+			continue
+		}
+		if a.Labels[LabelSeverity] == SeverityCritical {
+			return colorCritical
+		}
+		color = colorWarning
+	}
+
+	return color
+}
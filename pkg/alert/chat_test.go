@@ -0,0 +1,89 @@
+package alert
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// chatServer records the JSON payloads posted to it.
+func chatServer(t *testing.T) (*httptest.Server, <-chan map[string]interface{}) {
+	t.Helper()
+
+	payloads := make(chan map[string]interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("request = %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		var payload map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("decode payload: %v", err)
+		}
+		payloads <- payload
+	}))
+	t.Cleanup(server.Close)
+
+	return server, payloads
+}
+
+func TestChatNotifierSlackPayload(t *testing.T) {
+	server, payloads := chatServer(t)
+	n, err := NewChatNotifier("slack", ChatOptions{URL: server.URL, Channel: "#alerts", Username: "informer"})
+	if err != nil {
+		t.Fatalf("NewChatNotifier: %v", err)
+	}
+
+	if err := n.Notify(testNotification()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	payload := <-payloads
+
+	if payload["channel"] != "#alerts" || payload["username"] != "informer" {
+		t.Errorf("channel, username = %v, %v", payload["channel"], payload["username"])
+	}
+	if title, _ := payload["text"].(string); !strings.HasPrefix(title, "[FIRING:1]") {
+		t.Errorf("text = %q", title)
+	}
+	attachments, _ := payload["attachments"].([]interface{})
+	if len(attachments) != 1 {
+		t.Fatalf("attachments = %v", payload["attachments"])
+	}
+	attachment := attachments[0].(map[string]interface{})
+	if attachment["color"] != colorCritical {
+		t.Errorf("color = %v, want %s", attachment["color"], colorCritical)
+	}
+	if text, _ := attachment["text"].(string); !strings.Contains(text, "Rollout of revision 2 of deployment default/web stalled") {
+		t.Errorf("attachment text = %q", text)
+	}
+}
+
+func TestChatNotifierTeamsPayload(t *testing.T) {
+	server, payloads := chatServer(t)
+	n, err := NewChatNotifier("teams", ChatOptions{URL: server.URL, Format: ChatTeams, Channel: "#ignored"})
+	if err != nil {
+		t.Fatalf("NewChatNotifier: %v", err)
+	}
+
+	if err := n.Notify(testNotification()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	payload := <-payloads
+
+	if payload["@type"] != "MessageCard" || payload["@context"] != "https://schema.org/extensions" {
+		t.Errorf("card type = %v, %v", payload["@type"], payload["@context"])
+	}
+	if payload["themeColor"] != strings.TrimPrefix(colorCritical, "#") {
+		t.Errorf("themeColor = %v", payload["themeColor"])
+	}
+	if payload["title"] != payload["summary"] {
+		t.Errorf("title = %v, summary = %v", payload["title"], payload["summary"])
+	}
+	if _, ok := payload["channel"]; ok {
+		t.Error("channel sent to Teams")
+	}
+	if text, _ := payload["text"].(string); !strings.Contains(text, "stalled\n\nProgressDeadlineExceeded") {
+		t.Errorf("text = %q, want the line breaks doubled", text)
+	}
+}
@@ -0,0 +1,169 @@
+package alert
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"sigs.k8s.io/yaml"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// defaultRoute is the name of the route used when none is configured.
+const defaultRoute = "default"
+
+// Config is the file the alert manager is loaded from.
+type Config struct {
+	// GroupBy defaults to namespace and workload.
+	GroupBy        []string        `json:"groupBy,omitempty"`
+	GroupWait      metav1.Duration `json:"groupWait,omitempty"`
+	GroupInterval  metav1.Duration `json:"groupInterval,omitempty"`
+	RepeatInterval metav1.Duration `json:"repeatInterval,omitempty"`
+
+	Channels []ChannelConfig `json:"channels"`
+	// Routes are matched in order, an alert goes to the first route it
+	// matches and to the following ones while the matched routes continue.
+	// Every alert goes to every channel when no route is configured.
+	Routes []RouteConfig `json:"routes,omitempty"`
+}
+
+// ChannelConfig is a notification channel, exactly one of its types must be
+// set.
+type ChannelConfig struct {
+	Name string `json:"name"`
+	// Log logs the notifications.
+	Log     bool            `json:"log,omitempty"`
+	Webhook *WebhookOptions `json:"webhook,omitempty"`
+	Email   *EmailOptions   `json:"email,omitempty"`
+	// Chat posts to a Slack, Mattermost or Teams incoming webhook.
+	Chat *ChatOptions `json:"chat,omitempty"`
+}
+
+// RouteConfig sends the alerts matching all the matchers to channels, a
+// route without matchers matches every alert.
+type RouteConfig struct {
+	Name     string    `json:"name"`
+	Matchers []Matcher `json:"matchers,omitempty"`
+	Channels []string  `json:"channels"`
+	// Continue matches the alerts matching the route against the next
+	// routes as well.
+	Continue bool `json:"continue,omitempty"`
+}
+
+// Load creates a manager from a YAML or JSON Config file.
+func Load(path string) (*Manager, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alerts config %s: %v", path, err)
+	}
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse alerts config %s: %v", path, err)
+	}
+
+	return New(config)
+}
+
+// New creates a manager with the channels and routes of a config.
+func New(config Config) (*Manager, error) {
+	if len(config.Channels) == 0 {
+		return nil, fmt.Errorf("at least one channel is required")
+	}
+
+	notifiers := make(map[string]Notifier)
+	var all []Notifier
+	for _, c := range config.Channels {
+		if c.Name == "" {
+			return nil, fmt.Errorf("channel name is required")
+		}
+		if _, ok := notifiers[c.Name]; ok {
+			return nil, fmt.Errorf("duplicate channel %s", c.Name)
+		}
+		notifier, err := newNotifier(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid channel %s: %v", c.Name, err)
+		}
+		notifiers[c.Name] = notifier
+		all = append(all, notifier)
+	}
+
+	var routes []*route
+	names := make(map[string]bool)
+	for _, c := range config.Routes {
+		if c.Name == "" {
+			return nil, fmt.Errorf("route name is required")
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("duplicate route %s", c.Name)
+		}
+		names[c.Name] = true
+		if len(c.Channels) == 0 {
+			return nil, fmt.Errorf("route %s has no channels", c.Name)
+		}
+
+		r := &route{name: c.Name, cont: c.Continue}
+		r.matchers = make([]Matcher, len(c.Matchers))
+		copy(r.matchers, c.Matchers)
+		for i := range r.matchers {
+			if err := r.matchers[i].compile(); err != nil {
+				return nil, fmt.Errorf("invalid route %s: %v", c.Name, err)
+			}
+		}
+		for _, name := range c.Channels {
+			notifier, ok := notifiers[name]
+			if !ok {
+				return nil, fmt.Errorf("route %s references unknown channel %s", c.Name, name)
+			}
+			r.notifiers = append(r.notifiers, notifier)
+		}
+		routes = append(routes, r)
+	}
+	if len(routes) == 0 {
+		routes = append(routes, &route{name: defaultRoute, notifiers: all})
+	}
+
+	return newManager(Options{
+		GroupBy:        config.GroupBy,
+		GroupWait:      config.GroupWait.Duration,
+		GroupInterval:  config.GroupInterval.Duration,
+		RepeatInterval: config.RepeatInterval.Duration,
+	}, routes), nil
+}
+
+func newNotifier(c ChannelConfig) (Notifier, error) {
+	var notifier Notifier
+	set := 0
+	if c.Log {
+		notifier = NewLogNotifier(c.Name)
+		set++
+	}
+	if c.Webhook != nil {
+		n, err := NewWebhookNotifier(c.Name, *c.Webhook)
+		if err != nil {
+			return nil, err
+		}
+		notifier = n
+		set++
+	}
+	if c.Email != nil {
+		n, err := NewEmailNotifier(c.Name, *c.Email)
+		if err != nil {
+			return nil, err
+		}
+		notifier = n
+		set++
+	}
+	if c.Chat != nil {
+		n, err := NewChatNotifier(c.Name, *c.Chat)
+		if err != nil {
+			return nil, err
+		}
+		notifier = n
+		set++
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("exactly one channel type must be set")
+	}
+
+	return notifier, nil
+}
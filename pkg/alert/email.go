@@ -0,0 +1,276 @@
+package alert
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	texttemplate "text/template"
+)
+
+// TLS modes of the connection to the SMTP server.
+const (
+	// EmailSTARTTLS upgrades the connection with STARTTLS, the server must
+	// support it.
+	EmailSTARTTLS = "starttls"
+	// EmailTLS connects with TLS, usually to port 465.
+	EmailTLS = "tls"
+	// EmailNoTLS sends in clear text, e.g. to a local SMTP stand-in such as
+	// MailHog.
+	EmailNoTLS = "none"
+)
+
+// EmailOptions configures a notifier sending the notifications by email.
+type EmailOptions struct {
+	// Smarthost is the host:port of the SMTP server.
+	Smarthost string   `json:"smarthost"`
+	From      string   `json:"from"`
+	To        []string `json:"to"`
+	// Hello is the name sent with HELO, defaults to localhost.
+	Hello string `json:"hello,omitempty"`
+	// TLS is starttls (default), tls or none.
+	TLS                string `json:"tls,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+
+	// Username and Password authenticate with PLAIN auth, which net/smtp
+	// only allows over TLS or to localhost. PasswordFile reads the password
+	// from a file, e.g. a mounted Secret.
+	Username     string `json:"username,omitempty"`
+	Password     string `json:"password,omitempty"`
+	PasswordFile string `json:"passwordFile,omitempty"`
+
+	// Subject and Text are text/templates, HTML is an html/template, all
+	// executed with a TemplateData. The email has both a text and an HTML
+	// part.
+	Subject string            `json:"subject,omitempty"`
+	Text    string            `json:"text,omitempty"`
+	HTML    string            `json:"html,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Timeout bounds the delivery of an email.
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+}
+
+// EmailNotifier sends every notification as an email.
+type EmailNotifier struct {
+	name     string
+	options  EmailOptions
+	host     string
+	password string
+	subject  *texttemplate.Template
+	text     *texttemplate.Template
+	html     *template.Template
+}
+
+// NewEmailNotifier creates an email notifier, unset options are defaulted.
+func NewEmailNotifier(name string, options EmailOptions) (*EmailNotifier, error) {
+	host, _, err := net.SplitHostPort(options.Smarthost)
+	if err != nil {
+		return nil, fmt.Errorf("invalid smarthost %q: %v", options.Smarthost, err)
+	}
+	if options.From == "" || len(options.To) == 0 {
+		return nil, fmt.Errorf("email from and to are required")
+	}
+	if options.Hello == "" {
+		options.Hello = "localhost"
+	}
+	switch options.TLS {
+	case "":
+		options.TLS = EmailSTARTTLS
+	case EmailSTARTTLS, EmailTLS, EmailNoTLS:
+	default:
+		return nil, fmt.Errorf("unknown tls mode %q", options.TLS)
+	}
+	if options.Timeout.Duration <= 0 {
+		options.Timeout.Duration = defaultWebhookTimeout
+	}
+
+	n := &EmailNotifier{
+		name:     name,
+		options:  options,
+		host:     host,
+		password: options.Password,
+	}
+	if options.PasswordFile != "" {
+		password, err := ioutil.ReadFile(options.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read email password: %v", err)
+		}
+		n.password = strings.TrimSpace(string(password))
+	}
+	if n.subject, err = parseTemplate("subject", options.Subject, defaultTitleTemplate); err != nil {
+		return nil, err
+	}
+	if n.text, err = parseTemplate("text", options.Text, defaultTextTemplate); err != nil {
+		return nil, err
+	}
+	html := options.HTML
+	if html == "" {
+		html = defaultHTMLTemplate
+	}
+	if n.html, err = template.New("html").Funcs(templateFuncs).Parse(html); err != nil {
+		return nil, fmt.Errorf("invalid html template: %v", err)
+	}
+
+	return n, nil
+}
+
+// Name implements Notifier.
+func (n *EmailNotifier) Name() string {
+	return n.name
+}
+
+// Notify implements Notifier.
+func (n *EmailNotifier) Notify(notification *Notification) error {
+	data := newTemplateData(notification)
+	subject, err := render(n.subject, data)
+	if err != nil {
+		return err
+	}
+	text, err := render(n.text, data)
+	if err != nil {
+		return err
+	}
+	html, err := render(n.html, data)
+	if err != nil {
+		return err
+	}
+
+	message, err := n.message(strings.TrimSpace(subject), text, html)
+	if err != nil {
+		return err
+	}
+
+	return n.send(message)
+}
+
+// message builds a multipart/alternative email with a text and an HTML
+// part.
+func (n *EmailNotifier) message(subject, text, html string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	headers := map[string]string{
+		"From":         n.options.From,
+		"To":           strings.Join(n.options.To, ", "),
+		"Subject":      mime.QEncoding.Encode("utf-8", subject),
+		"Date":         time.Now().Format(time.RFC1123Z),
+		"MIME-Version": "1.0",
+		"Content-Type": "multipart/alternative; boundary=" + w.Boundary(),
+	}
+	for key, value := range n.options.Headers {
+		headers[key] = value
+	}
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, headers[key])
+	}
+	buf.WriteString("\r\n")
+
+	for _, part := range []struct {
+		contentType string
+		body        string
+	}{{"text/plain", text}, {"text/html", html}} {
+		pw, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType + "; charset=UTF-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(pw)
+		if _, err := qw.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// send delivers a message to the recipients through the smarthost.
+func (n *EmailNotifier) send(message []byte) error {
+	tlsConfig := &tls.Config{ServerName: n.host, InsecureSkipVerify: n.options.InsecureSkipVerify}
+	dialer := &net.Dialer{Timeout: n.options.Timeout.Duration}
+
+	var conn net.Conn
+	var err error
+	if n.options.TLS == EmailTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", n.options.Smarthost, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", n.options.Smarthost)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %v", n.options.Smarthost, err)
+	}
+	conn.SetDeadline(time.Now().Add(n.options.Timeout.Duration))
+
+	c, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to connect to %s: %v", n.options.Smarthost, err)
+	}
+	defer c.Close()
+
+	if err := c.Hello(n.options.Hello); err != nil {
+		return err
+	}
+	if n.options.TLS == EmailSTARTTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s doesn't support STARTTLS", n.options.Smarthost)
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("failed to start tls: %v", err)
+		}
+	}
+	if n.options.Username != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return fmt.Errorf("%s doesn't support AUTH", n.options.Smarthost)
+		}
+		if err := c.Auth(smtp.PlainAuth("", n.options.Username, n.password, n.host)); err != nil {
+			return fmt.Errorf("failed to authenticate: %v", err)
+		}
+	}
+
+	if err := c.Mail(n.options.From); err != nil {
+		return err
+	}
+	for _, to := range n.options.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
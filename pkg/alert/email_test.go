@@ -0,0 +1,159 @@
+package alert
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpSession is what a smtpServer received in a session.
+type smtpSession struct {
+	commands []string
+	data     []byte
+}
+
+// smtpServer is a minimal SMTP server accepting a single session, without
+// extensions, on a random port of 127.0.0.1.
+func smtpServer(t *testing.T) (string, <-chan smtpSession) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+		var session smtpSession
+		defer func() { sessions <- session }()
+		text := textproto.NewConn(conn)
+		text.PrintfLine("220 localhost ESMTP test")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			session.commands = append(session.commands, line)
+			switch verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); verb {
+			case "EHLO", "HELO", "MAIL", "RCPT":
+				text.PrintfLine("250 OK")
+			case "DATA":
+				text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+				if session.data, err = ioutil.ReadAll(text.DotReader()); err != nil {
+					return
+				}
+				text.PrintfLine("250 OK queued")
+			case "QUIT":
+				text.PrintfLine("221 Bye")
+				return
+			default:
+				text.PrintfLine("502 Command not implemented")
+			}
+		}
+	}()
+
+	return listener.Addr().String(), sessions
+}
+
+func testNotification() *Notification {
+	return &Notification{
+		Route:       "default",
+		GroupKey:    "alertname=RolloutStalled",
+		GroupLabels: map[string]string{LabelAlertName: "RolloutStalled"},
+		Status:      StatusFiring,
+		Alerts: []Alert{{
+			Labels: map[string]string{
+				LabelAlertName: "RolloutStalled",
+				LabelNamespace: "default",
+				LabelSeverity:  SeverityCritical,
+			},
+			Annotations: map[string]string{
+				"summary":     "Rollout of revision 2 of deployment default/web stalled",
+				"description": "ProgressDeadlineExceeded",
+			},
+			StartsAt: time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC),
+		}},
+	}
+}
+
+func TestEmailNotifierSendsMultipartMessage(t *testing.T) {
+	addr, sessions := smtpServer(t)
+	n, err := NewEmailNotifier("email", EmailOptions{
+		Smarthost: addr,
+		From:      "informer@example.com",
+		To:        []string{"oncall@example.com", "platform@example.com"},
+		TLS:       EmailNoTLS,
+	})
+	if err != nil {
+		t.Fatalf("NewEmailNotifier: %v", err)
+	}
+
+	if err := n.Notify(testNotification()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	session := <-sessions
+
+	var envelope []string
+	for _, command := range session.commands {
+		if verb := strings.ToUpper(strings.SplitN(command, ":", 2)[0]); verb == "MAIL FROM" || verb == "RCPT TO" {
+			envelope = append(envelope, command)
+		}
+	}
+	want := []string{"MAIL FROM:<informer@example.com>", "RCPT TO:<oncall@example.com>", "RCPT TO:<platform@example.com>"}
+	if strings.Join(envelope, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("envelope = %q, want %q", envelope, want)
+	}
+
+	message, err := mail.ReadMessage(bytes.NewReader(session.data))
+	if err != nil {
+		t.Fatalf("read message: %v", err)
+	}
+	if from := message.Header.Get("From"); from != "informer@example.com" {
+		t.Errorf("From = %q", from)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	if err != nil || !strings.Contains(subject, "FIRING") {
+		t.Errorf("Subject = %q (%v)", subject, err)
+	}
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q (%v)", message.Header.Get("Content-Type"), err)
+	}
+
+	parts := make(map[string]string)
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		// the quoted-printable encoding is decoded by the reader.
+		body, err := ioutil.ReadAll(part)
+		if err != nil {
+			t.Fatalf("read part: %v", err)
+		}
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		parts[contentType] = string(body)
+	}
+	if text := parts["text/plain"]; !strings.Contains(text, "[firing] Rollout of revision 2 of deployment default/web stalled") {
+		t.Errorf("text part = %q", text)
+	}
+	if html := parts["text/html"]; !strings.Contains(html, "<h3>FIRING") || !strings.Contains(html, "<td>ProgressDeadlineExceeded</td>") {
+		t.Errorf("html part = %q", html)
+	}
+}
@@ -0,0 +1,502 @@
+package alert
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/klog/v2"
+
+	"github.com/lqshow/access-kubernetes-cluster/pkg/metrics"
+)
+
+const (
+	defaultGroupWait      = 30 * time.Second
+	defaultGroupInterval  = 5 * time.Minute
+	defaultRepeatInterval = 4 * time.Hour
+	// flushPeriod is the period the groups are checked for due notifications.
+	flushPeriod = time.Second
+)
+
+// DefaultGroupBy are the labels alerts are grouped by by default.
+var DefaultGroupBy = []string{LabelNamespace, LabelWorkload}
+
+// Options configures the grouping and the notification intervals of a
+// Manager.
+type Options struct {
+	// GroupBy are the labels whose values group alerts into one
+	// notification.
+	GroupBy []string
+	// GroupWait is the time a new group waits for more alerts before its
+	// first notification.
+	GroupWait time.Duration
+	// GroupInterval is the minimum time between notifications of a group
+	// whose alerts changed.
+	GroupInterval time.Duration
+	// RepeatInterval is the time after which an unchanged group with firing
+	// alerts is notified again.
+	RepeatInterval time.Duration
+}
+
+// route sends the alerts matching its matchers to its notifiers.
+type route struct {
+	name      string
+	matchers  []Matcher
+	notifiers []Notifier
+	// cont lets the alerts matching the route be matched by the next routes.
+	cont bool
+}
+
+// group are the alerts of a route with the same values of the GroupBy
+// labels.
+type group struct {
+	key    string
+	route  *route
+	labels map[string]string
+	// alerts holds the alerts by fingerprint.
+	alerts    map[string]*Alert
+	createdAt time.Time
+	lastFlush time.Time
+	// notified holds whether each alert was resolved when the group was last
+	// notified successfully, by fingerprint.
+	notified map[string]bool
+}
+
+// Manager deduplicates alerts by fingerprint, groups them per route and
+// notifies the channels of the route once per group: after GroupWait, then
+// at most every GroupInterval when the alerts changed and every
+// RepeatInterval while alerts are firing. Resolved alerts are notified once.
+// Silenced alerts are left out of the notifications.
+type Manager struct {
+	options Options
+	routes  []*route
+
+	mu       sync.Mutex
+	groups   map[string]*group
+	silences map[string]*Silence
+}
+
+func newManager(options Options, routes []*route) *Manager {
+	if len(options.GroupBy) == 0 {
+		options.GroupBy = DefaultGroupBy
+	}
+	if options.GroupWait <= 0 {
+		options.GroupWait = defaultGroupWait
+	}
+	if options.GroupInterval <= 0 {
+		options.GroupInterval = defaultGroupInterval
+	}
+	if options.RepeatInterval <= 0 {
+		options.RepeatInterval = defaultRepeatInterval
+	}
+
+	return &Manager{
+		options:  options,
+		routes:   routes,
+		groups:   make(map[string]*group),
+		silences: make(map[string]*Silence),
+	}
+}
+
+// Fire raises an alert, an alert already firing with the same labels gets
+// the annotations and object of the new one. StartsAt defaults to now.
+func (m *Manager) Fire(alert Alert) {
+	now := time.Now()
+	if alert.StartsAt.IsZero() {
+		alert.StartsAt = now
+	}
+	alert.EndsAt = nil
+	fp := alert.Fingerprint()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	routes := m.match(alert.Labels)
+	if len(routes) == 0 {
+		klog.V(2).Infof("Alert %s %v matches no route", fp, alert.Labels)
+		return
+	}
+	for _, r := range routes {
+		g := m.group(r, alert.Labels, now)
+		if existing, ok := g.alerts[fp]; ok && !existing.Resolved() {
+			existing.Annotations = alert.Annotations
+			existing.Object = alert.Object
+			continue
+		}
+
+		a := alert
+		g.alerts[fp] = &a
+	}
+}
+
+// Resolve resolves the alert with the labels, if it is firing.
+func (m *Manager) Resolve(labels map[string]string) {
+	now := time.Now()
+	fp := fingerprint(labels)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, g := range m.groups {
+		if a, ok := g.alerts[fp]; ok && !a.Resolved() {
+			a.EndsAt = &now
+		}
+	}
+}
+
+// Run flushes the due notifications until stopCh is closed.
+func (m *Manager) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(flushPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case now := <-ticker.C:
+			m.Flush(now)
+		}
+	}
+}
+
+// pending is a notification of a group being sent.
+type pending struct {
+	group        *group
+	notification *Notification
+	// sent holds whether each notified alert is resolved, by fingerprint.
+	sent map[string]bool
+}
+
+// Flush sends the notifications of the groups due at now. A notification
+// failing on any channel is sent again to every channel of the route after
+// GroupInterval.
+func (m *Manager) Flush(now time.Time) {
+	m.mu.Lock()
+	for id, s := range m.silences {
+		if !now.Before(s.EndsAt) {
+			klog.Infof("Silence %s expired", id)
+			delete(m.silences, id)
+		}
+	}
+
+	var due []pending
+	firing := make(map[string]bool)
+	silenced := make(map[string]bool)
+	for key, g := range m.groups {
+		p := pending{
+			group: g,
+			notification: &Notification{
+				Route:       g.route.name,
+				GroupKey:    g.key,
+				GroupLabels: g.labels,
+				Status:      StatusResolved,
+			},
+			sent: make(map[string]bool),
+		}
+		changed := false
+		for fp, a := range g.alerts {
+			_, notified := g.notified[fp]
+			if m.silenced(a.Labels, now) {
+				if a.Resolved() {
+					delete(g.alerts, fp)
+					delete(g.notified, fp)
+				} else {
+					silenced[fp] = true
+				}
+				continue
+			}
+			if a.Resolved() && !notified {
+				// the alert came and went between two notifications.
+				delete(g.alerts, fp)
+				continue
+			}
+
+			if !a.Resolved() {
+				firing[fp] = true
+				p.notification.Status = StatusFiring
+			}
+			if resolved, ok := g.notified[fp]; !ok || resolved != a.Resolved() {
+				changed = true
+			}
+			p.sent[fp] = a.Resolved()
+			p.notification.Alerts = append(p.notification.Alerts, *a)
+		}
+		if len(g.alerts) == 0 {
+			delete(m.groups, key)
+			continue
+		}
+		if len(p.notification.Alerts) == 0 {
+			continue
+		}
+
+		switch {
+		case g.lastFlush.IsZero():
+			if !changed || now.Sub(g.createdAt) < m.options.GroupWait {
+				continue
+			}
+		case changed:
+			if now.Sub(g.lastFlush) < m.options.GroupInterval {
+				continue
+			}
+		default:
+			if p.notification.Status != StatusFiring || now.Sub(g.lastFlush) < m.options.RepeatInterval {
+				continue
+			}
+		}
+		sortAlerts(p.notification.Alerts)
+		due = append(due, p)
+	}
+	for fp := range firing {
+		delete(silenced, fp)
+	}
+	metrics.SetAlertsActive(metrics.AlertFiring, len(firing))
+	metrics.SetAlertsActive(metrics.AlertSilenced, len(silenced))
+	m.mu.Unlock()
+
+	// the channels are notified without holding the lock, alerts keep being
+	// fired and resolved meanwhile.
+	for _, p := range due {
+		err := m.notify(p.group.route, p.notification)
+
+		m.mu.Lock()
+		g := p.group
+		g.lastFlush = now
+		if err == nil {
+			g.notified = p.sent
+			for fp, resolved := range p.sent {
+				if a, ok := g.alerts[fp]; ok && resolved && a.Resolved() {
+					delete(g.alerts, fp)
+					delete(g.notified, fp)
+				}
+			}
+			if len(g.alerts) == 0 && m.groups[g.key] == g {
+				delete(m.groups, g.key)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+// notify sends a notification to the notifiers of a route.
+func (m *Manager) notify(r *route, notification *Notification) error {
+	var failed []string
+	for _, notifier := range r.notifiers {
+		if err := notifier.Notify(notification); err != nil {
+			klog.Errorf("Failed to notify %s of alert group %s: %v", notifier.Name(), notification.GroupKey, err)
+			metrics.ObserveAlertNotification(notifier.Name(), metrics.AlertNotificationFailed)
+			failed = append(failed, notifier.Name())
+			continue
+		}
+		metrics.ObserveAlertNotification(notifier.Name(), metrics.AlertNotificationSent)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to notify %s", strings.Join(failed, ", "))
+	}
+
+	klog.Infof("Notified alert group %s: %d alerts %s", notification.GroupKey, len(notification.Alerts), notification.Status)
+	return nil
+}
+
+// AlertStatus is an alert with the silences muting it.
+type AlertStatus struct {
+	Alert
+	Fingerprint string   `json:"fingerprint"`
+	Status      string   `json:"status"`
+	SilencedBy  []string `json:"silencedBy,omitempty"`
+}
+
+// Alerts returns the firing alerts and the resolved alerts not notified yet,
+// sorted by labels. Labels filters the alerts with the given label values.
+func (m *Manager) Alerts(labels map[string]string) []AlertStatus {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var alerts []AlertStatus
+	for _, g := range m.groups {
+		for fp, a := range g.alerts {
+			if seen[fp] || !matchLabels(labels, a.Labels) {
+				continue
+			}
+			seen[fp] = true
+
+			status := AlertStatus{Alert: *a, Fingerprint: fp, Status: a.Status()}
+			for id, s := range m.silences {
+				if s.Active(now) && matchAll(s.Matchers, a.Labels) {
+					status.SilencedBy = append(status.SilencedBy, id)
+				}
+			}
+			sort.Strings(status.SilencedBy)
+			alerts = append(alerts, status)
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return labelsString(alerts[i].Labels) < labelsString(alerts[j].Labels)
+	})
+
+	return alerts
+}
+
+// AddSilence validates and adds a silence, StartsAt defaults to now and the
+// ID is generated.
+func (m *Manager) AddSilence(s Silence) (Silence, error) {
+	now := time.Now()
+	if len(s.Matchers) == 0 {
+		return Silence{}, fmt.Errorf("silence requires at least one matcher")
+	}
+	matchers := make([]Matcher, len(s.Matchers))
+	copy(matchers, s.Matchers)
+	for i := range matchers {
+		if err := matchers[i].compile(); err != nil {
+			return Silence{}, err
+		}
+	}
+	s.Matchers = matchers
+	if s.StartsAt.IsZero() {
+		s.StartsAt = now
+	}
+	if !s.EndsAt.After(s.StartsAt) || !s.EndsAt.After(now) {
+		return Silence{}, fmt.Errorf("silence must end after it starts and in the future")
+	}
+	s.ID = string(uuid.NewUUID())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.silences[s.ID] = &s
+	klog.Infof("Silence %s added by %q until %s: %s", s.ID, s.CreatedBy, s.EndsAt.Format(time.RFC3339), s.Comment)
+	return s, nil
+}
+
+// DeleteSilence expires a silence, it returns false if there is no such
+// silence.
+func (m *Manager) DeleteSilence(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.silences[id]; !ok {
+		return false
+	}
+	delete(m.silences, id)
+	klog.Infof("Silence %s deleted", id)
+	return true
+}
+
+// Silences returns the silences not expired yet, by start time.
+func (m *Manager) Silences() []Silence {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	silences := make([]Silence, 0, len(m.silences))
+	for _, s := range m.silences {
+		if now.Before(s.EndsAt) {
+			silences = append(silences, *s)
+		}
+	}
+	sort.Slice(silences, func(i, j int) bool {
+		if !silences[i].StartsAt.Equal(silences[j].StartsAt) {
+			return silences[i].StartsAt.Before(silences[j].StartsAt)
+		}
+		return silences[i].ID < silences[j].ID
+	})
+
+	return silences
+}
+
+// match returns the routes of an alert. The caller must hold m.mu.
+func (m *Manager) match(labels map[string]string) []*route {
+	var routes []*route
+	for _, r := range m.routes {
+		if !matchAll(r.matchers, labels) {
+			continue
+		}
+		routes = append(routes, r)
+		if !r.cont {
+			break
+		}
+	}
+
+	return routes
+}
+
+// group returns the group of a route alerts with the labels belong to,
+// creating it at now. The caller must hold m.mu.
+func (m *Manager) group(r *route, labels map[string]string, now time.Time) *group {
+	groupLabels := make(map[string]string, len(m.options.GroupBy))
+	for _, name := range m.options.GroupBy {
+		if value, ok := labels[name]; ok {
+			groupLabels[name] = value
+		}
+	}
+	key := r.name + labelsString(groupLabels)
+
+	g, ok := m.groups[key]
+	if !ok {
+		g = &group{
+			key:       key,
+			route:     r,
+			labels:    groupLabels,
+			alerts:    make(map[string]*Alert),
+			createdAt: now,
+			notified:  make(map[string]bool),
+		}
+		m.groups[key] = g
+	}
+
+	return g
+}
+
+// silenced returns whether an active silence mutes the labels. The caller
+// must hold m.mu.
+func (m *Manager) silenced(labels map[string]string, now time.Time) bool {
+	for _, s := range m.silences {
+		if s.Active(now) && matchAll(s.Matchers, labels) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchLabels returns whether labels has every value of want.
+func matchLabels(want, labels map[string]string) bool {
+	for name, value := range want {
+		if labels[name] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// labelsString formats labels as {a="1", b="2"}, sorted by name.
+func labelsString(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, labels[name]))
+	}
+
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+func sortAlerts(alerts []Alert) {
+	sort.Slice(alerts, func(i, j int) bool {
+		if !alerts[i].StartsAt.Equal(alerts[j].StartsAt) {
+			return alerts[i].StartsAt.Before(alerts[j].StartsAt)
+		}
+		return labelsString(alerts[i].Labels) < labelsString(alerts[j].Labels)
+	})
+}
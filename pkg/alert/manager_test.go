@@ -0,0 +1,207 @@
+package alert
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// recordingNotifier records the notifications, failing the first fail ones.
+type recordingNotifier struct {
+	fail          int
+	notifications []*Notification
+}
+
+func (n *recordingNotifier) Name() string {
+	return "recording"
+}
+
+func (n *recordingNotifier) Notify(notification *Notification) error {
+	if n.fail > 0 {
+		n.fail--
+		return fmt.Errorf("channel unavailable")
+	}
+	n.notifications = append(n.notifications, notification)
+
+	return nil
+}
+
+// expectNotified asserts the notifications since the last call, each given
+// as its status and the statuses of its alerts by alert name.
+func (n *recordingNotifier) expectNotified(t *testing.T, want ...string) {
+	t.Helper()
+
+	var got []string
+	for _, notification := range n.notifications {
+		s := notification.Status
+		for _, a := range notification.Alerts {
+			s += fmt.Sprintf(" %s=%s", a.Labels[LabelAlertName], a.Status())
+		}
+		got = append(got, s)
+	}
+	n.notifications = nil
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("notifications = %q, want %q", got, want)
+	}
+}
+
+var testOptions = Options{
+	GroupWait:      30 * time.Second,
+	GroupInterval:  5 * time.Minute,
+	RepeatInterval: time.Hour,
+}
+
+func newTestManager(notifier Notifier) *Manager {
+	return newManager(testOptions, []*route{{name: "default", notifiers: []Notifier{notifier}}})
+}
+
+func testAlert(name string) Alert {
+	return Alert{Labels: map[string]string{
+		LabelAlertName: name,
+		LabelNamespace: "default",
+		LabelWorkload:  "web",
+	}}
+}
+
+func TestManagerGroupsNotifications(t *testing.T) {
+	n := &recordingNotifier{}
+	m := newTestManager(n)
+
+	m.Fire(testAlert("PodCrashLoopBackOff"))
+	start := time.Now()
+	m.Flush(start.Add(10 * time.Second))
+	n.expectNotified(t)
+
+	// the group waits GroupWait for more alerts.
+	m.Fire(testAlert("PodOOMKilled"))
+	m.Flush(start.Add(testOptions.GroupWait))
+	n.expectNotified(t, "firing PodCrashLoopBackOff=firing PodOOMKilled=firing")
+	first := start.Add(testOptions.GroupWait)
+
+	// a changed group is notified at most every GroupInterval.
+	m.Fire(testAlert("PodImagePullFailure"))
+	m.Flush(first.Add(time.Minute))
+	n.expectNotified(t)
+	m.Flush(first.Add(testOptions.GroupInterval))
+	n.expectNotified(t, "firing PodCrashLoopBackOff=firing PodOOMKilled=firing PodImagePullFailure=firing")
+	second := first.Add(testOptions.GroupInterval)
+
+	// an unchanged firing group is notified again every RepeatInterval.
+	m.Fire(testAlert("PodOOMKilled"))
+	m.Flush(second.Add(testOptions.GroupInterval))
+	n.expectNotified(t)
+	m.Flush(second.Add(testOptions.RepeatInterval))
+	n.expectNotified(t, "firing PodCrashLoopBackOff=firing PodOOMKilled=firing PodImagePullFailure=firing")
+}
+
+func TestManagerNotifiesResolvedAlertsOnce(t *testing.T) {
+	n := &recordingNotifier{}
+	m := newTestManager(n)
+
+	alert := testAlert("PodCrashLoopBackOff")
+	m.Fire(alert)
+	now := time.Now().Add(testOptions.GroupWait)
+	m.Flush(now)
+	n.expectNotified(t, "firing PodCrashLoopBackOff=firing")
+
+	m.Resolve(alert.Labels)
+	now = now.Add(testOptions.GroupInterval)
+	m.Flush(now)
+	n.expectNotified(t, "resolved PodCrashLoopBackOff=resolved")
+
+	m.Flush(now.Add(testOptions.RepeatInterval))
+	n.expectNotified(t)
+	if alerts := m.Alerts(nil); len(alerts) != 0 {
+		t.Errorf("alerts = %v, want none once the resolved alert is notified", alerts)
+	}
+}
+
+func TestManagerDropsAlertsResolvedBetweenFlushes(t *testing.T) {
+	n := &recordingNotifier{}
+	m := newTestManager(n)
+
+	// a group whose only alert fires and resolves before its first
+	// notification is never notified.
+	flapping := testAlert("PodOOMKilled")
+	m.Fire(flapping)
+	m.Resolve(flapping.Labels)
+	now := time.Now().Add(testOptions.GroupWait)
+	m.Flush(now)
+	n.expectNotified(t)
+
+	// nor is such an alert of a notified group.
+	m.Fire(testAlert("PodCrashLoopBackOff"))
+	m.Flush(now.Add(testOptions.GroupWait))
+	n.expectNotified(t, "firing PodCrashLoopBackOff=firing")
+	now = now.Add(testOptions.GroupWait)
+	m.Fire(flapping)
+	m.Resolve(flapping.Labels)
+	m.Flush(now.Add(testOptions.GroupInterval))
+	n.expectNotified(t)
+
+	if alerts := m.Alerts(nil); len(alerts) != 1 || alerts[0].Labels[LabelAlertName] != "PodCrashLoopBackOff" {
+		t.Errorf("alerts = %v, want the firing alert only", alerts)
+	}
+}
+
+func TestManagerRetriesFailedNotifications(t *testing.T) {
+	n := &recordingNotifier{}
+	m := newTestManager(n)
+
+	alert := testAlert("PodCrashLoopBackOff")
+	m.Fire(alert)
+	now := time.Now().Add(testOptions.GroupWait)
+	m.Flush(now)
+	n.expectNotified(t, "firing PodCrashLoopBackOff=firing")
+
+	// the failed notification of the resolved alert is retried after
+	// GroupInterval, the alert is still known to have been notified firing.
+	m.Resolve(alert.Labels)
+	n.fail = 1
+	now = now.Add(testOptions.GroupInterval)
+	m.Flush(now)
+	n.expectNotified(t)
+	m.Flush(now.Add(time.Minute))
+	n.expectNotified(t)
+	now = now.Add(testOptions.GroupInterval)
+	m.Flush(now)
+	n.expectNotified(t, "resolved PodCrashLoopBackOff=resolved")
+
+	m.Flush(now.Add(testOptions.GroupInterval))
+	n.expectNotified(t)
+}
+
+func TestManagerSilencesUntilExpiry(t *testing.T) {
+	n := &recordingNotifier{}
+	m := newTestManager(n)
+
+	start := time.Now()
+	silence, err := m.AddSilence(Silence{
+		Matchers: []Matcher{{Name: LabelAlertName, Value: "Pod.*", Regex: true}},
+		EndsAt:   start.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("AddSilence: %v", err)
+	}
+	if _, err := m.AddSilence(Silence{Matchers: []Matcher{{Name: LabelAlertName, Value: "x"}}, EndsAt: start.Add(-time.Minute)}); err == nil {
+		t.Error("AddSilence of an expired silence succeeded")
+	}
+
+	m.Fire(testAlert("PodCrashLoopBackOff"))
+	m.Flush(start.Add(testOptions.GroupWait))
+	n.expectNotified(t)
+	alerts := m.Alerts(nil)
+	if len(alerts) != 1 || len(alerts[0].SilencedBy) != 1 || alerts[0].SilencedBy[0] != silence.ID {
+		t.Fatalf("alerts = %v, want the alert silenced by %s", alerts, silence.ID)
+	}
+
+	// the alert is notified once the silence expired.
+	m.Flush(start.Add(time.Hour))
+	n.expectNotified(t, "firing PodCrashLoopBackOff=firing")
+	m.mu.Lock()
+	silences := len(m.silences)
+	m.mu.Unlock()
+	if silences != 0 {
+		t.Errorf("silences = %d, want the expired silence dropped", silences)
+	}
+}
@@ -0,0 +1,113 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const defaultWebhookTimeout = 10 * time.Second
+
+// LogNotifier logs the notifications.
+type LogNotifier struct {
+	name string
+}
+
+// NewLogNotifier creates a notifier logging the notifications.
+func NewLogNotifier(name string) *LogNotifier {
+	return &LogNotifier{name: name}
+}
+
+// Name implements Notifier.
+func (n *LogNotifier) Name() string {
+	return n.name
+}
+
+// Notify implements Notifier.
+func (n *LogNotifier) Notify(notification *Notification) error {
+	klog.Infof("Alert group %s %s", notification.GroupKey, notification.Status)
+	for _, a := range notification.Alerts {
+		klog.Infof("  [%s] %s %s: %s", a.Status(), a.Labels[LabelAlertName], labelsString(a.Labels), a.Annotations["summary"])
+	}
+
+	return nil
+}
+
+// WebhookOptions configures a notifier posting the notifications as JSON.
+type WebhookOptions struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Timeout bounds a request.
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+}
+
+// WebhookNotifier posts every notification as JSON to a URL.
+type WebhookNotifier struct {
+	name    string
+	options WebhookOptions
+	client  *http.Client
+}
+
+// NewWebhookNotifier creates a webhook notifier, the timeout defaults to 10s.
+func NewWebhookNotifier(name string, options WebhookOptions) (*WebhookNotifier, error) {
+	if options.URL == "" {
+		return nil, fmt.Errorf("webhook url is required")
+	}
+	if options.Timeout.Duration <= 0 {
+		options.Timeout.Duration = defaultWebhookTimeout
+	}
+
+	return &WebhookNotifier{
+		name:    name,
+		options: options,
+		client:  &http.Client{Timeout: options.Timeout.Duration},
+	}, nil
+}
+
+// Name implements Notifier.
+func (n *WebhookNotifier) Name() string {
+	return n.name
+}
+
+// Notify implements Notifier.
+func (n *WebhookNotifier) Notify(notification *Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	return post(n.client, n.options.URL, "application/json", n.options.Headers, body)
+}
+
+// post sends body to url and fails on a non 2xx status.
+func post(client *http.Client, url, contentType string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post to %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+
+	return nil
+}
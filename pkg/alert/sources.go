@@ -0,0 +1,106 @@
+package alert
+
+import (
+	"fmt"
+
+	"github.com/lqshow/access-kubernetes-cluster/pkg/informer"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Severities of the alerts raised by the informer.
+const (
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// HandlePodAlert fires the alerts of pod problems and resolves them once the
+// problem is gone, it is an informer.PodAlertHandler.
+func (m *Manager) HandlePodAlert(a informer.PodAlert, pod *corev1.Pod) {
+	severity := SeverityWarning
+	if a.Problem == informer.PodCrashLoopBackOff || a.Problem == informer.PodOOMKilled {
+		severity = SeverityCritical
+	}
+	labels := map[string]string{
+		LabelAlertName: string(a.Problem),
+		LabelNamespace: a.Namespace,
+		LabelSeverity:  severity,
+		"pod":          a.Pod,
+		"container":    a.Container,
+	}
+	if a.Owner != nil {
+		labels[LabelWorkload] = a.Owner.Kind + "/" + a.Owner.Name
+	}
+	if a.Resolved {
+		m.Resolve(labels)
+		return
+	}
+
+	alert := Alert{
+		Labels: labels,
+		Annotations: map[string]string{
+			"summary":     fmt.Sprintf("Container %s of pod %s/%s: %s", a.Container, a.Namespace, a.Pod, a.Problem),
+			"description": a.Message,
+		},
+		StartsAt: a.FirstSeen,
+	}
+	if pod != nil {
+		alert.Object = pod
+	}
+	m.Fire(alert)
+}
+
+// HandleRollout fires an alert for stalled rollouts and resolves it once the
+// rollout moves on, it is an informer.RolloutHandler.
+func (m *Manager) HandleRollout(r informer.Rollout, deploy *appsv1.Deployment) {
+	labels := map[string]string{
+		LabelAlertName: "RolloutStalled",
+		LabelNamespace: r.Namespace,
+		LabelWorkload:  "Deployment/" + r.Name,
+		LabelSeverity:  SeverityCritical,
+	}
+	if r.Phase != informer.RolloutStalled {
+		m.Resolve(labels)
+		return
+	}
+
+	m.Fire(Alert{
+		Labels: labels,
+		Annotations: map[string]string{
+			"summary":     fmt.Sprintf("Rollout of revision %s of deployment %s/%s stalled", r.Revision, r.Namespace, r.Name),
+			"description": r.Message,
+		},
+		Object: deploy,
+	})
+}
+
+// HandleNodeChange fires an alert for nodes that became NotReady and resolves
+// it once they recover or are deleted, it is an informer.NodeChangeHandler.
+func (m *Manager) HandleNodeChange(change informer.NodeChange) {
+	labels := map[string]string{
+		LabelAlertName: "NodeNotReady",
+		LabelSeverity:  SeverityCritical,
+		"node":         change.Node,
+	}
+	switch change.Type {
+	case informer.NodeRecovered, informer.NodeDeleted:
+		m.Resolve(labels)
+		return
+	case informer.NodeNotReady:
+	default:
+		return
+	}
+
+	alert := Alert{
+		Labels: labels,
+		Annotations: map[string]string{
+			"summary":     fmt.Sprintf("Node %s is NotReady", change.Node),
+			"description": change.Message,
+		},
+	}
+	if change.Since != nil {
+		alert.StartsAt = *change.Since
+	}
+	m.Fire(alert)
+}
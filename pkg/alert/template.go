@@ -0,0 +1,91 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Default templates of the email and chat notifiers.
+const (
+	defaultTitleTemplate = `[{{ .Status | upper }}{{ with .Firing }}:{{ len . }}{{ end }}] {{ labels .GroupLabels }}`
+	defaultTextTemplate  = `{{ range .Alerts }}[{{ .Status }}] {{ index .Annotations "summary" }}
+{{ with index .Annotations "description" }}{{ . }}
+{{ end }}{{ end }}`
+	defaultHTMLTemplate = `<h3>{{ .Status | upper }}: {{ labels .GroupLabels }}</h3>
+<table>
+{{ range .Alerts }}<tr><td>{{ .Status }}</td><td>{{ index .Annotations "summary" }}</td><td>{{ index .Annotations "description" }}</td><td>{{ .StartsAt.Format "2006-01-02 15:04:05 MST" }}</td></tr>
+{{ end }}</table>
+`
+)
+
+// templateFuncs are the functions of the notification templates.
+var templateFuncs = map[string]interface{}{
+	"json":   templateJSON,
+	"join":   strings.Join,
+	"upper":  strings.ToUpper,
+	"labels": labelsString,
+}
+
+// TemplateData is what the notification templates are executed with, the
+// notification and the object of its first alert. Every alert has the
+// object it was raised for as well, e.g.
+// {{ range .Alerts }}{{ with .Object }}{{ .GetName }}{{ end }}{{ end }}.
+type TemplateData struct {
+	*Notification
+	// Object is the object of the first alert, e.g. the Pod, it may be nil.
+	Object runtime.Object
+}
+
+func newTemplateData(notification *Notification) *TemplateData {
+	data := &TemplateData{Notification: notification}
+	for _, a := range notification.Alerts {
+		if a.Object != nil {
+			data.Object = a.Object
+			break
+		}
+	}
+
+	return data
+}
+
+// executor is a text or HTML template.
+type executor interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// parseTemplate parses a text template, def when text is empty.
+func parseTemplate(name, text, def string) (*template.Template, error) {
+	if text == "" {
+		text = def
+	}
+	t, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %v", name, err)
+	}
+
+	return t, nil
+}
+
+func render(t executor, data *TemplateData) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render template: %v", err)
+	}
+
+	return buf.String(), nil
+}
+
+func templateJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
@@ -0,0 +1,4 @@
+package clusterwatch
+
+// GroupName is the group name used in this package
+const GroupName = "clusterwatch.lqshow.io"
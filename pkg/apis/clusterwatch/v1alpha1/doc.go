@@ -0,0 +1,5 @@
+// +k8s:deepcopy-gen=package
+// +groupName=clusterwatch.lqshow.io
+
+// Package v1alpha1 is the v1alpha1 version of the ClusterWatch API.
+package v1alpha1
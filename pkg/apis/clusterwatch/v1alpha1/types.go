@@ -0,0 +1,132 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ClusterWatch declares a set of resources to watch and where to send their
+// change events.
+type ClusterWatch struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterWatchSpec   `json:"spec"`
+	Status ClusterWatchStatus `json:"status,omitempty"`
+}
+
+// ClusterWatchSpec is the spec for a ClusterWatch resource
+type ClusterWatchSpec struct {
+	// Resources are the resources to watch.
+	Resources []WatchResource `json:"resources"`
+	// Namespaces restricts namespaced resources to these namespaces, all
+	// namespaces are watched when empty.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Filter drops events before they are sent to the sinks.
+	// +optional
+	Filter WatchFilter `json:"filter,omitempty"`
+	// Sinks receive the events that pass the filter.
+	Sinks []WatchSink `json:"sinks"`
+}
+
+// WatchResource identifies a resource either by group/version/resource or by
+// kind, the kind is resolved through discovery.
+type WatchResource struct {
+	// +optional
+	Group string `json:"group,omitempty"`
+	// +optional
+	Version string `json:"version,omitempty"`
+	// +optional
+	Resource string `json:"resource,omitempty"`
+	// +optional
+	Kind string `json:"kind,omitempty"`
+
+	// +optional
+	LabelSelector string `json:"labelSelector,omitempty"`
+	// +optional
+	FieldSelector string `json:"fieldSelector,omitempty"`
+}
+
+// WatchFilter selects the events sent to the sinks.
+type WatchFilter struct {
+	// EventTypes are the event types to send, ADDED, MODIFIED or DELETED.
+	// All types are sent when empty.
+	// +optional
+	EventTypes []string `json:"eventTypes,omitempty"`
+	// ExcludeNamespaces drops the events of objects in these namespaces.
+	// +optional
+	ExcludeNamespaces []string `json:"excludeNamespaces,omitempty"`
+}
+
+// WatchSink is a destination of events, exactly one field must be set.
+type WatchSink struct {
+	// Log writes the events to the informer log.
+	// +optional
+	Log bool `json:"log,omitempty"`
+	// Webhook posts the events as JSON to a URL.
+	// +optional
+	Webhook *WebhookSink `json:"webhook,omitempty"`
+}
+
+// WebhookSink posts events to an HTTP endpoint.
+type WebhookSink struct {
+	URL string `json:"url"`
+}
+
+// ClusterWatchPhase is the state of a ClusterWatch.
+type ClusterWatchPhase string
+
+const (
+	// ClusterWatchPending means the informers are starting.
+	ClusterWatchPending ClusterWatchPhase = "Pending"
+	// ClusterWatchSynced means every informer has synchronized.
+	ClusterWatchSynced ClusterWatchPhase = "Synced"
+	// ClusterWatchFailed means the spec couldn't be turned into watches.
+	ClusterWatchFailed ClusterWatchPhase = "Failed"
+)
+
+// ClusterWatchStatus is the status for a ClusterWatch resource
+type ClusterWatchStatus struct {
+	// ObservedGeneration is the generation of the spec the watches run.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// +optional
+	Phase ClusterWatchPhase `json:"phase,omitempty"`
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Resources is the sync state of every watched resource.
+	// +optional
+	Resources []WatchResourceStatus `json:"resources,omitempty"`
+	// EventCount is the number of events sent to the sinks.
+	// +optional
+	EventCount int64 `json:"eventCount,omitempty"`
+	// ErrorCount is the number of events the sinks failed to receive.
+	// +optional
+	ErrorCount int64 `json:"errorCount,omitempty"`
+	// LastError is the last error of a sink.
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+}
+
+// WatchResourceStatus is the sync state of a watched resource.
+type WatchResourceStatus struct {
+	// Resource is the resolved group/version/resource.
+	Resource string `json:"resource"`
+	Synced   bool   `json:"synced"`
+	// +optional
+	Error string `json:"error,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ClusterWatchList is a list of ClusterWatch resources
+type ClusterWatchList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []ClusterWatch `json:"items"`
+}
@@ -0,0 +1,363 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+
+	"github.com/lqshow/access-kubernetes-cluster/pkg/diff"
+	"github.com/lqshow/access-kubernetes-cluster/pkg/informer"
+
+	clusterwatchv1alpha1 "github.com/lqshow/access-kubernetes-cluster/pkg/apis/clusterwatch/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// clusterWatchQueueSize is the number of events buffered for the sinks
+	// of a ClusterWatch, events are dropped when the sinks fall behind.
+	clusterWatchQueueSize = 1000
+	// webhookTimeout bounds a single webhook request.
+	webhookTimeout = 10 * time.Second
+)
+
+// watchedResource is a resource of a ClusterWatch and its informers, one per
+// namespace.
+type watchedResource struct {
+	spec        clusterwatchv1alpha1.WatchResource
+	resource    dynamicResource
+	err         error
+	controllers []*informer.DynamicController
+}
+
+// clusterWatch runs the informers of a ClusterWatch and sends the events
+// passing its filter to its sinks.
+type clusterWatch struct {
+	name       string
+	generation int64
+	spec       clusterwatchv1alpha1.ClusterWatchSpec
+	stopCh     chan struct{}
+	events     chan *informer.Event
+	httpClient *http.Client
+	client     dynamic.Interface
+	dispatcher *informer.Dispatcher
+
+	// err is set if the spec couldn't be turned into watches.
+	err error
+
+	eventCount int64
+	errorCount int64
+	// mu guards the resources, resolved again while the watch is shared,
+	// and the last error.
+	mu        sync.Mutex
+	resources []*watchedResource
+	lastError string
+}
+
+// newClusterWatch validates the spec of a ClusterWatch and starts watching
+// its resources, resources that can't be resolved are reported in their
+// status.
+func newClusterWatch(cw *clusterwatchv1alpha1.ClusterWatch, client dynamic.Interface, mapper meta.RESTMapper, differ *diff.Differ) *clusterWatch {
+	w := &clusterWatch{
+		name:       cw.Name,
+		generation: cw.Generation,
+		spec:       *cw.Spec.DeepCopy(),
+		stopCh:     make(chan struct{}),
+		events:     make(chan *informer.Event, clusterWatchQueueSize),
+		httpClient: &http.Client{Timeout: webhookTimeout},
+		client:     client,
+		dispatcher: informer.NewDispatcher(differ),
+	}
+	if w.err = validateClusterWatchSpec(&w.spec); w.err != nil {
+		return w
+	}
+
+	w.dispatcher.AddHandler(w.handle)
+	go w.send()
+
+	for _, spec := range w.spec.Resources {
+		r := &watchedResource{spec: spec}
+		w.resources = append(w.resources, r)
+		if r.resource, r.err = resolveWatchResource(mapper, spec); r.err == nil {
+			w.watch(r)
+		}
+	}
+
+	return w
+}
+
+// watch starts the informers of a resolved resource. The caller must hold
+// w.mu unless the watch isn't shared yet.
+func (w *clusterWatch) watch(r *watchedResource) {
+
+	namespaces := []string{metav1.NamespaceAll}
+	if r.resource.namespaced && len(w.spec.Namespaces) > 0 {
+		namespaces = w.spec.Namespaces
+	}
+	selector := Selector{LabelSelector: r.spec.LabelSelector, FieldSelector: r.spec.FieldSelector}
+	for _, namespace := range namespaces {
+		controller := informer.NewDynamicController(w.client, namespace, 0, selector.tweakListOptions, w.dispatcher)
+		controller.Run(w.stopCh)
+		controller.Watch(r.resource.gvr, r.resource.kind)
+		r.controllers = append(r.controllers, controller)
+	}
+}
+
+// resolvePending watches the resources that couldn't be resolved so far and
+// returns the number of resources now watched, the informers of the other
+// resources keep running.
+func (w *clusterWatch) resolvePending(mapper meta.RESTMapper) int {
+	w.mu.Lock()
+	var pending []*watchedResource
+	for _, r := range w.resources {
+		if r.err != nil {
+			pending = append(pending, r)
+		}
+	}
+	w.mu.Unlock()
+
+	resolved := 0
+	for _, r := range pending {
+		// discovery may take a round-trip to the API server, w.mu isn't
+		// held meanwhile.
+		resource, err := resolveWatchResource(mapper, r.spec)
+
+		w.mu.Lock()
+		if r.err = err; err == nil {
+			r.resource = resource
+			w.watch(r)
+			resolved++
+		}
+		w.mu.Unlock()
+	}
+
+	return resolved
+}
+
+// stop stops the informers and the sinks.
+func (w *clusterWatch) stop() {
+	close(w.stopCh)
+}
+
+// resolved returns false if a resource couldn't be resolved, it is resolved
+// again on every status refresh.
+func (w *clusterWatch) resolved() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, r := range w.resources {
+		if r.err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// status returns the sync state and the counters of the watch.
+func (w *clusterWatch) status() clusterwatchv1alpha1.ClusterWatchStatus {
+	status := clusterwatchv1alpha1.ClusterWatchStatus{
+		ObservedGeneration: w.generation,
+		Phase:              clusterwatchv1alpha1.ClusterWatchSynced,
+		EventCount:         atomic.LoadInt64(&w.eventCount),
+		ErrorCount:         atomic.LoadInt64(&w.errorCount),
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	status.LastError = w.lastError
+
+	if w.err != nil {
+		status.Phase = clusterwatchv1alpha1.ClusterWatchFailed
+		status.Message = w.err.Error()
+		return status
+	}
+
+	for _, r := range w.resources {
+		resourceStatus := clusterwatchv1alpha1.WatchResourceStatus{
+			Resource: watchResourceString(r.spec),
+			Synced:   r.err == nil,
+		}
+		if r.err != nil {
+			resourceStatus.Error = r.err.Error()
+		} else {
+			resourceStatus.Resource = r.resource.gvr.String()
+			for _, controller := range r.controllers {
+				if !controller.HasSynced() {
+					resourceStatus.Synced = false
+				}
+			}
+		}
+		if !resourceStatus.Synced {
+			status.Phase = clusterwatchv1alpha1.ClusterWatchPending
+		}
+		status.Resources = append(status.Resources, resourceStatus)
+	}
+
+	return status
+}
+
+// handle queues the events passing the filter for the sinks.
+func (w *clusterWatch) handle(event *informer.Event) {
+	if !w.matches(event) {
+		return
+	}
+
+	select {
+	case w.events <- event:
+	default:
+		w.recordError(fmt.Errorf("event queue is full, dropped %s %s %s", event.Type, event.Kind, event.Key()))
+	}
+}
+
+func (w *clusterWatch) matches(event *informer.Event) bool {
+	for _, namespace := range w.spec.Filter.ExcludeNamespaces {
+		if event.Namespace == namespace {
+			return false
+		}
+	}
+	if len(w.spec.Filter.EventTypes) == 0 {
+		return true
+	}
+	for _, eventType := range w.spec.Filter.EventTypes {
+		if strings.EqualFold(eventType, string(event.Type)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// send passes the queued events to every sink until the watch is stopped.
+func (w *clusterWatch) send() {
+	for {
+		select {
+		case event := <-w.events:
+			atomic.AddInt64(&w.eventCount, 1)
+			for _, sink := range w.spec.Sinks {
+				if err := w.sendTo(sink, event); err != nil {
+					w.recordError(err)
+				}
+			}
+		case <-w.stopCh:
+			return
+		}
+	}
+}
+
+func (w *clusterWatch) sendTo(sink clusterwatchv1alpha1.WatchSink, event *informer.Event) error {
+	if sink.Log {
+		klog.Infof("CLUSTERWATCH %s: %s %s %s %s", w.name, event.Type, event.Kind, event.Key(), diff.Summary(event.Diff))
+		return nil
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s %s: %v", event.Kind, event.Key(), err)
+	}
+	resp, err := w.httpClient.Post(sink.Webhook.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to post to webhook %s: %v", sink.Webhook.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s returned %s", sink.Webhook.URL, resp.Status)
+	}
+
+	return nil
+}
+
+func (w *clusterWatch) recordError(err error) {
+	atomic.AddInt64(&w.errorCount, 1)
+	klog.Warningf("ClusterWatch %s: %v", w.name, err)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastError = err.Error()
+}
+
+func validateClusterWatchSpec(spec *clusterwatchv1alpha1.ClusterWatchSpec) error {
+	if len(spec.Resources) == 0 {
+		return fmt.Errorf("at least one resource is required")
+	}
+	for _, r := range spec.Resources {
+		if r.Resource == "" && r.Kind == "" {
+			return fmt.Errorf("resource or kind is required")
+		}
+		if r.Resource != "" && r.Version == "" {
+			return fmt.Errorf("version is required for resource %q", r.Resource)
+		}
+		selector := Selector{LabelSelector: r.LabelSelector, FieldSelector: r.FieldSelector}
+		if err := selector.validate(); err != nil {
+			return err
+		}
+	}
+	for _, eventType := range spec.Filter.EventTypes {
+		switch informer.EventType(strings.ToUpper(eventType)) {
+		case informer.EventAdded, informer.EventUpdated, informer.EventDeleted:
+		default:
+			return fmt.Errorf("invalid event type %q", eventType)
+		}
+	}
+	if len(spec.Sinks) == 0 {
+		return fmt.Errorf("at least one sink is required")
+	}
+	for _, sink := range spec.Sinks {
+		if sink.Log == (sink.Webhook != nil) {
+			return fmt.Errorf("exactly one of log or webhook must be set on a sink")
+		}
+		if sink.Webhook != nil && sink.Webhook.URL == "" {
+			return fmt.Errorf("webhook url is required")
+		}
+	}
+
+	return nil
+}
+
+// resolveWatchResource resolves a resource of a ClusterWatch through
+// discovery, by its group/version/resource or by its kind.
+func resolveWatchResource(mapper meta.RESTMapper, r clusterwatchv1alpha1.WatchResource) (dynamicResource, error) {
+	var mapping *meta.RESTMapping
+	if r.Resource != "" {
+		gvk, err := mapper.KindFor(schema.GroupVersionResource{Group: r.Group, Version: r.Version, Resource: r.Resource})
+		if err != nil {
+			return dynamicResource{}, err
+		}
+		mapping, err = mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return dynamicResource{}, err
+		}
+	} else {
+		var versions []string
+		if r.Version != "" {
+			versions = append(versions, r.Version)
+		}
+		var err error
+		mapping, err = mapper.RESTMapping(schema.GroupKind{Group: r.Group, Kind: r.Kind}, versions...)
+		if err != nil {
+			return dynamicResource{}, err
+		}
+	}
+
+	return dynamicResource{
+		gvr:        mapping.Resource,
+		kind:       mapping.GroupVersionKind.Kind,
+		namespaced: mapping.Scope.Name() == meta.RESTScopeNameNamespace,
+	}, nil
+}
+
+func watchResourceString(r clusterwatchv1alpha1.WatchResource) string {
+	if r.Resource != "" {
+		return schema.GroupVersionResource{Group: r.Group, Version: r.Version, Resource: r.Resource}.String()
+	}
+
+	return schema.GroupKind{Group: r.Group, Kind: r.Kind}.String()
+}
@@ -0,0 +1,295 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	"github.com/lqshow/access-kubernetes-cluster/pkg/diff"
+	"github.com/lqshow/access-kubernetes-cluster/pkg/generated/clientset/versioned"
+	"github.com/lqshow/access-kubernetes-cluster/pkg/generated/informers/externalversions"
+	"github.com/lqshow/access-kubernetes-cluster/pkg/metrics"
+
+	clusterwatchv1alpha1 "github.com/lqshow/access-kubernetes-cluster/pkg/apis/clusterwatch/v1alpha1"
+	clusterwatchscheme "github.com/lqshow/access-kubernetes-cluster/pkg/generated/clientset/versioned/scheme"
+	clusterwatchlisters "github.com/lqshow/access-kubernetes-cluster/pkg/generated/listers/clusterwatch/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ReasonWatchFailed is the Event reason of a ClusterWatch whose spec
+	// couldn't be turned into watches.
+	ReasonWatchFailed = "WatchFailed"
+	// ReasonWatchStarted is the Event reason of a ClusterWatch whose watches
+	// were (re)started.
+	ReasonWatchStarted = "WatchStarted"
+)
+
+func init() {
+	// Events are recorded for ClusterWatches with the client-go scheme.
+	runtime.Must(clusterwatchscheme.AddToScheme(scheme.Scheme))
+}
+
+// ClusterWatchOptions configures the ClusterWatch controller.
+type ClusterWatchOptions struct {
+	// StatusPeriod is the period the status of every ClusterWatch is
+	// refreshed with, it must be positive.
+	StatusPeriod time.Duration
+	// DiffIgnorePaths are JSON pointers skipped when diffing updates.
+	DiffIgnorePaths []string
+	// Recorder records Kubernetes Events on ClusterWatches.
+	Recorder record.EventRecorder
+}
+
+// ClusterWatchController reconciles ClusterWatch resources into running
+// dynamic informers and reports their sync state and error counts in the
+// status of the ClusterWatch.
+type ClusterWatchController struct {
+	client        versioned.Interface
+	dynamicClient dynamic.Interface
+	mapper        *restmapper.DeferredDiscoveryRESTMapper
+	differ        *diff.Differ
+	options       ClusterWatchOptions
+
+	informer cache.SharedIndexInformer
+	lister   clusterwatchlisters.ClusterWatchLister
+
+	workqueue workqueue.RateLimitingInterface
+
+	mu      sync.Mutex
+	watches map[string]*clusterWatch
+	// stopped is set once the watches are stopped at shutdown, watches
+	// started by a worker still running are stopped right away.
+	stopped bool
+}
+
+func NewClusterWatchController(kubeClient kubernetes.Interface, client versioned.Interface, dynamicClient dynamic.Interface,
+	options ClusterWatchOptions) (*ClusterWatchController, error) {
+	if options.Recorder == nil {
+		return nil, fmt.Errorf("an event recorder is required")
+	}
+	if options.StatusPeriod <= 0 {
+		return nil, fmt.Errorf("status period must be positive")
+	}
+	differ, err := diff.NewDiffer(options.DiffIgnorePaths)
+	if err != nil {
+		return nil, err
+	}
+
+	clusterWatchInformer := externalversions.NewSharedInformerFactory(client, 0).Clusterwatch().V1alpha1().ClusterWatches()
+	c := &ClusterWatchController{
+		client:        client,
+		dynamicClient: dynamicClient,
+		mapper:        restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(kubeClient.Discovery())),
+		differ:        differ,
+		options:       options,
+		informer:      clusterWatchInformer.Informer(),
+		lister:        clusterWatchInformer.Lister(),
+		workqueue:     workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ClusterWatches"),
+		watches:       make(map[string]*clusterWatch),
+	}
+
+	klog.Info("Setting up ClusterWatch event handlers.")
+	c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueue,
+		UpdateFunc: func(old, new interface{}) {
+			// the status updates of the controller itself are not
+			// reconciled, the status is refreshed every status period.
+			if old.(*clusterwatchv1alpha1.ClusterWatch).Generation == new.(*clusterwatchv1alpha1.ClusterWatch).Generation {
+				return
+			}
+			c.enqueue(new)
+		},
+		DeleteFunc: c.enqueue,
+	})
+
+	return c, nil
+}
+
+// Run starts the informer and workers, refreshes the status of every
+// ClusterWatch every status period and blocks until stopCh is closed.
+func (c *ClusterWatchController) Run(threadiness int, stopCh <-chan struct{}) error {
+	defer runtime.HandleCrash()
+	defer c.workqueue.ShutDown()
+
+	go c.informer.Run(stopCh)
+	klog.Info("Waiting for ClusterWatch informer caches to sync.")
+	if !cache.WaitForCacheSync(stopCh, c.informer.HasSynced) {
+		return fmt.Errorf("timed out waiting for caches to sync")
+	}
+
+	for i := 0; i < threadiness; i++ {
+		go wait.Until(c.runWorker, time.Second, stopCh)
+	}
+	go wait.Until(c.refreshStatus, c.options.StatusPeriod, stopCh)
+
+	<-stopCh
+	klog.Info("Shutting down ClusterWatch workers")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopped = true
+	for name, w := range c.watches {
+		w.stop()
+		delete(c.watches, name)
+	}
+
+	return nil
+}
+
+// HasSynced returns true once the ClusterWatch informer cache has been
+// synchronized.
+func (c *ClusterWatchController) HasSynced() bool {
+	return c.informer.HasSynced()
+}
+
+func (c *ClusterWatchController) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *ClusterWatchController) processNextWorkItem() bool {
+	obj, shutdown := c.workqueue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.workqueue.Done(obj)
+
+	key, ok := obj.(string)
+	if !ok {
+		c.workqueue.Forget(obj)
+		runtime.HandleError(fmt.Errorf("expected string in workqueue but got %#v", obj))
+		return true
+	}
+
+	err := c.syncHandler(key)
+	metrics.ObserveReconcile("clusterwatches", err)
+	if err != nil {
+		c.workqueue.AddRateLimited(key)
+		runtime.HandleError(fmt.Errorf("error syncing '%s': %s", key, err.Error()))
+		return true
+	}
+	c.workqueue.Forget(obj)
+
+	return true
+}
+
+// syncHandler starts, restarts or stops the watches of a ClusterWatch and
+// updates its status. Watches are restarted when the spec changes, the
+// resources that couldn't be resolved are resolved again on every status
+// refresh.
+func (c *ClusterWatchController) syncHandler(name string) error {
+	cw, err := c.lister.Get(name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			klog.Infof("ClusterWatch %s does not exist anymore, stopping its watches", name)
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if w, ok := c.watches[name]; ok {
+				w.stop()
+				delete(c.watches, name)
+			}
+			return nil
+		}
+
+		return err
+	}
+
+	// the resources are resolved without holding c.mu, discovery may take a
+	// round-trip to the API server. The work queue doesn't sync a
+	// ClusterWatch from two workers at once.
+	c.mu.Lock()
+	w, ok := c.watches[name]
+	c.mu.Unlock()
+	if !ok || w.generation != cw.Generation {
+		w = newClusterWatch(cw, c.dynamicClient, c.mapper, c.differ)
+
+		c.mu.Lock()
+		if c.stopped {
+			c.mu.Unlock()
+			w.stop()
+			return nil
+		}
+		if previous, ok := c.watches[name]; ok {
+			previous.stop()
+		}
+		c.watches[name] = w
+		c.mu.Unlock()
+
+		if w.err != nil {
+			c.options.Recorder.Eventf(cw, corev1.EventTypeWarning, ReasonWatchFailed, "Invalid spec: %v", w.err)
+		} else {
+			c.options.Recorder.Eventf(cw, corev1.EventTypeNormal, ReasonWatchStarted, "Watching %d resources", len(w.resources))
+		}
+	} else if w.err == nil && !w.resolved() {
+		if resolved := w.resolvePending(c.mapper); resolved > 0 {
+			c.options.Recorder.Eventf(cw, corev1.EventTypeNormal, ReasonWatchStarted, "Watching %d more resources", resolved)
+		}
+	}
+
+	return c.updateStatus(cw, w.status())
+}
+
+func (c *ClusterWatchController) updateStatus(cw *clusterwatchv1alpha1.ClusterWatch, status clusterwatchv1alpha1.ClusterWatchStatus) error {
+	if equality.Semantic.DeepEqual(cw.Status, status) {
+		return nil
+	}
+
+	// NEVER modify objects from the store. It's a read-only, local cache.
+	cwCopy := cw.DeepCopy()
+	cwCopy.Status = status
+	_, err := c.client.ClusterwatchV1alpha1().ClusterWatches().UpdateStatus(context.TODO(), cwCopy, metav1.UpdateOptions{})
+	return err
+}
+
+func (c *ClusterWatchController) enqueue(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+
+	c.workqueue.Add(key)
+}
+
+// refreshStatus puts every ClusterWatch onto the work queue to refresh their
+// status. Discovery is cached, it is reset first while a resource can't be
+// resolved so the resources of new CRDs are found.
+func (c *ClusterWatchController) refreshStatus() {
+	c.mu.Lock()
+	unresolved := false
+	for _, w := range c.watches {
+		if w.err == nil && !w.resolved() {
+			unresolved = true
+		}
+	}
+	c.mu.Unlock()
+	if unresolved {
+		c.mapper.Reset()
+	}
+
+	c.enqueueAll()
+}
+
+// enqueueAll puts every ClusterWatch onto the work queue.
+func (c *ClusterWatchController) enqueueAll() {
+	for _, key := range c.informer.GetStore().ListKeys() {
+		c.workqueue.Add(key)
+	}
+}
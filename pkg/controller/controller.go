@@ -1,26 +1,308 @@
 package controller
 
 import (
+	"fmt"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
 
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 
+	"github.com/lqshow/access-kubernetes-cluster/pkg/diff"
 	"github.com/lqshow/access-kubernetes-cluster/pkg/informer"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// Selector restricts the objects of a resource that are listed and watched.
+type Selector struct {
+	LabelSelector string
+	FieldSelector string
+}
+
+// tweakListOptions applies the selector to the list/watch requests of an informer.
+func (s Selector) tweakListOptions(options *metav1.ListOptions) {
+	options.LabelSelector = s.LabelSelector
+	options.FieldSelector = s.FieldSelector
+}
+
+func (s Selector) validate() error {
+	if _, err := labels.Parse(s.LabelSelector); err != nil {
+		return fmt.Errorf("invalid label selector %q: %v", s.LabelSelector, err)
+	}
+	if _, err := fields.ParseSelector(s.FieldSelector); err != nil {
+		return fmt.Errorf("invalid field selector %q: %v", s.FieldSelector, err)
+	}
+
+	return nil
+}
+
+// ResourceOptions configures the informer and reconciliation of a resource.
+type ResourceOptions struct {
+	Selector
+
+	// ResyncPeriod is the resync period of the informer, 0 disables resync.
+	ResyncPeriod time.Duration
+	// ReconcilePeriod re-enqueues every known object of the resource on a
+	// schedule, 0 disables periodic reconciliation.
+	ReconcilePeriod time.Duration
+}
+
+// Options configures which namespaces and objects the controller watches.
+type Options struct {
+	// Namespaces are watched for the lifetime of the controller, an empty
+	// string watches all namespaces.
+	Namespaces []string
+	// NamespaceSelector adds and removes watched namespaces as namespaces
+	// matching the label selector come and go.
+	NamespaceSelector string
+
+	Pods        ResourceOptions
+	Deployments ResourceOptions
+	Nodes       ResourceOptions
+
+	// ReconcileJitter is the maximum factor added to reconcile periods.
+	ReconcileJitter float64
+
+	// Recorder records Kubernetes Events on behalf of the reconcilers.
+	Recorder record.EventRecorder
+
+	// NodeTimelineSize is the number of changes kept per node, the changes
+	// of a deleted node are kept for NodeTimelineRetention.
+	NodeTimelineSize      int
+	NodeTimelineRetention time.Duration
+	// RolloutHistorySize is the number of finished rollouts kept per
+	// deployment.
+	RolloutHistorySize int
+
+	// DiffIgnorePaths are JSON pointers skipped when diffing updates.
+	DiffIgnorePaths []string
+
+	// SnapshotPath is the file the informer stores are periodically written
+	// to every SnapshotPeriod. Queries are served from the snapshot at start
+	// until the informers have synchronized. Snapshots are disabled when
+	// empty.
+	SnapshotPath   string
+	SnapshotPeriod time.Duration
+
+	// OwnerGraph tracks the ownerReferences of the watched objects, the
+	// ReplicaSets, StatefulSets, DaemonSets, Jobs and CronJobs of the
+	// watched namespaces are watched to complete the graph. CronJobs of
+	// batch/v1 are watched with DynamicClient.
+	OwnerGraph bool
+
+	// PodHealth analyzes the container statuses of the reconciled pods for
+	// crash loops, OOMKills, image pull failures and stuck init containers,
+	// nil disables the analysis.
+	PodHealth *informer.PodHealthOptions
+	// PodGC deletes the finished pods of the watched namespaces once they
+	// are old enough, nil disables the collection.
+	PodGC *informer.PodGCOptions
+
+	// Resources are watched with dynamic informers, given as
+	// group/version/resource or Kind.group resolved through discovery.
+	Resources []string
+	// CustomResourceGroups are API groups whose custom resources are watched
+	// as their CRDs are installed, "*" watches every custom resource.
+	CustomResourceGroups []string
+	// Dynamic applies to the informers of Resources and custom resources.
+	Dynamic ResourceOptions
+	// DynamicClient is required when Resources or CustomResourceGroups are set.
+	DynamicClient dynamic.Interface
+}
+
 type Controller struct {
-	informerFactory informers.SharedInformerFactory
+	kubeClient kubernetes.Interface
+	options    Options
+
+	threadiness int
+
+	dispatcher     *informer.Dispatcher
+	nodeController *informer.NodeController
+	rollouts       *informer.RolloutTracker
+	// owners is nil if the owner graph is disabled.
+	owners *informer.OwnerGraph
+	// cronJobs is the resource CronJobs are watched with for the owner
+	// graph, nil if no version is served.
+	cronJobs *schema.GroupVersionResource
+	// health is nil if the pod health analysis is disabled.
+	health *informer.PodHealthAnalyzer
+	// gc is nil if the pod collection is disabled.
+	gc *informer.PodGarbageCollector
+
+	dynamicClient  dynamic.Interface
+	mapper         *restmapper.DeferredDiscoveryRESTMapper
+	clusterDynamic *informer.DynamicController
+	// rediscovery queues a single key to reset discovery and resolve the
+	// pending resources once for a burst of CRD changes.
+	rediscovery workqueue.DelayingInterface
+
+	// warm holds the indexers of the snapshot loaded at start by kind, until
+	// the informers have synchronized.
+	warmMu sync.Mutex
+	warm   map[string]cache.Indexer
+
+	mu               sync.Mutex
+	scopes           map[string]*scope
+	dynamicResources map[schema.GroupVersionResource]dynamicResource
+	pendingResources []string
+	// configuredResources holds the configured resource spec of the watched
+	// resources, to watch them again once their CRD is recreated.
+	configuredResources map[schema.GroupVersionResource]string
+	// started is set once the initially watched namespaces are started.
+	started bool
+	stopped bool
 }
 
-func NewController(informerFactory informers.SharedInformerFactory) *Controller {
-	return &Controller{
-		informerFactory: informerFactory,
+func NewController(kubeClient kubernetes.Interface, options Options) (*Controller, error) {
+	for _, resource := range []ResourceOptions{options.Pods, options.Deployments, options.Nodes, options.Dynamic} {
+		if err := resource.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if options.Recorder == nil {
+		return nil, fmt.Errorf("an event recorder is required")
+	}
+	if options.SnapshotPath != "" && options.SnapshotPeriod <= 0 {
+		return nil, fmt.Errorf("snapshot period must be positive")
+	}
+	if _, err := labels.Parse(options.NamespaceSelector); err != nil {
+		return nil, fmt.Errorf("invalid namespace selector %q: %v", options.NamespaceSelector, err)
+	}
+
+	differ, err := diff.NewDiffer(options.DiffIgnorePaths)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Controller{
+		kubeClient:          kubeClient,
+		options:             options,
+		dynamicClient:       options.DynamicClient,
+		dispatcher:          informer.NewDispatcher(differ),
+		scopes:              make(map[string]*scope),
+		dynamicResources:    make(map[schema.GroupVersionResource]dynamicResource),
+		configuredResources: make(map[schema.GroupVersionResource]string),
+	}
+	if options.OwnerGraph {
+		c.owners = informer.NewOwnerGraph()
+		c.dispatcher.AddHandler(c.owners.HandleEvent)
+	}
+	c.rollouts = informer.NewRolloutTracker(options.Recorder, options.RolloutHistorySize)
+	if options.PodHealth != nil {
+		if c.health, err = informer.NewPodHealthAnalyzer(*options.PodHealth, options.Recorder, c.owners); err != nil {
+			return nil, err
+		}
+	}
+	if options.PodGC != nil {
+		if c.gc, err = informer.NewPodGarbageCollector(kubeClient, *options.PodGC, options.Recorder); err != nil {
+			return nil, err
+		}
+	}
+	// defined for which resource to be informed, we will be informed for nodes
+	c.nodeController = informer.NewNodeController(c.newInformerFactory(metav1.NamespaceAll, options.Nodes), options.NodeTimelineSize, options.NodeTimelineRetention, c.dispatcher)
+
+	if c.dynamicEnabled() {
+		if options.DynamicClient == nil {
+			return nil, fmt.Errorf("a dynamic client is required to watch resources")
+		}
+		for _, spec := range options.Resources {
+			if _, _, err := parseResource(spec); err != nil {
+				return nil, err
+			}
+		}
+		c.mapper = restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(kubeClient.Discovery()))
+		c.clusterDynamic = c.newDynamicController(metav1.NamespaceAll)
+		c.rediscovery = workqueue.NewNamedDelayingQueue("rediscovery")
 	}
+
+	return c, nil
+}
+
+// Dispatcher returns the dispatcher of the change events of every watched
+// object.
+func (c *Controller) Dispatcher() *informer.Dispatcher {
+	return c.dispatcher
+}
+
+// OwnerGraph returns the graph of the ownerReferences of the watched
+// objects, nil is returned if the graph is disabled.
+func (c *Controller) OwnerGraph() *informer.OwnerGraph {
+	return c.owners
+}
+
+// PodHealth returns the analyzer of the container statuses of the watched
+// pods, nil is returned if the analysis is disabled.
+func (c *Controller) PodHealth() *informer.PodHealthAnalyzer {
+	return c.health
+}
+
+// Rollouts returns the tracker of the rollouts of the watched deployments.
+func (c *Controller) Rollouts() *informer.RolloutTracker {
+	return c.rollouts
+}
+
+// NodeController returns the controller monitoring node changes.
+func (c *Controller) NodeController() *informer.NodeController {
+	return c.nodeController
+}
+
+// newInformerFactory creates a shared informer factory restricted to a
+// namespace and the selector of a resource.
+func (c *Controller) newInformerFactory(namespace string, resource ResourceOptions) informers.SharedInformerFactory {
+	return informers.NewSharedInformerFactoryWithOptions(c.kubeClient, resource.ResyncPeriod,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(resource.tweakListOptions),
+	)
+}
+
+// dynamicEnabled returns true if resources are watched with dynamic informers.
+func (c *Controller) dynamicEnabled() bool {
+	return len(c.options.Resources) > 0 || len(c.options.CustomResourceGroups) > 0
+}
+
+// newDynamicController creates a dynamic controller for a namespace, nil is
+// returned if no resources are watched with dynamic informers.
+func (c *Controller) newDynamicController(namespace string) *informer.DynamicController {
+	if !c.dynamicEnabled() {
+		return nil
+	}
+
+	return informer.NewDynamicController(c.dynamicClient, namespace, c.options.Dynamic.ResyncPeriod,
+		c.options.Dynamic.tweakListOptions, c.dispatcher)
+}
+
+// runPeriodicReconcile calls enqueueAll every jittered period until stopCh is
+// closed. The first run happens after a period as the informer has just
+// enqueued every object.
+func (c *Controller) runPeriodicReconcile(enqueueAll func(), period time.Duration, stopCh <-chan struct{}) {
+	if period <= 0 {
+		return
+	}
+
+	go func() {
+		select {
+		case <-time.After(wait.Jitter(period, c.options.ReconcileJitter)):
+		case <-stopCh:
+			return
+		}
+		wait.JitterUntil(enqueueAll, period, c.options.ReconcileJitter, true, stopCh)
+	}()
 }
 
 func (c *Controller) Run(threadiness int, stopCh <-chan struct{}) error {
@@ -28,44 +310,130 @@ func (c *Controller) Run(threadiness int, stopCh <-chan struct{}) error {
 	defer runtime.HandleCrash()
 	zap.S().Debugf("Starting Shared Informer Controller Manager.")
 
-	// Starts all the shared informers that have been created by the factory so far.
-	//go c.informerFactory.Start(stopCh)
+	c.threadiness = threadiness
 
-	// defined for which resource to be informed, we will be informed for nodes
-	nodeController := informer.NewNodeController(c.informerFactory)
-	if err := nodeController.Run(stopCh); err != nil {
+	// the snapshot is served while the informers list and watch, it is
+	// loaded before any of them is started.
+	if c.options.SnapshotPath != "" {
+		c.loadSnapshot()
+	}
+	if err := c.nodeController.Run(stopCh); err != nil {
 		return err
 	}
-	//if err := nodeController.List(); err != nil {
+	//if err := c.nodeController.List(); err != nil {
 	//	zap.S().Debugf("node list err: %v", err)
 	//	return err
 	//}
 
-	deployController := informer.NewDeploymentController(c.informerFactory)
-	if err := deployController.Run(stopCh); err != nil {
-		return err
+	if c.dynamicEnabled() {
+		c.clusterDynamic.Run(stopCh)
+		c.mu.Lock()
+		c.pendingResources = append([]string(nil), c.options.Resources...)
+		c.mu.Unlock()
+		c.resolvePendingResources()
+		if err := c.watchCustomResourceDefinitions(stopCh); err != nil {
+			return err
+		}
 	}
 
-	// defined for which resource to be informed, we will be informed for pods
-	podController := informer.NewPodController(c.informerFactory)
-	if err := podController.Run(stopCh); err != nil {
-		return err
+	if c.gc != nil {
+		go c.gc.Run(stopCh)
 	}
-	//if err := podController.List(); err != nil {
-	//	zap.S().Debugf("pod list err: %v", err)
-	//	return err
-	//}
+	if c.owners != nil {
+		c.cronJobs = c.discoverCronJobs()
+	}
+
+	for _, namespace := range c.options.Namespaces {
+		if err := c.startScope(namespace); err != nil {
+			return err
+		}
+	}
+
+	if c.options.NamespaceSelector != "" {
+		if err := c.watchNamespaces(stopCh); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	c.started = true
+	c.mu.Unlock()
 
-	klog.Info("Starting workers")
-	// Launch three workers to process user-defined resources
-	for i := 0; i < threadiness; i++ {
-		go wait.Until(deployController.RunWorker, time.Second, stopCh)
-		go wait.Until(podController.RunWorker, time.Second, stopCh)
+	if c.options.SnapshotPath != "" {
+		go wait.Until(c.writeSnapshot, c.options.SnapshotPeriod, stopCh)
 	}
 
-	klog.Info("Started workers")
 	<-stopCh
 	klog.Info("Shutting down workers")
+	if c.options.SnapshotPath != "" {
+		c.writeSnapshot()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopped = true
+	for namespace := range c.scopes {
+		c.stopScope(namespace)
+	}
+
+	return nil
+}
+
+// HasSynced returns true once the node informer and the informers of every
+// watched namespace have been synchronized.
+func (c *Controller) HasSynced() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.started || !c.nodeController.HasSynced() {
+		return false
+	}
+	if c.clusterDynamic != nil && !c.clusterDynamic.HasSynced() {
+		return false
+	}
+	for _, s := range c.scopes {
+		for _, synced := range s.synced {
+			if !synced() {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// watchNamespaces starts and stops scopes as namespaces matching the
+// namespace selector are added and removed. A namespace whose labels stop
+// matching the selector is delivered as a delete by the watch.
+func (c *Controller) watchNamespaces(stopCh <-chan struct{}) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(c.kubeClient, 0,
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = c.options.NamespaceSelector
+		}),
+	)
+	nsInformer := factory.Core().V1().Namespaces().Informer()
+	nsInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			ns := obj.(*corev1.Namespace)
+			go c.retryStartScope(ns.Name, nsInformer.GetStore(), stopCh)
+		},
+		DeleteFunc: func(obj interface{}) {
+			key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+			if err != nil {
+				runtime.HandleError(err)
+				return
+			}
+
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.stopScope(key)
+		},
+	})
+
+	go nsInformer.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, nsInformer.HasSynced) {
+		return fmt.Errorf("timed out waiting for namespace caches to sync")
+	}
 
 	return nil
 }
@@ -0,0 +1,562 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	"github.com/lqshow/access-kubernetes-cluster/pkg/metrics"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+)
+
+const (
+	// UptimeAnnotation is the uptime schedule of a Deployment or
+	// StatefulSet, or of every one in a namespace when set on the Namespace,
+	// see UptimeSchedule. The annotation of the workload takes precedence.
+	UptimeAnnotation = "informer.lqshow.io/uptime"
+	// OriginalReplicasAnnotation holds the replicas of a workload scaled down
+	// outside its uptime, restored when the uptime starts.
+	OriginalReplicasAnnotation = "informer.lqshow.io/original-replicas"
+	// OverrideAnnotation holds the DownscalerOverride of a workload, or of
+	// the workloads of a namespace when set on the Namespace, as JSON.
+	OverrideAnnotation = "informer.lqshow.io/downscaler-override"
+
+	// ReasonScaledDown is the Event reason of a workload scaled to zero
+	// outside its uptime.
+	ReasonScaledDown = "ScaledDown"
+	// ReasonScaledUp is the Event reason of a workload restored to its
+	// original replicas.
+	ReasonScaledUp = "ScaledUp"
+	// ReasonInvalidUptime is the Event reason of a workload whose uptime
+	// schedule can't be parsed.
+	ReasonInvalidUptime = "InvalidUptime"
+)
+
+// DownscalerOptions configures the downscaler controller.
+type DownscalerOptions struct {
+	// Namespace restricts the downscaler to a namespace, every namespace is
+	// watched when empty.
+	Namespace string
+	// Period is the interval the schedules are evaluated at, a minute by
+	// default.
+	Period time.Duration
+	// Recorder records Kubernetes Events on the scaled workloads.
+	Recorder record.EventRecorder
+}
+
+// DownscalerOverride keeps the workloads of a namespace, or a single
+// workload, scaled up or down regardless of their schedule until it expires.
+// It is persisted in the OverrideAnnotation of the Namespace or workload.
+type DownscalerOverride struct {
+	Namespace string `json:"namespace"`
+	// Kind, Deployment or StatefulSet, and Name select a single workload,
+	// the override applies to the whole namespace when they are empty.
+	Kind string `json:"kind,omitempty"`
+	Name string `json:"name,omitempty"`
+	// Up keeps the workloads scaled up, otherwise they are scaled down.
+	Up        bool      `json:"up"`
+	Until     time.Time `json:"until"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+	Comment   string    `json:"comment,omitempty"`
+}
+
+func (o DownscalerOverride) key() string {
+	return o.Namespace + "/" + o.Kind + "/" + o.Name
+}
+
+// overrideOf returns the override annotated on a Namespace or workload,
+// false if it has none or it is invalid.
+func overrideOf(kind string, meta metav1.Object) (DownscalerOverride, bool) {
+	value, ok := meta.GetAnnotations()[OverrideAnnotation]
+	if !ok {
+		return DownscalerOverride{}, false
+	}
+	var override DownscalerOverride
+	if err := json.Unmarshal([]byte(value), &override); err != nil {
+		klog.V(2).Infof("Ignoring invalid %s of %s %s: %v", OverrideAnnotation, kind, meta.GetName(), err)
+		return DownscalerOverride{}, false
+	}
+	// the annotated object is what the override applies to.
+	override.Namespace = meta.GetNamespace()
+	override.Kind = kind
+	override.Name = meta.GetName()
+	if kind == "Namespace" {
+		override.Namespace, override.Kind, override.Name = meta.GetName(), "", ""
+	}
+
+	return override, true
+}
+
+// DownscalerController scales Deployments and StatefulSets to zero outside
+// the uptime schedule annotated on them or their namespace, and restores
+// their replicas when the uptime starts again.
+type DownscalerController struct {
+	kubeClient kubernetes.Interface
+	options    DownscalerOptions
+
+	factory    informers.SharedInformerFactory
+	namespaces corelisters.NamespaceLister
+	// workloads holds the informers of the workloads by kind.
+	workloads map[string]cache.SharedIndexInformer
+	synced    []cache.InformerSynced
+
+	// workqueue holds workloads as Kind/namespace/name.
+	workqueue workqueue.RateLimitingInterface
+
+	mu sync.Mutex
+	// schedules caches the parsed schedules by annotation value.
+	schedules map[string]UptimeSchedule
+	// invalid holds the invalid schedule reported for a workload key, so it
+	// is reported once.
+	invalid map[string]string
+}
+
+func NewDownscalerController(kubeClient kubernetes.Interface, options DownscalerOptions) (*DownscalerController, error) {
+	if options.Recorder == nil {
+		return nil, fmt.Errorf("an event recorder is required")
+	}
+	if options.Period <= 0 {
+		options.Period = time.Minute
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(kubeClient, 0, informers.WithNamespace(options.Namespace))
+	c := &DownscalerController{
+		kubeClient: kubeClient,
+		options:    options,
+		factory:    factory,
+		namespaces: factory.Core().V1().Namespaces().Lister(),
+		workloads: map[string]cache.SharedIndexInformer{
+			"Deployment":  factory.Apps().V1().Deployments().Informer(),
+			"StatefulSet": factory.Apps().V1().StatefulSets().Informer(),
+		},
+		workqueue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "downscaler"),
+		schedules: make(map[string]UptimeSchedule),
+		invalid:   make(map[string]string),
+	}
+
+	for kind, i := range c.workloads {
+		kind := kind
+		i.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				c.enqueue(kind, obj)
+			},
+			UpdateFunc: func(old, new interface{}) {
+				c.enqueue(kind, new)
+			},
+		})
+		c.synced = append(c.synced, i.HasSynced)
+	}
+	namespaces := factory.Core().V1().Namespaces().Informer()
+	namespaces.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(old, new interface{}) {
+			oldAnnotations, newAnnotations := old.(*corev1.Namespace).Annotations, new.(*corev1.Namespace).Annotations
+			if oldAnnotations[UptimeAnnotation] != newAnnotations[UptimeAnnotation] ||
+				oldAnnotations[OverrideAnnotation] != newAnnotations[OverrideAnnotation] {
+				c.enqueueNamespace(new.(*corev1.Namespace).Name)
+			}
+		},
+	})
+	c.synced = append(c.synced, namespaces.HasSynced)
+
+	return c, nil
+}
+
+// Run starts the informers and workers, evaluates the schedules every period
+// and blocks until stopCh is closed.
+func (c *DownscalerController) Run(threadiness int, stopCh <-chan struct{}) error {
+	defer utilruntime.HandleCrash()
+	defer c.workqueue.ShutDown()
+
+	c.factory.Start(stopCh)
+	klog.Info("Waiting for downscaler informer caches to sync.")
+	if !cache.WaitForCacheSync(stopCh, c.synced...) {
+		return fmt.Errorf("timed out waiting for caches to sync")
+	}
+
+	for i := 0; i < threadiness; i++ {
+		go wait.Until(c.runWorker, time.Second, stopCh)
+	}
+	go wait.Until(c.resync, c.options.Period, stopCh)
+
+	<-stopCh
+	klog.Info("Shutting down downscaler workers")
+	return nil
+}
+
+func (c *DownscalerController) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *DownscalerController) processNextWorkItem() bool {
+	obj, shutdown := c.workqueue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.workqueue.Done(obj)
+
+	key, ok := obj.(string)
+	if !ok {
+		c.workqueue.Forget(obj)
+		utilruntime.HandleError(fmt.Errorf("expected string in workqueue but got %#v", obj))
+		return true
+	}
+
+	err := c.syncHandler(key)
+	metrics.ObserveReconcile("downscaler", err)
+	if err != nil {
+		c.workqueue.AddRateLimited(key)
+		utilruntime.HandleError(fmt.Errorf("error syncing '%s': %s", key, err.Error()))
+		return true
+	}
+	c.workqueue.Forget(obj)
+
+	return true
+}
+
+// syncHandler scales a workload down when it is outside its uptime, and
+// restores the replicas of a scaled down workload within its uptime.
+func (c *DownscalerController) syncHandler(key string) error {
+	parts := strings.SplitN(key, "/", 2)
+	if len(parts) != 2 || c.workloads[parts[0]] == nil {
+		utilruntime.HandleError(fmt.Errorf("invalid workload key: %s", key))
+		return nil
+	}
+	kind := parts[0]
+	obj, exists, err := c.workloads[kind].GetIndexer().GetByKey(parts[1])
+	if err != nil || !exists {
+		return err
+	}
+	meta, replicas := workloadReplicas(obj)
+	if meta == nil || meta.GetDeletionTimestamp() != nil {
+		return nil
+	}
+
+	up, err := c.desiredUp(key, kind, meta, time.Now())
+	if err != nil {
+		return err
+	}
+	original, scaledDown := meta.GetAnnotations()[OriginalReplicasAnnotation]
+
+	if up {
+		if !scaledDown {
+			return nil
+		}
+		restore, err := strconv.ParseInt(original, 10, 32)
+		if err != nil || restore < 0 {
+			utilruntime.HandleError(fmt.Errorf("invalid %s of %s: %q", OriginalReplicasAnnotation, key, original))
+			restore = 1
+		}
+		if err := c.scale(kind, meta, int32(restore), nil); err != nil {
+			return err
+		}
+		klog.Infof("Scaled %s %s/%s up to %d replicas", kind, meta.GetNamespace(), meta.GetName(), restore)
+		c.options.Recorder.Eventf(obj.(runtime.Object), corev1.EventTypeNormal, ReasonScaledUp, "Scaled up to %d replicas within the uptime", restore)
+		return nil
+	}
+
+	if replicas == 0 {
+		// there is nothing to restore for a workload scaled to zero by hand.
+		return nil
+	}
+	if !scaledDown {
+		original = strconv.Itoa(int(replicas))
+	}
+	if err := c.scale(kind, meta, 0, &original); err != nil {
+		return err
+	}
+	klog.Infof("Scaled %s %s/%s down from %s replicas", kind, meta.GetNamespace(), meta.GetName(), original)
+	c.options.Recorder.Eventf(obj.(runtime.Object), corev1.EventTypeNormal, ReasonScaledDown, "Scaled down from %s replicas outside the uptime", original)
+	return nil
+}
+
+// desiredUp returns whether a workload should run now, given by an override
+// or else by the uptime schedule of the workload or its namespace. Workloads
+// without a schedule are left running.
+func (c *DownscalerController) desiredUp(key, kind string, meta metav1.Object, now time.Time) (bool, error) {
+	ns, err := c.namespaces.Get(meta.GetNamespace())
+	if err != nil && !errors.IsNotFound(err) {
+		return false, err
+	}
+	// the override of the workload takes precedence over the override of
+	// its namespace.
+	if override, ok := overrideOf(kind, meta); ok && override.Until.After(now) {
+		return override.Up, nil
+	}
+	if ns != nil {
+		if override, ok := overrideOf("Namespace", ns); ok && override.Until.After(now) {
+			return override.Up, nil
+		}
+	}
+
+	value := meta.GetAnnotations()[UptimeAnnotation]
+	if value == "" && ns != nil {
+		value = ns.Annotations[UptimeAnnotation]
+	}
+	if value == "" {
+		return true, nil
+	}
+
+	schedule, err := c.schedule(value)
+	if err != nil {
+		c.mu.Lock()
+		reported := c.invalid[key] == value
+		c.invalid[key] = value
+		c.mu.Unlock()
+		if !reported {
+			c.options.Recorder.Eventf(meta.(runtime.Object), corev1.EventTypeWarning, ReasonInvalidUptime, "Invalid uptime %q: %v", value, err)
+		}
+		// an invalid schedule leaves the workload running.
+		return true, nil
+	}
+
+	return schedule.Up(now), nil
+}
+
+// schedule parses an uptime schedule, parsed schedules are cached.
+func (c *DownscalerController) schedule(value string) (UptimeSchedule, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if schedule, ok := c.schedules[value]; ok {
+		return schedule, nil
+	}
+
+	schedule, err := ParseUptimeSchedule(value)
+	if err != nil {
+		return UptimeSchedule{}, err
+	}
+	c.schedules[value] = schedule
+	return schedule, nil
+}
+
+// scale sets the replicas of a workload and its original replicas
+// annotation, which is removed when original is nil.
+func (c *DownscalerController) scale(kind string, meta metav1.Object, replicas int32, original *string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]*string{OriginalReplicasAnnotation: original},
+		},
+		"spec": map[string]interface{}{
+			"replicas": replicas,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	switch kind {
+	case "Deployment":
+		_, err = c.kubeClient.AppsV1().Deployments(meta.GetNamespace()).Patch(context.TODO(), meta.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+	case "StatefulSet":
+		_, err = c.kubeClient.AppsV1().StatefulSets(meta.GetNamespace()).Patch(context.TODO(), meta.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+	}
+	if errors.IsNotFound(err) {
+		return nil
+	}
+
+	return err
+}
+
+// SetOverride annotates an override on its Namespace or workload, replacing
+// the one of the same namespace and workload.
+func (c *DownscalerController) SetOverride(override DownscalerOverride) error {
+	if override.Namespace == "" {
+		return fmt.Errorf("override namespace is required")
+	}
+	if override.Kind != "" && c.workloads[override.Kind] == nil {
+		return fmt.Errorf("unknown override kind %q, expected Deployment or StatefulSet", override.Kind)
+	}
+	if (override.Kind == "") != (override.Name == "") {
+		return fmt.Errorf("override kind and name must be set together")
+	}
+	if !override.Until.After(time.Now()) {
+		return fmt.Errorf("override must end in the future")
+	}
+
+	value, err := json.Marshal(override)
+	if err != nil {
+		return err
+	}
+	annotation := string(value)
+	return c.patchOverride(override, &annotation)
+}
+
+// DeleteOverride removes the override of a namespace, or of a workload when
+// kind and name are set, false if there is none.
+func (c *DownscalerController) DeleteOverride(namespace, kind, name string) (bool, error) {
+	override := DownscalerOverride{Namespace: namespace, Kind: kind, Name: name}
+	if _, ok := c.override(override); !ok {
+		return false, nil
+	}
+
+	if err := c.patchOverride(override, nil); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Overrides returns the overrides that haven't expired, sorted by namespace
+// and workload.
+func (c *DownscalerController) Overrides() []DownscalerOverride {
+	now := time.Now()
+
+	var overrides []DownscalerOverride
+	add := func(kind string, meta metav1.Object) {
+		if override, ok := overrideOf(kind, meta); ok && override.Until.After(now) {
+			overrides = append(overrides, override)
+		}
+	}
+	namespaces, err := c.namespaces.List(labels.Everything())
+	if err != nil {
+		utilruntime.HandleError(err)
+	}
+	for _, ns := range namespaces {
+		if c.options.Namespace == "" || ns.Name == c.options.Namespace {
+			add("Namespace", ns)
+		}
+	}
+	for kind, i := range c.workloads {
+		for _, obj := range i.GetIndexer().List() {
+			if meta, _ := workloadReplicas(obj); meta != nil {
+				add(kind, meta)
+			}
+		}
+	}
+	sort.Slice(overrides, func(i, j int) bool {
+		return overrides[i].key() < overrides[j].key()
+	})
+
+	return overrides
+}
+
+// override returns the override annotated on the Namespace or workload of an
+// override, expired or not, from the informer cache.
+func (c *DownscalerController) override(override DownscalerOverride) (DownscalerOverride, bool) {
+	if override.Kind == "" {
+		ns, err := c.namespaces.Get(override.Namespace)
+		if err != nil {
+			return DownscalerOverride{}, false
+		}
+		return overrideOf("Namespace", ns)
+	}
+
+	i := c.workloads[override.Kind]
+	if i == nil {
+		return DownscalerOverride{}, false
+	}
+	obj, exists, err := i.GetIndexer().GetByKey(override.Namespace + "/" + override.Name)
+	if err != nil || !exists {
+		return DownscalerOverride{}, false
+	}
+	meta, _ := workloadReplicas(obj)
+	if meta == nil {
+		return DownscalerOverride{}, false
+	}
+
+	return overrideOf(override.Kind, meta)
+}
+
+// patchOverride sets the override annotation of the Namespace or workload of
+// an override, the annotation is removed when value is nil.
+func (c *DownscalerController) patchOverride(override DownscalerOverride, value *string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]*string{OverrideAnnotation: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	switch override.Kind {
+	case "":
+		_, err = c.kubeClient.CoreV1().Namespaces().Patch(context.TODO(), override.Namespace, types.MergePatchType, patch, metav1.PatchOptions{})
+	case "Deployment":
+		_, err = c.kubeClient.AppsV1().Deployments(override.Namespace).Patch(context.TODO(), override.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	case "StatefulSet":
+		_, err = c.kubeClient.AppsV1().StatefulSets(override.Namespace).Patch(context.TODO(), override.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	}
+
+	return err
+}
+
+// resync puts every workload onto the work queue to evaluate the schedules,
+// expired overrides are ignored.
+func (c *DownscalerController) resync() {
+	for kind, i := range c.workloads {
+		for _, obj := range i.GetIndexer().List() {
+			c.enqueue(kind, obj)
+		}
+	}
+}
+
+// enqueue puts a workload onto the work queue as Kind/namespace/name.
+func (c *DownscalerController) enqueue(kind string, obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+
+	c.workqueue.Add(kind + "/" + key)
+}
+
+// enqueueNamespace puts the workloads of a namespace onto the work queue.
+func (c *DownscalerController) enqueueNamespace(namespace string) {
+	for kind, i := range c.workloads {
+		objs, err := i.GetIndexer().ByIndex(cache.NamespaceIndex, namespace)
+		if err != nil {
+			utilruntime.HandleError(err)
+			continue
+		}
+		for _, obj := range objs {
+			c.enqueue(kind, obj)
+		}
+	}
+}
+
+// workloadReplicas returns the metadata and desired replicas of a Deployment
+// or StatefulSet, nil for other objects.
+func workloadReplicas(obj interface{}) (metav1.Object, int32) {
+	var replicas *int32
+	var meta metav1.Object
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		meta, replicas = o, o.Spec.Replicas
+	case *appsv1.StatefulSet:
+		meta, replicas = o, o.Spec.Replicas
+	default:
+		return nil, 0
+	}
+	// the replicas default to one.
+	if replicas == nil {
+		return meta, 1
+	}
+
+	return meta, *replicas
+}
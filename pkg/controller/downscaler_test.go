@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// uptimeOn returns a schedule that is up all day on the weekday of now in
+// UTC, shifted by days.
+func uptimeOn(now time.Time, days int) string {
+	day := (now.UTC().Weekday() + time.Weekday(days)) % 7
+	return fmt.Sprintf("%s 00:00-24:00 UTC", day.String()[:3])
+}
+
+func TestDownscalerScalesDownAndRestoresReplicas(t *testing.T) {
+	replicas := int32(3)
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "web",
+			// the workload is only up on another day.
+			Annotations: map[string]string{UptimeAnnotation: uptimeOn(time.Now(), 3)},
+		},
+		Spec: appsv1.DeploymentSpec{Replicas: &replicas},
+	}
+	client := fake.NewSimpleClientset(deploy)
+	recorder := record.NewFakeRecorder(10)
+	c, err := NewDownscalerController(client, DownscalerOptions{Recorder: recorder})
+	if err != nil {
+		t.Fatalf("NewDownscalerController: %v", err)
+	}
+	indexer := c.workloads["Deployment"].GetIndexer()
+
+	// sync stores the deployment in the cache and syncs it, returning the
+	// deployment as patched by the controller.
+	sync := func(d *appsv1.Deployment) *appsv1.Deployment {
+		t.Helper()
+		if err := indexer.Update(d); err != nil {
+			t.Fatalf("update indexer: %v", err)
+		}
+		if err := c.syncHandler("Deployment/default/web"); err != nil {
+			t.Fatalf("syncHandler: %v", err)
+		}
+		patched, err := client.AppsV1().Deployments("default").Get(context.TODO(), "web", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get deployment: %v", err)
+		}
+		return patched
+	}
+
+	down := sync(deploy)
+	if *down.Spec.Replicas != 0 || down.Annotations[OriginalReplicasAnnotation] != "3" {
+		t.Fatalf("scaled down to %d replicas, %s = %q, want 0 and \"3\"",
+			*down.Spec.Replicas, OriginalReplicasAnnotation, down.Annotations[OriginalReplicasAnnotation])
+	}
+	if event := <-recorder.Events; event != "Normal "+ReasonScaledDown+" Scaled down from 3 replicas outside the uptime" {
+		t.Errorf("event = %q", event)
+	}
+
+	// a scaled down workload keeps its original replicas while down.
+	if again := sync(down); again.Annotations[OriginalReplicasAnnotation] != "3" {
+		t.Fatalf("%s = %q after a second sync", OriginalReplicasAnnotation, again.Annotations[OriginalReplicasAnnotation])
+	}
+
+	down.Annotations[UptimeAnnotation] = uptimeOn(time.Now(), 0)
+	up := sync(down)
+	if *up.Spec.Replicas != 3 {
+		t.Errorf("scaled up to %d replicas, want 3", *up.Spec.Replicas)
+	}
+	if value, ok := up.Annotations[OriginalReplicasAnnotation]; ok {
+		t.Errorf("%s = %q left after scaling up", OriginalReplicasAnnotation, value)
+	}
+	if event := <-recorder.Events; event != "Normal "+ReasonScaledUp+" Scaled up to 3 replicas within the uptime" {
+		t.Errorf("event = %q", event)
+	}
+}
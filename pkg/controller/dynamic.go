@@ -0,0 +1,305 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// crdResource is the resource of CustomResourceDefinitions.
+var crdResource = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1",
+	Resource: "customresourcedefinitions",
+}
+
+const (
+	// rediscoveryKey is the single key of the rediscovery queue.
+	rediscoveryKey = "rediscovery"
+	// rediscoveryDelay is the time CRD changes are batched for before
+	// discovery is reset.
+	rediscoveryDelay = 2 * time.Second
+)
+
+// dynamicResource is a resource watched with dynamic informers.
+type dynamicResource struct {
+	gvr        schema.GroupVersionResource
+	kind       string
+	namespaced bool
+}
+
+// parseResource parses a resource given as group/version/resource,
+// version/resource for the core group, or as a Kind optionally qualified by
+// its group (Kind.group). Exactly one of the returned values is set.
+func parseResource(spec string) (*schema.GroupVersionResource, *schema.GroupKind, error) {
+	spec = strings.TrimSpace(spec)
+	parts := strings.Split(spec, "/")
+	switch len(parts) {
+	case 1:
+		gk := schema.ParseGroupKind(spec)
+		if gk.Kind == "" {
+			return nil, nil, fmt.Errorf("invalid resource %q", spec)
+		}
+		return nil, &gk, nil
+	case 2:
+		return &schema.GroupVersionResource{Version: parts[0], Resource: parts[1]}, nil, nil
+	case 3:
+		return &schema.GroupVersionResource{Group: parts[0], Version: parts[1], Resource: parts[2]}, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("invalid resource %q, expected group/version/resource or Kind.group", spec)
+	}
+}
+
+// resolveResource resolves a resource spec to its resource, kind and scope
+// through discovery.
+func (c *Controller) resolveResource(spec string) (dynamicResource, error) {
+	return resolveResource(c.mapper, spec)
+}
+
+// resolveResource resolves a resource spec with a REST mapper.
+func resolveResource(mapper meta.RESTMapper, spec string) (dynamicResource, error) {
+	gvr, gk, err := parseResource(spec)
+	if err != nil {
+		return dynamicResource{}, err
+	}
+
+	var mapping *meta.RESTMapping
+	if gvr != nil {
+		gvk, err := mapper.KindFor(*gvr)
+		if err != nil {
+			return dynamicResource{}, err
+		}
+		mapping, err = mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return dynamicResource{}, err
+		}
+	} else {
+		mapping, err = mapper.RESTMapping(*gk)
+		if err != nil {
+			return dynamicResource{}, err
+		}
+	}
+
+	return dynamicResource{
+		gvr:        mapping.Resource,
+		kind:       mapping.GroupVersionKind.Kind,
+		namespaced: mapping.Scope.Name() == meta.RESTScopeNameNamespace,
+	}, nil
+}
+
+// resolvePendingResources resolves the configured resources that are not yet
+// watched, resources of CRDs that are not installed yet stay pending.
+func (c *Controller) resolvePendingResources() {
+	c.mu.Lock()
+	pending := c.pendingResources
+	c.pendingResources = nil
+	c.mu.Unlock()
+
+	var unresolved []string
+	for _, spec := range pending {
+		resource, err := c.resolveResource(spec)
+		if err != nil {
+			klog.Warningf("Resource %q is not available yet: %v", spec, err)
+			unresolved = append(unresolved, spec)
+			continue
+		}
+		c.watchResource(resource)
+		c.mu.Lock()
+		c.configuredResources[resource.gvr] = spec
+		c.mu.Unlock()
+	}
+
+	c.mu.Lock()
+	c.pendingResources = append(c.pendingResources, unresolved...)
+	c.mu.Unlock()
+}
+
+// watchResource starts dynamic informers for a resource, in every watched
+// namespace for namespaced resources or cluster wide otherwise.
+func (c *Controller) watchResource(resource dynamicResource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.dynamicResources[resource.gvr] = resource
+	if !resource.namespaced {
+		c.clusterDynamic.Watch(resource.gvr, resource.kind)
+		return
+	}
+	for _, s := range c.scopes {
+		s.dynamic.Watch(resource.gvr, resource.kind)
+	}
+}
+
+// unwatchResource stops the dynamic informers of every version of a
+// resource, the configured resources among them are pending again.
+func (c *Controller) unwatchResource(gr schema.GroupResource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for gvr := range c.dynamicResources {
+		if gvr.GroupResource() != gr {
+			continue
+		}
+		delete(c.dynamicResources, gvr)
+		c.clusterDynamic.Unwatch(gvr)
+		for _, s := range c.scopes {
+			s.dynamic.Unwatch(gvr)
+		}
+		if spec, ok := c.configuredResources[gvr]; ok {
+			delete(c.configuredResources, gvr)
+			c.pendingResources = append(c.pendingResources, spec)
+		}
+	}
+}
+
+// watchCustomResourceDefinitions watches CRDs so custom resources of the
+// configured groups, and configured resources whose CRD was missing, are
+// watched as soon as their CRD is installed.
+func (c *Controller) watchCustomResourceDefinitions(stopCh <-chan struct{}) error {
+	informer := dynamicinformer.NewFilteredDynamicInformer(c.dynamicClient, crdResource, metav1.NamespaceAll, 0, cache.Indexers{}, nil).Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			c.onCustomResourceDefinition(obj)
+		},
+		UpdateFunc: c.onCustomResourceDefinitionUpdate,
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			crd, ok := obj.(*unstructured.Unstructured)
+			if !ok {
+				runtime.HandleError(fmt.Errorf("expected unstructured CRD but got %#v", obj))
+				return
+			}
+			if resource, ok := customResource(crd); ok {
+				c.unwatchResource(resource.gvr.GroupResource())
+			}
+		},
+	})
+
+	go func() {
+		<-stopCh
+		c.rediscovery.ShutDown()
+	}()
+	go wait.Until(c.runRediscoveryWorker, time.Second, stopCh)
+
+	go informer.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+		return fmt.Errorf("timed out waiting for CRD caches to sync")
+	}
+
+	return nil
+}
+
+func (c *Controller) runRediscoveryWorker() {
+	for c.processNextRediscovery() {
+	}
+}
+
+// processNextRediscovery resets discovery, which is cached, and resolves the
+// pending resources whose CRD may now be installed.
+func (c *Controller) processNextRediscovery() bool {
+	obj, shutdown := c.rediscovery.Get()
+	if shutdown {
+		return false
+	}
+	defer c.rediscovery.Done(obj)
+
+	c.mapper.Reset()
+	c.resolvePendingResources()
+
+	return true
+}
+
+func (c *Controller) onCustomResourceDefinition(obj interface{}) {
+	crd, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		runtime.HandleError(fmt.Errorf("expected unstructured CRD but got %#v", obj))
+		return
+	}
+
+	// the CRDs installed together, e.g. by a chart, are rediscovered once.
+	c.mu.Lock()
+	pending := len(c.pendingResources) > 0
+	c.mu.Unlock()
+	if pending {
+		c.rediscovery.AddAfter(rediscoveryKey, rediscoveryDelay)
+	}
+
+	resource, ok := customResource(crd)
+	if !ok || !c.watchesCustomResourceGroup(resource.gvr.Group) {
+		return
+	}
+	c.watchResource(resource)
+}
+
+// onCustomResourceDefinitionUpdate stops the informers of a custom resource
+// whose served or storage version changed. The configured resources among
+// them are resolved again, the watched groups watch the new version.
+func (c *Controller) onCustomResourceDefinitionUpdate(old, new interface{}) {
+	oldCRD, oldOK := old.(*unstructured.Unstructured)
+	newCRD, newOK := new.(*unstructured.Unstructured)
+	if oldOK && newOK {
+		previous, ok := customResource(oldCRD)
+		current, _ := customResource(newCRD)
+		if ok && previous.gvr != current.gvr {
+			klog.Infof("Custom resource %s is no longer served as %s", previous.gvr.GroupResource(), previous.gvr.Version)
+			c.unwatchResource(previous.gvr.GroupResource())
+		}
+	}
+
+	c.onCustomResourceDefinition(new)
+}
+
+func (c *Controller) watchesCustomResourceGroup(group string) bool {
+	for _, g := range c.options.CustomResourceGroups {
+		if g == "*" || g == group {
+			return true
+		}
+	}
+
+	return false
+}
+
+// customResource returns the resource of the storage version of a CRD.
+func customResource(crd *unstructured.Unstructured) (dynamicResource, bool) {
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+	plural, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "plural")
+	scope, _, _ := unstructured.NestedString(crd.Object, "spec", "scope")
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+
+	version := ""
+	for _, v := range versions {
+		v, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(v, "name")
+		served, _, _ := unstructured.NestedBool(v, "served")
+		storage, _, _ := unstructured.NestedBool(v, "storage")
+		if served && (storage || version == "") {
+			version = name
+		}
+	}
+	if group == "" || plural == "" || version == "" {
+		return dynamicResource{}, false
+	}
+
+	return dynamicResource{
+		gvr:        schema.GroupVersionResource{Group: group, Version: version, Resource: plural},
+		kind:       kind,
+		namespaced: scope == "Namespaced",
+	}, true
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+// testCRD returns the cluster scoped Widget CRD of example.com served and
+// stored as version.
+func testCRD(version string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata":   map[string]interface{}{"name": "widgets.example.com"},
+		"spec": map[string]interface{}{
+			"group": "example.com",
+			"scope": "Cluster",
+			"names": map[string]interface{}{"kind": "Widget", "plural": "widgets"},
+			"versions": []interface{}{
+				map[string]interface{}{"name": version, "served": true, "storage": true},
+			},
+		},
+	}}
+}
+
+func TestControllerUnwatchesPreviousCustomResourceVersion(t *testing.T) {
+	c, err := NewController(fake.NewSimpleClientset(), Options{
+		CustomResourceGroups: []string{"example.com"},
+		DynamicClient:        dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()),
+		Recorder:             record.NewFakeRecorder(10),
+	})
+	if err != nil {
+		t.Fatalf("NewController: %v", err)
+	}
+	defer c.rediscovery.ShutDown()
+
+	v1 := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	v2 := schema.GroupVersionResource{Group: "example.com", Version: "v2", Resource: "widgets"}
+	c.onCustomResourceDefinition(testCRD("v1"))
+	// the resource is configured too, as Widget.example.com.
+	c.mu.Lock()
+	c.configuredResources[v1] = "Widget.example.com"
+	c.mu.Unlock()
+
+	c.onCustomResourceDefinitionUpdate(testCRD("v1"), testCRD("v2"))
+	defer c.clusterDynamic.Unwatch(v2)
+
+	c.mu.Lock()
+	_, watchesV1 := c.dynamicResources[v1]
+	_, watchesV2 := c.dynamicResources[v2]
+	pending := append([]string(nil), c.pendingResources...)
+	c.mu.Unlock()
+	if watchesV1 || !watchesV2 {
+		t.Errorf("watches v1 = %v, v2 = %v, want v2 only", watchesV1, watchesV2)
+	}
+	if _, err := c.clusterDynamic.Informer(v1); err == nil {
+		t.Error("the informer of v1 is still running")
+	}
+	if len(pending) != 1 || pending[0] != "Widget.example.com" {
+		t.Errorf("pending resources = %q, want the configured resource resolved again", pending)
+	}
+
+	// a resync of the CRD doesn't restart its informer.
+	informer, err := c.clusterDynamic.Informer(v2)
+	if err != nil {
+		t.Fatalf("informer of v2: %v", err)
+	}
+	c.onCustomResourceDefinitionUpdate(testCRD("v2"), testCRD("v2"))
+	if again, err := c.clusterDynamic.Informer(v2); err != nil || again != informer {
+		t.Errorf("informer of v2 restarted by a resync: %v", err)
+	}
+}
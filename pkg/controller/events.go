@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+
+	corev1 "k8s.io/api/core/v1"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// EventOptions configures the recording of Kubernetes Events.
+type EventOptions struct {
+	// Component is the source component of the recorded Events.
+	Component string
+
+	// BurstSize and QPS configure the per object token bucket of the spam
+	// filter, events over the limit are dropped.
+	BurstSize int
+	QPS       float32
+	// MaxEvents similar events within MaxIntervalInSeconds are aggregated
+	// into a single Event.
+	MaxEvents            int
+	MaxIntervalInSeconds int
+}
+
+// NewEventRecorder creates a recorder that writes Events to the API server
+// and logs them, the returned broadcaster must be shut down when done. Zero
+// options use the client-go defaults.
+func NewEventRecorder(kubeClient kubernetes.Interface, options EventOptions) (record.EventRecorder, record.EventBroadcaster) {
+	broadcaster := record.NewBroadcasterWithCorrelatorOptions(record.CorrelatorOptions{
+		BurstSize:            options.BurstSize,
+		QPS:                  options.QPS,
+		MaxEvents:            options.MaxEvents,
+		MaxIntervalInSeconds: options.MaxIntervalInSeconds,
+	})
+	broadcaster.StartLogging(klog.Infof)
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: options.Component})
+
+	return recorder, broadcaster
+}
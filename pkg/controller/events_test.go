@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// eventClient is a fake clientset recording the Events created, the fake
+// rejects the Events created through the namespace-less sink otherwise.
+func eventClient() (*fake.Clientset, func() []corev1.Event) {
+	var mu sync.Mutex
+	var events []corev1.Event
+
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		event := action.(k8stesting.CreateAction).GetObject().(*corev1.Event)
+		mu.Lock()
+		events = append(events, *event)
+		mu.Unlock()
+		return true, event, nil
+	})
+
+	return client, func() []corev1.Event {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]corev1.Event(nil), events...)
+	}
+}
+
+// waitForEvents waits for want Events to be created and returns them, once
+// the Events over want had the time to be created too.
+func waitForEvents(t *testing.T, created func() []corev1.Event, want int) []corev1.Event {
+	t.Helper()
+
+	err := wait.Poll(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return len(created()) >= want, nil
+	})
+	if err != nil {
+		t.Fatalf("events = %d, want %d", len(created()), want)
+	}
+	time.Sleep(100 * time.Millisecond)
+	events := created()
+	if len(events) != want {
+		t.Fatalf("events = %d, want %d", len(events), want)
+	}
+
+	return events
+}
+
+func TestEventRecorderWritesEventsOfComponent(t *testing.T) {
+	client, created := eventClient()
+	recorder, broadcaster := NewEventRecorder(client, EventOptions{Component: "informer-test"})
+	defer broadcaster.Shutdown()
+
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "job-1", UID: "uid-job-1"}}
+	recorder.Eventf(pod, corev1.EventTypeWarning, "PodFailed", "Pod failed: %s", "Error")
+
+	event := waitForEvents(t, created, 1)[0]
+	if event.Source.Component != "informer-test" {
+		t.Errorf("source component = %q", event.Source.Component)
+	}
+	if event.Type != corev1.EventTypeWarning || event.Reason != "PodFailed" || event.Message != "Pod failed: Error" {
+		t.Errorf("event = %s %s %q", event.Type, event.Reason, event.Message)
+	}
+	if event.InvolvedObject.Kind != "Pod" || event.InvolvedObject.Name != "job-1" || event.InvolvedObject.UID != "uid-job-1" {
+		t.Errorf("involved object = %+v", event.InvolvedObject)
+	}
+}
+
+func TestEventRecorderDropsSpam(t *testing.T) {
+	client, created := eventClient()
+	// a burst of 2 events per object, refilled far slower than the test.
+	recorder, broadcaster := NewEventRecorder(client, EventOptions{Component: "informer-test", BurstSize: 2, QPS: 0.001})
+	defer broadcaster.Shutdown()
+
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-1", UID: "uid-web-1"}}
+	for _, reason := range []string{"First", "Second", "Third", "Fourth"} {
+		recorder.Event(pod, corev1.EventTypeNormal, reason, reason)
+	}
+
+	reasons := make(map[string]bool)
+	for _, event := range waitForEvents(t, created, 2) {
+		reasons[event.Reason] = true
+	}
+	if !reasons["First"] || !reasons["Second"] {
+		t.Errorf("reasons = %v, want the first two", reasons)
+	}
+}
@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NamespaceTemplatesConfig is the file the namespace templates are loaded
+// from.
+type NamespaceTemplatesConfig struct {
+	// ExcludeNamespaces are never provisioned.
+	ExcludeNamespaces []string                  `json:"excludeNamespaces,omitempty"`
+	Templates         []NamespaceTemplateConfig `json:"templates"`
+}
+
+// NamespaceTemplateConfig is a set of manifests applied to the namespaces
+// matching its selector.
+type NamespaceTemplateConfig struct {
+	Name string `json:"name"`
+	// NamespaceSelector is a label selector of the namespaces provisioned,
+	// every namespace is provisioned when empty.
+	NamespaceSelector string `json:"namespaceSelector,omitempty"`
+	// Manifests is a text/template of one or more YAML documents of
+	// namespaced objects, executed with a NamespaceTemplateData. The objects
+	// are applied to the namespace whatever namespace they are given.
+	Manifests string `json:"manifests"`
+}
+
+// NamespaceTemplateData is the data the manifests are executed with.
+type NamespaceTemplateData struct {
+	Name        string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// namespaceTemplate is a compiled NamespaceTemplateConfig.
+type namespaceTemplate struct {
+	name      string
+	selector  labels.Selector
+	manifests *template.Template
+}
+
+// namespaceTemplateFuncs are the functions available to the manifests.
+var namespaceTemplateFuncs = template.FuncMap{
+	// default returns def if value is empty, e.g.
+	// {{ index .Labels "team" | default "platform" }}.
+	"default": func(def, value string) string {
+		if value == "" {
+			return def
+		}
+		return value
+	},
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"quote": strconv.Quote,
+}
+
+// LoadNamespaceTemplates reads and validates a YAML or JSON
+// NamespaceTemplatesConfig file.
+func LoadNamespaceTemplates(path string) (NamespaceTemplatesConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return NamespaceTemplatesConfig{}, fmt.Errorf("failed to read namespace templates %s: %v", path, err)
+	}
+	var config NamespaceTemplatesConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return NamespaceTemplatesConfig{}, fmt.Errorf("failed to parse namespace templates %s: %v", path, err)
+	}
+	if _, err := compileNamespaceTemplates(config); err != nil {
+		return NamespaceTemplatesConfig{}, fmt.Errorf("invalid namespace templates %s: %v", path, err)
+	}
+
+	return config, nil
+}
+
+func compileNamespaceTemplates(config NamespaceTemplatesConfig) ([]namespaceTemplate, error) {
+	if len(config.Templates) == 0 {
+		return nil, fmt.Errorf("no templates configured")
+	}
+
+	var templates []namespaceTemplate
+	names := make(map[string]bool)
+	for _, c := range config.Templates {
+		// the name labels the applied objects.
+		if errs := validation.IsValidLabelValue(c.Name); c.Name == "" || len(errs) > 0 {
+			return nil, fmt.Errorf("invalid template name %q: %s", c.Name, strings.Join(errs, ", "))
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("duplicate template %q", c.Name)
+		}
+		names[c.Name] = true
+
+		selector, err := labels.Parse(c.NamespaceSelector)
+		if err != nil {
+			return nil, fmt.Errorf("template %q: invalid namespace selector %q: %v", c.Name, c.NamespaceSelector, err)
+		}
+		manifests, err := template.New(c.Name).Funcs(namespaceTemplateFuncs).Option("missingkey=zero").Parse(c.Manifests)
+		if err != nil {
+			return nil, fmt.Errorf("template %q: %v", c.Name, err)
+		}
+		templates = append(templates, namespaceTemplate{name: c.Name, selector: selector, manifests: manifests})
+	}
+
+	return templates, nil
+}
+
+// render executes the manifests for a namespace and decodes the objects.
+func (t namespaceTemplate) render(ns *corev1.Namespace) ([]*unstructured.Unstructured, error) {
+	var buf bytes.Buffer
+	data := NamespaceTemplateData{Name: ns.Name, Labels: ns.Labels, Annotations: ns.Annotations}
+	if err := t.manifests.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("template %q: %v", t.name, err)
+	}
+
+	var objs []*unstructured.Unstructured
+	decoder := utilyaml.NewYAMLOrJSONDecoder(&buf, 4096)
+	for {
+		u := &unstructured.Unstructured{}
+		if err := decoder.Decode(&u.Object); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("template %q: %v", t.name, err)
+		}
+		// an empty document, e.g. one rendered away by a condition.
+		if len(u.Object) == 0 {
+			continue
+		}
+		if u.GetAPIVersion() == "" || u.GetKind() == "" || u.GetName() == "" {
+			return nil, fmt.Errorf("template %q: apiVersion, kind and metadata.name are required", t.name)
+		}
+		objs = append(objs, u)
+	}
+
+	return objs, nil
+}
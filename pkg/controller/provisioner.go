@@ -0,0 +1,432 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	"github.com/lqshow/access-kubernetes-cluster/pkg/metrics"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+)
+
+const (
+	// ProvisionedByLabel is the name of the template an applied object comes
+	// from.
+	ProvisionedByLabel = "informer.lqshow.io/provisioned-by"
+	// ProvisioningStatusAnnotation is Provisioned or Failed on a provisioned
+	// namespace, ProvisioningMessageAnnotation details the status.
+	ProvisioningStatusAnnotation  = "informer.lqshow.io/provisioning-status"
+	ProvisioningMessageAnnotation = "informer.lqshow.io/provisioning-message"
+
+	// ProvisioningProvisioned and ProvisioningFailed are the provisioning
+	// statuses, also the Event reasons of the namespaces changing to them.
+	ProvisioningProvisioned = "Provisioned"
+	ProvisioningFailed      = "ProvisioningFailed"
+
+	// defaultFieldManager owns the fields of the applied objects.
+	defaultFieldManager = "informer-provisioner"
+)
+
+// ProvisionerOptions configures the namespace provisioner.
+type ProvisionerOptions struct {
+	Config NamespaceTemplatesConfig
+	// FieldManager is the server-side apply field manager, defaults to
+	// informer-provisioner.
+	FieldManager string
+	// ResyncPeriod re-applies the templates to every namespace, 10 minutes
+	// by default. Changes of the applied objects are re-applied as they are
+	// observed.
+	ResyncPeriod time.Duration
+	// Recorder records Kubernetes Events on the provisioned namespaces.
+	Recorder record.EventRecorder
+}
+
+// ProvisionerController applies the manifests of the namespace templates to
+// the namespaces they select with server-side apply, and re-applies them when
+// the applied objects drift.
+type ProvisionerController struct {
+	kubeClient    kubernetes.Interface
+	dynamicClient dynamic.Interface
+	mapper        *restmapper.DeferredDiscoveryRESTMapper
+	options       ProvisionerOptions
+	templates     []namespaceTemplate
+	excluded      map[string]bool
+
+	factory    informers.SharedInformerFactory
+	namespaces corelisters.NamespaceLister
+	// workqueue holds namespace names.
+	workqueue workqueue.RateLimitingInterface
+
+	mu sync.Mutex
+	// drift watches the applied objects by their ProvisionedByLabel, a
+	// resource is watched once objects of it are applied.
+	drift   dynamicinformer.DynamicSharedInformerFactory
+	watched map[schema.GroupVersionResource]bool
+	stopCh  <-chan struct{}
+}
+
+func NewProvisionerController(kubeClient kubernetes.Interface, dynamicClient dynamic.Interface, options ProvisionerOptions) (*ProvisionerController, error) {
+	if options.Recorder == nil {
+		return nil, fmt.Errorf("an event recorder is required")
+	}
+	templates, err := compileNamespaceTemplates(options.Config)
+	if err != nil {
+		return nil, err
+	}
+	if options.FieldManager == "" {
+		options.FieldManager = defaultFieldManager
+	}
+	if options.ResyncPeriod <= 0 {
+		options.ResyncPeriod = 10 * time.Minute
+	}
+
+	factory := informers.NewSharedInformerFactory(kubeClient, 0)
+	c := &ProvisionerController{
+		kubeClient:    kubeClient,
+		dynamicClient: dynamicClient,
+		mapper:        restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(kubeClient.Discovery())),
+		options:       options,
+		templates:     templates,
+		excluded:      make(map[string]bool),
+		factory:       factory,
+		namespaces:    factory.Core().V1().Namespaces().Lister(),
+		workqueue:     workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "provisioner"),
+		drift: dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, 0, metav1.NamespaceAll, func(o *metav1.ListOptions) {
+			o.LabelSelector = ProvisionedByLabel
+		}),
+		watched: make(map[schema.GroupVersionResource]bool),
+	}
+	for _, namespace := range options.Config.ExcludeNamespaces {
+		c.excluded[namespace] = true
+	}
+
+	factory.Core().V1().Namespaces().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueue,
+		UpdateFunc: func(old, new interface{}) {
+			// the status annotations the provisioner sets don't change the
+			// outcome.
+			if namespaceChanged(old.(*corev1.Namespace), new.(*corev1.Namespace)) {
+				c.enqueue(new)
+			}
+		},
+	})
+
+	return c, nil
+}
+
+// Run starts the informers and workers, re-applies the templates every
+// resync period and blocks until stopCh is closed.
+func (c *ProvisionerController) Run(threadiness int, stopCh <-chan struct{}) error {
+	defer utilruntime.HandleCrash()
+	defer c.workqueue.ShutDown()
+
+	c.mu.Lock()
+	c.stopCh = stopCh
+	c.mu.Unlock()
+
+	c.factory.Start(stopCh)
+	klog.Info("Waiting for provisioner informer caches to sync.")
+	if !cache.WaitForCacheSync(stopCh, c.factory.Core().V1().Namespaces().Informer().HasSynced) {
+		return fmt.Errorf("timed out waiting for caches to sync")
+	}
+
+	for i := 0; i < threadiness; i++ {
+		go wait.Until(c.runWorker, time.Second, stopCh)
+	}
+	go wait.Until(c.resync, c.options.ResyncPeriod, stopCh)
+
+	<-stopCh
+	klog.Info("Shutting down provisioner workers")
+	return nil
+}
+
+func (c *ProvisionerController) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *ProvisionerController) processNextWorkItem() bool {
+	obj, shutdown := c.workqueue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.workqueue.Done(obj)
+
+	key, ok := obj.(string)
+	if !ok {
+		c.workqueue.Forget(obj)
+		utilruntime.HandleError(fmt.Errorf("expected string in workqueue but got %#v", obj))
+		return true
+	}
+
+	err := c.syncHandler(key)
+	metrics.ObserveReconcile("provisioner", err)
+	if err != nil {
+		c.workqueue.AddRateLimited(key)
+		utilruntime.HandleError(fmt.Errorf("error provisioning namespace '%s': %s", key, err.Error()))
+		return true
+	}
+	c.workqueue.Forget(obj)
+
+	return true
+}
+
+// syncHandler applies the templates selecting a namespace and reports the
+// outcome on the namespace.
+func (c *ProvisionerController) syncHandler(name string) error {
+	ns, err := c.namespaces.Get(name)
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if ns.DeletionTimestamp != nil || ns.Status.Phase == corev1.NamespaceTerminating || c.excluded[name] {
+		return nil
+	}
+
+	var applied []string
+	var errs []string
+	objects := 0
+	for _, t := range c.templates {
+		if !t.selector.Matches(labels.Set(ns.Labels)) {
+			continue
+		}
+		n, err := c.apply(t, ns)
+		objects += n
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		applied = append(applied, t.name)
+	}
+	if len(applied) == 0 && len(errs) == 0 {
+		return nil
+	}
+
+	status, message := ProvisioningProvisioned, fmt.Sprintf("Applied templates %s, %d objects", strings.Join(applied, ", "), objects)
+	if len(errs) > 0 {
+		status, message = ProvisioningFailed, strings.Join(errs, "; ")
+	}
+	if err := c.setStatus(ns, status, message); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", message)
+	}
+
+	return nil
+}
+
+// apply renders a template for a namespace and applies its objects, it
+// returns the number of objects applied.
+func (c *ProvisionerController) apply(t namespaceTemplate, ns *corev1.Namespace) (int, error) {
+	objs, err := t.render(ns)
+	if err != nil {
+		return 0, err
+	}
+
+	force := true
+	for i, u := range objs {
+		gvr, err := c.namespacedResource(u.GroupVersionKind())
+		if err != nil {
+			return i, fmt.Errorf("template %q: %s %s: %v", t.name, u.GetKind(), u.GetName(), err)
+		}
+		u.SetNamespace(ns.Name)
+		objLabels := u.GetLabels()
+		if objLabels == nil {
+			objLabels = make(map[string]string)
+		}
+		objLabels[ProvisionedByLabel] = t.name
+		u.SetLabels(objLabels)
+
+		data, err := json.Marshal(u)
+		if err != nil {
+			return i, err
+		}
+		_, err = c.dynamicClient.Resource(gvr).Namespace(ns.Name).Patch(context.TODO(), u.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
+			FieldManager: c.options.FieldManager,
+			Force:        &force,
+		})
+		if err != nil {
+			return i, fmt.Errorf("template %q: failed to apply %s %s: %v", t.name, u.GetKind(), u.GetName(), err)
+		}
+		c.watchDrift(gvr)
+	}
+
+	return len(objs), nil
+}
+
+// namespacedResource maps the kind of a manifest to its resource, the
+// discovery is refreshed once for kinds it doesn't know.
+func (c *ProvisionerController) namespacedResource(gvk schema.GroupVersionKind) (schema.GroupVersionResource, error) {
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		c.mapper.Reset()
+		mapping, err = c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+	if err != nil {
+		return schema.GroupVersionResource{}, err
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return schema.GroupVersionResource{}, fmt.Errorf("cluster-scoped kinds can't be provisioned")
+	}
+
+	return mapping.Resource, nil
+}
+
+// setStatus patches the provisioning status annotations of a namespace when
+// they change and records an Event for the new status.
+func (c *ProvisionerController) setStatus(ns *corev1.Namespace, status, message string) error {
+	if ns.Annotations[ProvisioningStatusAnnotation] == status && ns.Annotations[ProvisioningMessageAnnotation] == message {
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				ProvisioningStatusAnnotation:  status,
+				ProvisioningMessageAnnotation: message,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.kubeClient.CoreV1().Namespaces().Patch(context.TODO(), ns.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if status == ProvisioningFailed {
+		klog.Warningf("Failed to provision namespace %s: %s", ns.Name, message)
+		c.options.Recorder.Event(ns, corev1.EventTypeWarning, ProvisioningFailed, message)
+	} else if ns.Annotations[ProvisioningStatusAnnotation] != status {
+		klog.Infof("Provisioned namespace %s: %s", ns.Name, message)
+		c.options.Recorder.Event(ns, corev1.EventTypeNormal, ProvisioningProvisioned, message)
+	}
+
+	return nil
+}
+
+// watchDrift starts watching the applied objects of a resource, their
+// changes and deletions re-provision their namespace.
+func (c *ProvisionerController) watchDrift(gvr schema.GroupVersionResource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.watched[gvr] || c.stopCh == nil {
+		return
+	}
+	c.watched[gvr] = true
+
+	c.drift.ForResource(gvr).Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(old, new interface{}) {
+			if drifted(old.(*unstructured.Unstructured), new.(*unstructured.Unstructured)) {
+				c.enqueueNamespaceOf(new)
+			}
+		},
+		DeleteFunc: c.enqueueNamespaceOf,
+	})
+	c.drift.Start(c.stopCh)
+	klog.Infof("Watching provisioned %s for drift", gvr.String())
+}
+
+// resync puts every namespace onto the work queue.
+func (c *ProvisionerController) resync() {
+	namespaces, err := c.namespaces.List(labels.Everything())
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	for _, ns := range namespaces {
+		c.workqueue.Add(ns.Name)
+	}
+}
+
+func (c *ProvisionerController) enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+
+	c.workqueue.Add(key)
+}
+
+// enqueueNamespaceOf puts the namespace of an applied object onto the work
+// queue.
+func (c *ProvisionerController) enqueueNamespaceOf(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	o, ok := obj.(metav1.Object)
+	if !ok {
+		return
+	}
+
+	klog.V(2).Infof("Provisioned %s/%s changed, re-applying", o.GetNamespace(), o.GetName())
+	c.workqueue.Add(o.GetNamespace())
+}
+
+// namespaceChanged returns whether the labels or annotations of a namespace
+// changed other than the provisioning status annotations.
+func namespaceChanged(old, new *corev1.Namespace) bool {
+	if !reflect.DeepEqual(old.Labels, new.Labels) {
+		return true
+	}
+	for _, annotations := range []map[string]string{old.Annotations, new.Annotations} {
+		for key := range annotations {
+			if key == ProvisioningStatusAnnotation || key == ProvisioningMessageAnnotation {
+				continue
+			}
+			if old.Annotations[key] != new.Annotations[key] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// drifted returns whether an applied object changed, ignoring its status
+// and the metadata maintained by the API server, e.g. the used resources of
+// a ResourceQuota.
+func drifted(old, new *unstructured.Unstructured) bool {
+	strip := func(u *unstructured.Unstructured) map[string]interface{} {
+		obj := u.DeepCopy().Object
+		delete(obj, "status")
+		for _, field := range []string{"managedFields", "resourceVersion", "generation"} {
+			unstructured.RemoveNestedField(obj, "metadata", field)
+		}
+		return obj
+	}
+
+	return !reflect.DeepEqual(strip(old), strip(new))
+}
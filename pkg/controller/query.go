@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/lqshow/access-kubernetes-cluster/pkg/informer"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// QueryPods returns the pods of every watched namespace matching the query,
+// in namespace/name order. The objects are shared with the informer caches
+// and must not be modified.
+func (c *Controller) QueryPods(query informer.IndexQuery) ([]*corev1.Pod, error) {
+	objects, err := c.query("Pod", query, func(s *scope) cache.Indexer { return s.pods.Indexer() })
+	if err != nil {
+		return nil, err
+	}
+
+	pods := make([]*corev1.Pod, 0, len(objects))
+	for _, obj := range objects {
+		pods = append(pods, obj.(*corev1.Pod))
+	}
+
+	return pods, nil
+}
+
+// QueryDeployments returns the deployments of every watched namespace
+// matching the query, in namespace/name order. The objects are shared with
+// the informer caches and must not be modified.
+func (c *Controller) QueryDeployments(query informer.IndexQuery) ([]*appsv1.Deployment, error) {
+	objects, err := c.query("Deployment", query, func(s *scope) cache.Indexer { return s.deployments.Indexer() })
+	if err != nil {
+		return nil, err
+	}
+
+	deployments := make([]*appsv1.Deployment, 0, len(objects))
+	for _, obj := range objects {
+		deployments = append(deployments, obj.(*appsv1.Deployment))
+	}
+
+	return deployments, nil
+}
+
+// query runs a query against an indexer of every scope, objects of
+// overlapping scopes are returned once. The snapshot of the kind is queried
+// instead until the informers have synchronized.
+func (c *Controller) query(kind string, query informer.IndexQuery, indexer func(s *scope) cache.Indexer) ([]interface{}, error) {
+	var indexers []cache.Indexer
+	if warm, ok := c.warmIndexer(kind); ok {
+		indexers = append(indexers, warm)
+	} else {
+		c.mu.Lock()
+		for _, s := range c.scopes {
+			indexers = append(indexers, indexer(s))
+		}
+		c.mu.Unlock()
+	}
+
+	objects := make(map[string]interface{})
+	for _, i := range indexers {
+		keys, err := query.Query(i)
+		if err != nil {
+			return nil, fmt.Errorf("invalid query: %v", err)
+		}
+		for _, key := range keys {
+			obj, exists, err := i.GetByKey(key)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				objects[key] = obj
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, objects[key])
+	}
+
+	return result, nil
+}
@@ -0,0 +1,440 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	"github.com/lqshow/access-kubernetes-cluster/pkg/metrics"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+)
+
+const (
+	// ReloadAnnotation set to "true" on a Deployment, StatefulSet or
+	// DaemonSet opts it in to rolling restarts when the ConfigMaps or
+	// Secrets it references change.
+	ReloadAnnotation = "informer.lqshow.io/reload"
+	// ConfigHashAnnotation holds the hash of the content of the ConfigMaps
+	// and Secrets a workload references. The first hash is recorded on the
+	// workload only, later hashes on its pod template as well, which rolls
+	// the pods.
+	ConfigHashAnnotation = "informer.lqshow.io/config-hash"
+	// ReasonReloaded is the Event reason of a workload restarted for a
+	// configuration change.
+	ReasonReloaded = "Reloaded"
+
+	// configRefIndex indexes opted-in workloads by the ConfigMaps and
+	// Secrets they reference, as Kind/namespace/name.
+	configRefIndex = "configRef"
+)
+
+// ReloaderOptions configures the reloader controller.
+type ReloaderOptions struct {
+	// Namespace restricts the reloader to a namespace, every namespace is
+	// watched when empty.
+	Namespace string
+	// Recorder records Kubernetes Events on the restarted workloads.
+	Recorder record.EventRecorder
+}
+
+// ReloaderController rolls the pods of opted-in workloads when the content of
+// a ConfigMap or Secret they mount or read environment variables from
+// changes.
+type ReloaderController struct {
+	kubeClient kubernetes.Interface
+	options    ReloaderOptions
+
+	factory    informers.SharedInformerFactory
+	configMaps corelisters.ConfigMapLister
+	secrets    corelisters.SecretLister
+	// workloads holds the informers of the workloads by kind.
+	workloads map[string]cache.SharedIndexInformer
+	synced    []cache.InformerSynced
+
+	// workqueue holds workloads as Kind/namespace/name.
+	workqueue workqueue.RateLimitingInterface
+}
+
+func NewReloaderController(kubeClient kubernetes.Interface, options ReloaderOptions) (*ReloaderController, error) {
+	if options.Recorder == nil {
+		return nil, fmt.Errorf("an event recorder is required")
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(kubeClient, 0, informers.WithNamespace(options.Namespace))
+	c := &ReloaderController{
+		kubeClient: kubeClient,
+		options:    options,
+		factory:    factory,
+		configMaps: factory.Core().V1().ConfigMaps().Lister(),
+		secrets:    factory.Core().V1().Secrets().Lister(),
+		workloads: map[string]cache.SharedIndexInformer{
+			"Deployment":  factory.Apps().V1().Deployments().Informer(),
+			"StatefulSet": factory.Apps().V1().StatefulSets().Informer(),
+			"DaemonSet":   factory.Apps().V1().DaemonSets().Informer(),
+		},
+		workqueue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "reloader"),
+	}
+
+	for kind, i := range c.workloads {
+		kind := kind
+		if err := i.AddIndexers(cache.Indexers{configRefIndex: configRefIndexFunc}); err != nil {
+			return nil, err
+		}
+		i.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				c.enqueue(kind, obj)
+			},
+			UpdateFunc: func(old, new interface{}) {
+				c.enqueue(kind, new)
+			},
+		})
+		c.synced = append(c.synced, i.HasSynced)
+	}
+	for kind, i := range map[string]cache.SharedIndexInformer{
+		"ConfigMap": factory.Core().V1().ConfigMaps().Informer(),
+		"Secret":    factory.Core().V1().Secrets().Informer(),
+	} {
+		kind := kind
+		i.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			// an added ConfigMap or Secret may have been missing.
+			AddFunc: func(obj interface{}) {
+				c.enqueueReferencing(kind, obj)
+			},
+			UpdateFunc: func(old, new interface{}) {
+				if old.(metav1.Object).GetResourceVersion() != new.(metav1.Object).GetResourceVersion() {
+					c.enqueueReferencing(kind, new)
+				}
+			},
+			DeleteFunc: func(obj interface{}) {
+				c.enqueueReferencing(kind, obj)
+			},
+		})
+		c.synced = append(c.synced, i.HasSynced)
+	}
+
+	return c, nil
+}
+
+// Run starts the informers and workers and blocks until stopCh is closed.
+func (c *ReloaderController) Run(threadiness int, stopCh <-chan struct{}) error {
+	defer utilruntime.HandleCrash()
+	defer c.workqueue.ShutDown()
+
+	c.factory.Start(stopCh)
+	klog.Info("Waiting for reloader informer caches to sync.")
+	if !cache.WaitForCacheSync(stopCh, c.synced...) {
+		return fmt.Errorf("timed out waiting for caches to sync")
+	}
+
+	for i := 0; i < threadiness; i++ {
+		go wait.Until(c.runWorker, time.Second, stopCh)
+	}
+
+	<-stopCh
+	klog.Info("Shutting down reloader workers")
+	return nil
+}
+
+func (c *ReloaderController) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *ReloaderController) processNextWorkItem() bool {
+	obj, shutdown := c.workqueue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.workqueue.Done(obj)
+
+	key, ok := obj.(string)
+	if !ok {
+		c.workqueue.Forget(obj)
+		utilruntime.HandleError(fmt.Errorf("expected string in workqueue but got %#v", obj))
+		return true
+	}
+
+	err := c.syncHandler(key)
+	metrics.ObserveReconcile("reloader", err)
+	if err != nil {
+		c.workqueue.AddRateLimited(key)
+		utilruntime.HandleError(fmt.Errorf("error syncing '%s': %s", key, err.Error()))
+		return true
+	}
+	c.workqueue.Forget(obj)
+
+	return true
+}
+
+// syncHandler compares the hash of the configuration a workload references
+// with the recorded one and patches the workload when it differs.
+func (c *ReloaderController) syncHandler(key string) error {
+	parts := strings.SplitN(key, "/", 2)
+	if len(parts) != 2 || c.workloads[parts[0]] == nil {
+		utilruntime.HandleError(fmt.Errorf("invalid workload key: %s", key))
+		return nil
+	}
+	kind := parts[0]
+	obj, exists, err := c.workloads[kind].GetIndexer().GetByKey(parts[1])
+	if err != nil || !exists {
+		return err
+	}
+
+	meta, template := workloadTemplate(obj)
+	if meta == nil || meta.GetAnnotations()[ReloadAnnotation] != "true" {
+		return nil
+	}
+	refs := configRefs(meta.GetNamespace(), &template.Spec)
+	hash, err := c.configHash(refs)
+	if err != nil {
+		return err
+	}
+
+	current := template.Annotations[ConfigHashAnnotation]
+	if current == "" {
+		current = meta.GetAnnotations()[ConfigHashAnnotation]
+	}
+	if current == hash {
+		return nil
+	}
+
+	annotations := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{ConfigHashAnnotation: hash},
+		},
+	}
+	if current != "" {
+		annotations["spec"] = map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{ConfigHashAnnotation: hash},
+				},
+			},
+		}
+	}
+	patch, err := json.Marshal(annotations)
+	if err != nil {
+		return err
+	}
+	if err := c.patch(kind, meta.GetNamespace(), meta.GetName(), patch); err != nil {
+		return err
+	}
+
+	if current == "" {
+		klog.Infof("Recorded the configuration hash of %s %s/%s", kind, meta.GetNamespace(), meta.GetName())
+		return nil
+	}
+	klog.Infof("Restarting %s %s/%s, the configuration changed", kind, meta.GetNamespace(), meta.GetName())
+	c.options.Recorder.Eventf(obj.(runtime.Object), corev1.EventTypeNormal, ReasonReloaded,
+		"Rolling restart for a configuration change, references %s", strings.Join(refs, ", "))
+	return nil
+}
+
+func (c *ReloaderController) patch(kind, namespace, name string, patch []byte) error {
+	var err error
+	switch kind {
+	case "Deployment":
+		_, err = c.kubeClient.AppsV1().Deployments(namespace).Patch(context.TODO(), name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	case "StatefulSet":
+		_, err = c.kubeClient.AppsV1().StatefulSets(namespace).Patch(context.TODO(), name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	case "DaemonSet":
+		_, err = c.kubeClient.AppsV1().DaemonSets(namespace).Patch(context.TODO(), name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	}
+	if errors.IsNotFound(err) {
+		return nil
+	}
+
+	return err
+}
+
+// configHash hashes the content of the referenced ConfigMaps and Secrets,
+// missing ones are hashed as such.
+func (c *ReloaderController) configHash(refs []string) (string, error) {
+	h := sha256.New()
+	for _, ref := range refs {
+		parts := strings.SplitN(ref, "/", 3)
+		fmt.Fprintf(h, "%s\x00", ref)
+
+		var err error
+		switch parts[0] {
+		case "ConfigMap":
+			var cm *corev1.ConfigMap
+			if cm, err = c.configMaps.ConfigMaps(parts[1]).Get(parts[2]); err == nil {
+				// keys are unique across data and binaryData.
+				data := make(map[string][]byte, len(cm.Data)+len(cm.BinaryData))
+				for key, value := range cm.Data {
+					data[key] = []byte(value)
+				}
+				for key, value := range cm.BinaryData {
+					data[key] = value
+				}
+				hashData(h, data)
+			}
+		case "Secret":
+			var secret *corev1.Secret
+			if secret, err = c.secrets.Secrets(parts[1]).Get(parts[2]); err == nil {
+				hashData(h, secret.Data)
+			}
+		}
+		if errors.IsNotFound(err) {
+			h.Write([]byte("missing\x00"))
+		} else if err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// enqueue puts a workload onto the work queue as Kind/namespace/name.
+func (c *ReloaderController) enqueue(kind string, obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+
+	c.workqueue.Add(kind + "/" + key)
+}
+
+// enqueueReferencing puts the workloads referencing a ConfigMap or Secret
+// onto the work queue.
+func (c *ReloaderController) enqueueReferencing(kind string, obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+
+	for workloadKind, i := range c.workloads {
+		objs, err := i.GetIndexer().ByIndex(configRefIndex, kind+"/"+key)
+		if err != nil {
+			utilruntime.HandleError(err)
+			continue
+		}
+		for _, o := range objs {
+			c.enqueue(workloadKind, o)
+		}
+	}
+}
+
+func configRefIndexFunc(obj interface{}) ([]string, error) {
+	meta, template := workloadTemplate(obj)
+	if meta == nil || meta.GetAnnotations()[ReloadAnnotation] != "true" {
+		return nil, nil
+	}
+
+	return configRefs(meta.GetNamespace(), &template.Spec), nil
+}
+
+// workloadTemplate returns the metadata and pod template of a Deployment,
+// StatefulSet or DaemonSet, nil for other objects.
+func workloadTemplate(obj interface{}) (metav1.Object, *corev1.PodTemplateSpec) {
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		return o, &o.Spec.Template
+	case *appsv1.StatefulSet:
+		return o, &o.Spec.Template
+	case *appsv1.DaemonSet:
+		return o, &o.Spec.Template
+	}
+
+	return nil, nil
+}
+
+// configRefs returns the ConfigMaps and Secrets a pod spec references through
+// volumes, envFrom and env valueFrom, as sorted Kind/namespace/name.
+func configRefs(namespace string, spec *corev1.PodSpec) []string {
+	refs := make(map[string]bool)
+	add := func(kind, name string) {
+		if name != "" {
+			refs[kind+"/"+namespace+"/"+name] = true
+		}
+	}
+
+	for _, v := range spec.Volumes {
+		if v.ConfigMap != nil {
+			add("ConfigMap", v.ConfigMap.Name)
+		}
+		if v.Secret != nil {
+			add("Secret", v.Secret.SecretName)
+		}
+		if v.Projected != nil {
+			for _, source := range v.Projected.Sources {
+				if source.ConfigMap != nil {
+					add("ConfigMap", source.ConfigMap.Name)
+				}
+				if source.Secret != nil {
+					add("Secret", source.Secret.Name)
+				}
+			}
+		}
+	}
+	for _, containers := range [][]corev1.Container{spec.InitContainers, spec.Containers} {
+		for _, container := range containers {
+			for _, envFrom := range container.EnvFrom {
+				if envFrom.ConfigMapRef != nil {
+					add("ConfigMap", envFrom.ConfigMapRef.Name)
+				}
+				if envFrom.SecretRef != nil {
+					add("Secret", envFrom.SecretRef.Name)
+				}
+			}
+			for _, env := range container.Env {
+				if env.ValueFrom == nil {
+					continue
+				}
+				if env.ValueFrom.ConfigMapKeyRef != nil {
+					add("ConfigMap", env.ValueFrom.ConfigMapKeyRef.Name)
+				}
+				if env.ValueFrom.SecretKeyRef != nil {
+					add("Secret", env.ValueFrom.SecretKeyRef.Name)
+				}
+			}
+		}
+	}
+
+	result := make([]string, 0, len(refs))
+	for ref := range refs {
+		result = append(result, ref)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// hashData writes the entries of data to h in key order.
+func hashData(h hash.Hash, data map[string][]byte) {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fmt.Fprintf(h, "%s\x00%d\x00", key, len(data[key]))
+		h.Write(data[key])
+	}
+}
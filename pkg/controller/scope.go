@@ -0,0 +1,230 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"github.com/lqshow/access-kubernetes-cluster/pkg/informer"
+
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+// maxScopeRetryDelay caps the backoff of the retries of a scope that failed
+// to start.
+const maxScopeRetryDelay = 5 * time.Minute
+
+// scope holds the informers and workers watching a single namespace, it is
+// stopped independently when the namespace is no longer watched.
+type scope struct {
+	namespace string
+	stopCh    chan struct{}
+	synced    []cache.InformerSynced
+
+	pods        *informer.PodController
+	deployments *informer.DeploymentController
+
+	// dynamic watches the namespaced resources configured at runtime, it
+	// is nil if no resources are watched with dynamic informers.
+	dynamic *informer.DynamicController
+}
+
+// startScope creates the namespaced informer factories and controllers for a
+// namespace and starts their workers. It is a no-op if the namespace is
+// already watched or the controller has been stopped.
+func (c *Controller) startScope(namespace string) error {
+	c.mu.Lock()
+	if _, ok := c.scopes[namespace]; ok || c.stopped {
+		c.mu.Unlock()
+		return nil
+	}
+
+	deployController := informer.NewDeploymentController(namespace, c.newInformerFactory(namespace, c.options.Deployments), c.dispatcher, c.rollouts)
+	// the owners of pods and the Jobs checked by the pod gc aren't filtered
+	// by the pod options.
+	ownerFactory := c.newInformerFactory(namespace, ResourceOptions{})
+	var jobs cache.SharedIndexInformer
+	if c.gc != nil {
+		jobs = ownerFactory.Batch().V1().Jobs().Informer()
+	}
+	// defined for which resource to be informed, we will be informed for pods
+	podController := informer.NewPodController(namespace, c.newInformerFactory(namespace, c.options.Pods), c.options.Recorder, c.dispatcher, c.owners, c.health, c.gc, jobs)
+
+	s := &scope{
+		namespace: namespace,
+		stopCh:    make(chan struct{}),
+		synced:    []cache.InformerSynced{deployController.HasSynced, podController.HasSynced},
+
+		pods:        podController,
+		deployments: deployController,
+		dynamic:     c.newDynamicController(namespace),
+	}
+	if s.dynamic != nil {
+		s.dynamic.Run(s.stopCh)
+		s.synced = append(s.synced, s.dynamic.HasSynced)
+		for _, resource := range c.dynamicResources {
+			if resource.namespaced {
+				s.dynamic.Watch(resource.gvr, resource.kind)
+			}
+		}
+	}
+	if c.owners != nil {
+		s.synced = append(s.synced, c.watchOwners(ownerFactory, namespace, s.stopCh)...)
+	}
+	if jobs != nil {
+		s.synced = append(s.synced, jobs.HasSynced)
+	}
+	ownerFactory.Start(s.stopCh)
+	c.scopes[namespace] = s
+	c.mu.Unlock()
+
+	klog.Infof("Starting informers for namespace %q", namespace)
+
+	if err := deployController.Run(s.stopCh); err != nil {
+		c.abortScope(s)
+		return fmt.Errorf("namespace %q: %v", namespace, err)
+	}
+
+	if err := podController.Run(s.stopCh); err != nil {
+		c.abortScope(s)
+		return fmt.Errorf("namespace %q: %v", namespace, err)
+	}
+	//if err := podController.List(); err != nil {
+	//	zap.S().Debugf("pod list err: %v", err)
+	//	return err
+	//}
+
+	klog.Infof("Starting workers for namespace %q", namespace)
+	// Launch workers to process user-defined resources
+	for i := 0; i < c.threadiness; i++ {
+		go wait.Until(deployController.RunWorker, time.Second, s.stopCh)
+		go wait.Until(podController.RunWorker, time.Second, s.stopCh)
+	}
+	c.runPeriodicReconcile(deployController.EnqueueAll, c.options.Deployments.ReconcilePeriod, s.stopCh)
+	c.runPeriodicReconcile(podController.EnqueueAll, c.options.Pods.ReconcilePeriod, s.stopCh)
+	klog.Infof("Started workers for namespace %q", namespace)
+
+	return nil
+}
+
+// abortScope stops a scope that failed to start and forgets it, so the
+// namespace can be started again.
+func (c *Controller) abortScope(s *scope) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// the scope may already have been stopped, or replaced.
+	if c.scopes[s.namespace] == s {
+		c.stopScope(s.namespace)
+	}
+}
+
+// retryStartScope starts the scope of a namespace, retrying with an
+// exponential backoff while the namespace is in store.
+func (c *Controller) retryStartScope(namespace string, store cache.Store, stopCh <-chan struct{}) {
+	delay := time.Second
+	for {
+		err := c.startScope(namespace)
+		if err == nil {
+			return
+		}
+		runtime.HandleError(fmt.Errorf("failed to watch namespace %s, retrying in %s: %v", namespace, delay, err))
+
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(delay):
+		}
+		if _, exists, _ := store.GetByKey(namespace); !exists {
+			return
+		}
+		if delay *= 2; delay > maxScopeRetryDelay {
+			delay = maxScopeRetryDelay
+		}
+	}
+}
+
+// stopScope stops the informers and workers of a namespace, the caller must
+// hold c.mu.
+func (c *Controller) stopScope(namespace string) {
+	s, ok := c.scopes[namespace]
+	if !ok {
+		return
+	}
+
+	klog.Infof("Stopping informers for namespace %q", namespace)
+	close(s.stopCh)
+	delete(c.scopes, namespace)
+}
+
+// watchOwners sets up the informers of the controllers owning pods in a
+// namespace, their objects only feed the owner graph. The informers of
+// factory are started by the caller.
+func (c *Controller) watchOwners(factory informers.SharedInformerFactory, namespace string, stopCh <-chan struct{}) []cache.InformerSynced {
+	informers := []cache.SharedIndexInformer{
+		factory.Apps().V1().ReplicaSets().Informer(),
+		factory.Apps().V1().StatefulSets().Informer(),
+		factory.Apps().V1().DaemonSets().Informer(),
+		factory.Batch().V1().Jobs().Informer(),
+	}
+	// client-go has no typed informer of batch/v1 CronJobs, they are
+	// watched with a dynamic informer.
+	var dynamicFactory dynamicinformer.DynamicSharedInformerFactory
+	switch {
+	case c.cronJobs == nil:
+	case c.cronJobs.Version == "v1beta1":
+		informers = append(informers, factory.Batch().V1beta1().CronJobs().Informer())
+	default:
+		dynamicFactory = dynamicinformer.NewFilteredDynamicSharedInformerFactory(c.dynamicClient, 0, namespace, nil)
+		informers = append(informers, dynamicFactory.ForResource(*c.cronJobs).Informer())
+	}
+
+	var synced []cache.InformerSynced
+	for _, i := range informers {
+		i.AddEventHandler(c.owners.ResourceEventHandler())
+		synced = append(synced, i.HasSynced)
+	}
+	if dynamicFactory != nil {
+		dynamicFactory.Start(stopCh)
+	}
+
+	return synced
+}
+
+// discoverCronJobs returns the resource of the version CronJobs are served
+// with, batch/v1beta1 is no longer served from Kubernetes 1.25. Nil is
+// returned if neither version is served, CronJobs are then not watched.
+func (c *Controller) discoverCronJobs() *schema.GroupVersionResource {
+	for _, version := range []string{"v1", "v1beta1"} {
+		gvr := schema.GroupVersionResource{Group: batchv1.GroupName, Version: version, Resource: "cronjobs"}
+		resources, err := c.kubeClient.Discovery().ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				klog.Warningf("Failed to discover %s: %v", gvr.GroupVersion(), err)
+			}
+			continue
+		}
+		for _, resource := range resources.APIResources {
+			if resource.Name != gvr.Resource {
+				continue
+			}
+			if version == "v1" && c.dynamicClient == nil {
+				klog.Warningf("CronJobs of %s are not watched for the owner graph without a dynamic client", gvr.GroupVersion())
+				return nil
+			}
+			klog.Infof("Watching CronJobs of %s for the owner graph", gvr.GroupVersion())
+			return &gvr
+		}
+	}
+
+	klog.Warningf("CronJobs are not served, they are not watched for the owner graph")
+	return nil
+}
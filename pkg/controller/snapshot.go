@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"os"
+
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"github.com/lqshow/access-kubernetes-cluster/pkg/informer"
+	"github.com/lqshow/access-kubernetes-cluster/pkg/snapshot"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Snapshot copies the informer stores of the nodes, pods and deployments.
+func (c *Controller) Snapshot() (*snapshot.Snapshot, error) {
+	s := snapshot.New()
+	if err := s.Add(corev1.SchemeGroupVersion.WithKind("Node"), c.nodeController.Indexer().List()); err != nil {
+		return nil, err
+	}
+
+	// the stores are converted without holding c.mu, which would block the
+	// namespaces from being started and stopped meanwhile.
+	c.mu.Lock()
+	scopes := make([]*scope, 0, len(c.scopes))
+	for _, scope := range c.scopes {
+		scopes = append(scopes, scope)
+	}
+	c.mu.Unlock()
+
+	for _, scope := range scopes {
+		if err := s.Add(corev1.SchemeGroupVersion.WithKind("Pod"), scope.pods.Indexer().List()); err != nil {
+			return nil, err
+		}
+		if err := s.Add(appsv1.SchemeGroupVersion.WithKind("Deployment"), scope.deployments.Indexer().List()); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// ServingSnapshot returns true while queries are served from the snapshot
+// loaded at start.
+func (c *Controller) ServingSnapshot() bool {
+	c.warmMu.Lock()
+	defer c.warmMu.Unlock()
+
+	return c.warm != nil
+}
+
+// writeSnapshot writes the informer stores to the snapshot file once the
+// informers have synchronized, a partial store would replace a complete
+// snapshot.
+func (c *Controller) writeSnapshot() {
+	if !c.HasSynced() {
+		klog.V(2).Info("Informers not synced, skipping snapshot")
+		return
+	}
+
+	s, err := c.Snapshot()
+	if err != nil {
+		klog.Errorf("Failed to take snapshot: %v", err)
+		return
+	}
+	if err := snapshot.Write(c.options.SnapshotPath, s); err != nil {
+		klog.Errorf("Failed to write snapshot %s: %v", c.options.SnapshotPath, err)
+		return
+	}
+	klog.V(2).Infof("Wrote snapshot %s", c.options.SnapshotPath)
+}
+
+// loadSnapshot loads the snapshot file to serve queries until the informers
+// have synchronized.
+func (c *Controller) loadSnapshot() {
+	s, err := snapshot.Read(c.options.SnapshotPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			klog.Infof("No snapshot at %s, starting cold", c.options.SnapshotPath)
+		} else {
+			klog.Warningf("Failed to read snapshot %s, starting cold: %v", c.options.SnapshotPath, err)
+		}
+		return
+	}
+
+	warm := make(map[string]cache.Indexer)
+	for kind, indexers := range map[string]cache.Indexers{
+		"Pod":        informer.PodIndexers(),
+		"Deployment": informer.DeploymentIndexers(),
+	} {
+		if _, ok := s.Kinds[kind]; !ok {
+			continue
+		}
+		indexer, err := s.Indexer(kind, indexers)
+		if err != nil {
+			klog.Warningf("Failed to load %s from snapshot %s: %v", kind, c.options.SnapshotPath, err)
+			continue
+		}
+		warm[kind] = indexer
+	}
+	klog.Infof("Serving queries from the snapshot of %s until informers are synced", s.Time)
+
+	c.warmMu.Lock()
+	defer c.warmMu.Unlock()
+	c.warm = warm
+}
+
+// warmIndexer returns the snapshot indexer of a kind while the informers
+// haven't synchronized, the snapshot is dropped once they have.
+func (c *Controller) warmIndexer(kind string) (cache.Indexer, bool) {
+	if !c.ServingSnapshot() {
+		return nil, false
+	}
+	synced := c.HasSynced()
+
+	c.warmMu.Lock()
+	defer c.warmMu.Unlock()
+	if synced {
+		c.warm = nil
+		return nil, false
+	}
+	indexer, ok := c.warm[kind]
+
+	return indexer, ok
+}
@@ -0,0 +1,331 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	"github.com/lqshow/access-kubernetes-cluster/pkg/metrics"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// TTLAnnotation is the lifetime of an object counted from its creation,
+	// as a duration, e.g. 72h.
+	TTLAnnotation = "informer.lqshow.io/ttl"
+	// ExpiresAtAnnotation is the RFC3339 time an object expires at, it takes
+	// precedence over TTLAnnotation.
+	ExpiresAtAnnotation = "informer.lqshow.io/expires-at"
+
+	// ReasonExpired is the Event reason of an expired object, recorded before
+	// it is deleted.
+	ReasonExpired = "Expired"
+	// ReasonInvalidExpiry is the Event reason of an object whose expiry
+	// annotations can't be parsed.
+	ReasonInvalidExpiry = "InvalidExpiry"
+)
+
+// DefaultTTLResources are the resources the TTL controller watches by
+// default.
+var DefaultTTLResources = []string{"v1/namespaces", "apps/v1/deployments", "batch/v1/jobs", "v1/configmaps"}
+
+// TTLOptions configures the TTL controller.
+type TTLOptions struct {
+	// Resources are watched for expiring objects, given as
+	// group/version/resource or Kind.group, defaults to
+	// DefaultTTLResources.
+	Resources []string
+	// Namespace restricts the namespaced resources to a namespace, every
+	// namespace is watched when empty. Of the cluster-scoped resources only
+	// the Namespace itself is then watched.
+	Namespace string
+	// PropagationPolicy of the deletes, Background by default.
+	PropagationPolicy metav1.DeletionPropagation
+	// DryRun only reports the expired objects with an Event and a log line.
+	DryRun bool
+	// Recorder records Kubernetes Events on the expired objects.
+	Recorder record.EventRecorder
+}
+
+// ttlItem is an object on the work queue of the TTL controller.
+type ttlItem struct {
+	resource schema.GroupVersionResource
+	key      string
+}
+
+// TTLController deletes the objects of the watched resources once the
+// expiry set by their annotations has passed.
+type TTLController struct {
+	dynamicClient dynamic.Interface
+	mapper        *restmapper.DeferredDiscoveryRESTMapper
+	options       TTLOptions
+
+	informers map[schema.GroupVersionResource]cache.SharedIndexInformer
+	workqueue workqueue.RateLimitingInterface
+
+	mu sync.Mutex
+	// reported holds the expired objects reported in dry-run mode by UID, so
+	// they are reported once.
+	reported map[string]bool
+	// invalid holds the invalid expiry reported by UID, so it is reported
+	// once until the annotations change.
+	invalid map[string]string
+}
+
+func NewTTLController(kubeClient kubernetes.Interface, dynamicClient dynamic.Interface, options TTLOptions) (*TTLController, error) {
+	if options.Recorder == nil {
+		return nil, fmt.Errorf("an event recorder is required")
+	}
+	if len(options.Resources) == 0 {
+		options.Resources = DefaultTTLResources
+	}
+	for _, spec := range options.Resources {
+		if _, _, err := parseResource(spec); err != nil {
+			return nil, err
+		}
+	}
+	switch options.PropagationPolicy {
+	case "":
+		options.PropagationPolicy = metav1.DeletePropagationBackground
+	case metav1.DeletePropagationBackground, metav1.DeletePropagationForeground, metav1.DeletePropagationOrphan:
+	default:
+		return nil, fmt.Errorf("unknown propagation policy %q", options.PropagationPolicy)
+	}
+
+	return &TTLController{
+		dynamicClient: dynamicClient,
+		mapper:        restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(kubeClient.Discovery())),
+		options:       options,
+		informers:     make(map[schema.GroupVersionResource]cache.SharedIndexInformer),
+		workqueue:     workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ttl"),
+		reported:      make(map[string]bool),
+		invalid:       make(map[string]string),
+	}, nil
+}
+
+// Run resolves the resources, starts their informers and the workers and
+// blocks until stopCh is closed. Resources that can't be resolved are
+// skipped.
+func (c *TTLController) Run(threadiness int, stopCh <-chan struct{}) error {
+	defer runtime.HandleCrash()
+	defer c.workqueue.ShutDown()
+
+	clusterFactory := dynamicinformer.NewDynamicSharedInformerFactory(c.dynamicClient, 0)
+	// with options.Namespace set, the other namespaces are not watched.
+	namespaceFactory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(c.dynamicClient, 0, metav1.NamespaceAll,
+		func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", c.options.Namespace).String()
+		})
+	namespacedFactory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(c.dynamicClient, 0, c.options.Namespace, nil)
+	var synced []cache.InformerSynced
+	for _, spec := range c.options.Resources {
+		resource, err := resolveResource(c.mapper, spec)
+		if err != nil {
+			klog.Warningf("Skipping TTL resource %q: %v", spec, err)
+			continue
+		}
+
+		factory := clusterFactory
+		switch {
+		case resource.namespaced:
+			factory = namespacedFactory
+		case c.options.Namespace == "":
+		case resource.gvr.GroupResource() == corev1.Resource("namespaces"):
+			factory = namespaceFactory
+		default:
+			klog.Infof("Skipping cluster-scoped TTL resource %q, only namespace %s is watched", spec, c.options.Namespace)
+			continue
+		}
+		gvr := resource.gvr
+		i := factory.ForResource(gvr).Informer()
+		i.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				c.enqueue(gvr, obj)
+			},
+			UpdateFunc: func(old, new interface{}) {
+				c.enqueue(gvr, new)
+			},
+			DeleteFunc: c.forget,
+		})
+		c.informers[gvr] = i
+		synced = append(synced, i.HasSynced)
+	}
+	clusterFactory.Start(stopCh)
+	namespaceFactory.Start(stopCh)
+	namespacedFactory.Start(stopCh)
+
+	klog.Info("Waiting for TTL informer caches to sync.")
+	if !cache.WaitForCacheSync(stopCh, synced...) {
+		return fmt.Errorf("timed out waiting for caches to sync")
+	}
+
+	for i := 0; i < threadiness; i++ {
+		go wait.Until(c.runWorker, time.Second, stopCh)
+	}
+
+	<-stopCh
+	klog.Info("Shutting down TTL workers")
+	return nil
+}
+
+func (c *TTLController) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *TTLController) processNextWorkItem() bool {
+	obj, shutdown := c.workqueue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.workqueue.Done(obj)
+
+	item, ok := obj.(ttlItem)
+	if !ok {
+		c.workqueue.Forget(obj)
+		runtime.HandleError(fmt.Errorf("expected ttlItem in workqueue but got %#v", obj))
+		return true
+	}
+
+	err := c.syncHandler(item)
+	metrics.ObserveReconcile("ttl", err)
+	if err != nil {
+		c.workqueue.AddRateLimited(item)
+		runtime.HandleError(fmt.Errorf("error syncing %s '%s': %s", item.resource.Resource, item.key, err.Error()))
+		return true
+	}
+	c.workqueue.Forget(obj)
+
+	return true
+}
+
+// syncHandler deletes an expired object, an object expiring later is
+// requeued for its expiry.
+func (c *TTLController) syncHandler(item ttlItem) error {
+	obj, exists, err := c.informers[item.resource].GetIndexer().GetByKey(item.key)
+	if err != nil || !exists {
+		return err
+	}
+	u := obj.(*unstructured.Unstructured)
+	if u.GetDeletionTimestamp() != nil {
+		return nil
+	}
+
+	expiry, ok, err := expiresAt(u)
+	if err != nil {
+		// the error holds the invalid annotation and its value.
+		c.mu.Lock()
+		reported := c.invalid[string(u.GetUID())] == err.Error()
+		c.invalid[string(u.GetUID())] = err.Error()
+		c.mu.Unlock()
+		if !reported {
+			c.options.Recorder.Eventf(u, corev1.EventTypeWarning, ReasonInvalidExpiry, "Invalid expiry: %v", err)
+		}
+		return nil
+	}
+	c.mu.Lock()
+	delete(c.invalid, string(u.GetUID()))
+	c.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	if wait := time.Until(expiry); wait > 0 {
+		c.workqueue.AddAfter(item, wait)
+		return nil
+	}
+
+	if c.options.DryRun {
+		c.mu.Lock()
+		reported := c.reported[string(u.GetUID())]
+		c.reported[string(u.GetUID())] = true
+		c.mu.Unlock()
+		if !reported {
+			klog.Infof("Dry run: %s %s expired at %s", u.GetKind(), item.key, expiry.Format(time.RFC3339))
+			c.options.Recorder.Eventf(u, corev1.EventTypeNormal, ReasonExpired, "Expired at %s, not deleted in dry-run mode", expiry.Format(time.RFC3339))
+		}
+		return nil
+	}
+
+	klog.Infof("Deleting %s %s, expired at %s", u.GetKind(), item.key, expiry.Format(time.RFC3339))
+	c.options.Recorder.Eventf(u, corev1.EventTypeNormal, ReasonExpired, "Expired at %s, deleting with %s propagation", expiry.Format(time.RFC3339), c.options.PropagationPolicy)
+
+	uid := u.GetUID()
+	err = c.dynamicClient.Resource(item.resource).Namespace(u.GetNamespace()).Delete(context.TODO(), u.GetName(), metav1.DeleteOptions{
+		// an object recreated with the same name is not deleted.
+		Preconditions:     &metav1.Preconditions{UID: &uid},
+		PropagationPolicy: &c.options.PropagationPolicy,
+	})
+	if errors.IsNotFound(err) || errors.IsConflict(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (c *TTLController) enqueue(resource schema.GroupVersionResource, obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+
+	c.workqueue.Add(ttlItem{resource: resource, key: key})
+}
+
+// forget drops a deleted object from the objects reported in dry-run mode
+// and with an invalid expiry.
+func (c *TTLController) forget(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	o, ok := obj.(metav1.Object)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.reported, string(o.GetUID()))
+	delete(c.invalid, string(o.GetUID()))
+}
+
+// expiresAt returns the expiry of an object set by its annotations, false if
+// it has none.
+func expiresAt(obj metav1.Object) (time.Time, bool, error) {
+	annotations := obj.GetAnnotations()
+	if value, ok := annotations[ExpiresAtAnnotation]; ok {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("%s: %v", ExpiresAtAnnotation, err)
+		}
+		return t, true, nil
+	}
+	if value, ok := annotations[TTLAnnotation]; ok {
+		ttl, err := time.ParseDuration(value)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("%s: %v", TTLAnnotation, err)
+		}
+		return obj.GetCreationTimestamp().Add(ttl), true, nil
+	}
+
+	return time.Time{}, false, nil
+}
@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// alwaysUp is the uptime schedule of workloads that are never scaled down.
+const alwaysUp = "always"
+
+// uptimeWindow is a weekly window, e.g. Mon-Fri 08:00-20:00 Europe/Berlin.
+type uptimeWindow struct {
+	fromDay, toDay time.Weekday
+	// from and to are minutes of the day, from is inclusive.
+	from, to int
+	location *time.Location
+}
+
+// UptimeSchedule is a list of weekly windows workloads run within, written as
+// comma separated "<day>[-<day>] <HH:MM>-<HH:MM> <time zone>", e.g.
+// "Mon-Fri 08:00-20:00 Europe/Berlin, Sat 10:00-14:00 UTC". The schedule
+// "always" keeps workloads running.
+type UptimeSchedule struct {
+	always  bool
+	windows []uptimeWindow
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseUptimeSchedule parses an uptime schedule.
+func ParseUptimeSchedule(s string) (UptimeSchedule, error) {
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, alwaysUp) {
+		return UptimeSchedule{always: true}, nil
+	}
+
+	var schedule UptimeSchedule
+	for _, spec := range strings.Split(s, ",") {
+		fields := strings.Fields(spec)
+		if len(fields) != 3 {
+			return UptimeSchedule{}, fmt.Errorf("invalid uptime window %q, expected <days> <HH:MM>-<HH:MM> <time zone>", strings.TrimSpace(spec))
+		}
+
+		var w uptimeWindow
+		var err error
+		if w.fromDay, w.toDay, err = parseDays(fields[0]); err != nil {
+			return UptimeSchedule{}, err
+		}
+		times := strings.Split(fields[1], "-")
+		if len(times) != 2 {
+			return UptimeSchedule{}, fmt.Errorf("invalid time range %q", fields[1])
+		}
+		if w.from, err = parseMinutes(times[0]); err != nil {
+			return UptimeSchedule{}, err
+		}
+		if w.to, err = parseMinutes(times[1]); err != nil {
+			return UptimeSchedule{}, err
+		}
+		if w.from >= w.to {
+			return UptimeSchedule{}, fmt.Errorf("time range %q must end after it starts", fields[1])
+		}
+		if w.location, err = time.LoadLocation(fields[2]); err != nil {
+			return UptimeSchedule{}, fmt.Errorf("invalid time zone %q: %v", fields[2], err)
+		}
+		schedule.windows = append(schedule.windows, w)
+	}
+
+	return schedule, nil
+}
+
+// Up returns whether now is within a window of the schedule.
+func (s UptimeSchedule) Up(now time.Time) bool {
+	if s.always {
+		return true
+	}
+
+	for _, w := range s.windows {
+		t := now.In(w.location)
+		day := t.Weekday()
+		if w.fromDay <= w.toDay {
+			if day < w.fromDay || day > w.toDay {
+				continue
+			}
+		} else if day < w.fromDay && day > w.toDay {
+			// a range wrapping around the week, e.g. Sat-Mon.
+			continue
+		}
+
+		minute := t.Hour()*60 + t.Minute()
+		if minute >= w.from && minute < w.to {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseDays(s string) (time.Weekday, time.Weekday, error) {
+	days := strings.Split(s, "-")
+	if len(days) > 2 {
+		return 0, 0, fmt.Errorf("invalid days %q", s)
+	}
+
+	from, ok := weekdays[strings.ToLower(days[0])]
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid day %q", days[0])
+	}
+	to := from
+	if len(days) == 2 {
+		if to, ok = weekdays[strings.ToLower(days[1])]; !ok {
+			return 0, 0, fmt.Errorf("invalid day %q", days[1])
+		}
+	}
+
+	return from, to, nil
+}
+
+// parseMinutes parses HH:MM into minutes of the day, 24:00 is the end of the
+// day.
+func parseMinutes(s string) (int, error) {
+	var hour, minute int
+	if _, err := fmt.Sscanf(s, "%d:%d", &hour, &minute); err != nil || len(s) != 5 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	if hour < 0 || minute < 0 || minute > 59 || hour*60+minute > 24*60 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+
+	return hour*60 + minute, nil
+}
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"testing"
+	"time"
+)
+
+// utc returns a time of the week of Sunday 2020-09-06 in UTC.
+func utc(day time.Weekday, hour, minute int) time.Time {
+	return time.Date(2020, 9, 6+int(day), hour, minute, 0, 0, time.UTC)
+}
+
+func TestUptimeScheduleUp(t *testing.T) {
+	for _, tc := range []struct {
+		schedule string
+		now      time.Time
+		up       bool
+	}{
+		{"Mon-Fri 08:00-20:00 UTC", utc(time.Wednesday, 8, 0), true},
+		{"Mon-Fri 08:00-20:00 UTC", utc(time.Wednesday, 20, 0), false},
+		{"Mon-Fri 08:00-20:00 UTC", utc(time.Saturday, 12, 0), false},
+
+		// a range wrapping around the week.
+		{"Sat-Mon 08:00-20:00 UTC", utc(time.Saturday, 8, 0), true},
+		{"Sat-Mon 08:00-20:00 UTC", utc(time.Sunday, 12, 0), true},
+		{"Sat-Mon 08:00-20:00 UTC", utc(time.Monday, 19, 59), true},
+		{"Sat-Mon 08:00-20:00 UTC", utc(time.Tuesday, 12, 0), false},
+		{"Sat-Mon 08:00-20:00 UTC", utc(time.Friday, 12, 0), false},
+		{"Sat-Mon 08:00-20:00 UTC", utc(time.Saturday, 7, 59), false},
+
+		// 24:00 ends the window at midnight.
+		{"Mon 20:00-24:00 UTC", utc(time.Monday, 23, 59), true},
+		{"Mon 20:00-24:00 UTC", utc(time.Tuesday, 0, 0), false},
+		{"Mon 00:00-24:00 UTC", utc(time.Monday, 0, 0), true},
+
+		// multiple windows.
+		{"Mon-Fri 08:00-12:00 UTC, Mon-Fri 13:00-17:00 UTC", utc(time.Wednesday, 11, 59), true},
+		{"Mon-Fri 08:00-12:00 UTC, Mon-Fri 13:00-17:00 UTC", utc(time.Wednesday, 12, 30), false},
+		{"Mon-Fri 08:00-12:00 UTC, Mon-Fri 13:00-17:00 UTC", utc(time.Wednesday, 13, 0), true},
+		{"Mon-Fri 08:00-12:00 UTC, Sat 10:00-14:00 UTC", utc(time.Saturday, 10, 0), true},
+
+		// the day and time are taken in the time zone of the window, which
+		// may be another day than in UTC.
+		{"Mon 00:00-08:00 Asia/Tokyo", utc(time.Sunday, 20, 0), true},
+		{"Mon 00:00-08:00 Asia/Tokyo", utc(time.Monday, 5, 0), false},
+		{"Fri 20:00-24:00 America/New_York", utc(time.Saturday, 1, 0), true},
+		{"Fri 20:00-24:00 America/New_York", utc(time.Friday, 21, 0), false},
+
+		{"always", utc(time.Sunday, 3, 0), true},
+		{" Always ", utc(time.Sunday, 3, 0), true},
+	} {
+		schedule, err := ParseUptimeSchedule(tc.schedule)
+		if err != nil {
+			t.Errorf("ParseUptimeSchedule(%q): %v", tc.schedule, err)
+			continue
+		}
+		if up := schedule.Up(tc.now); up != tc.up {
+			t.Errorf("%q.Up(%s %s) = %v, want %v", tc.schedule, tc.now.Weekday(), tc.now.Format("15:04 MST"), up, tc.up)
+		}
+	}
+}
+
+func TestParseUptimeScheduleRejectsInvalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"Mon-Fri 8:00-20:00 UTC",
+		"Mon-Fri 08:00-20:0 UTC",
+		"Mon-Fri 08:00-24:01 UTC",
+		"Mon-Fri 08:60-20:00 UTC",
+		"Mon-Fri 10:00-10:00 UTC",
+		"Mon-Fri 20:00-08:00 UTC",
+		"Mon-Fri 08:00-20:00 Mars/Olympus",
+		"Mon-Fri 08:00-20:00",
+		"Funday 08:00-20:00 UTC",
+		"Mon-Wed-Fri 08:00-20:00 UTC",
+		"Mon-Fri 08:00 UTC",
+		"Mon-Fri 08:00-20:00 UTC,",
+	} {
+		if _, err := ParseUptimeSchedule(s); err == nil {
+			t.Errorf("ParseUptimeSchedule(%q) succeeded, want an error", s)
+		}
+	}
+}
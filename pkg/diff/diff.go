@@ -0,0 +1,252 @@
+package diff
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DefaultIgnorePaths are fields that change without the object changing in a
+// meaningful way, they are skipped unless other paths are given.
+var DefaultIgnorePaths = []string{
+	"/metadata/managedFields",
+	"/metadata/resourceVersion",
+	"/status/conditions/*/lastHeartbeatTime",
+	"/status/conditions/*/lastUpdateTime",
+}
+
+// Operation is a JSON patch operation.
+type Operation string
+
+const (
+	OperationAdd     Operation = "add"
+	OperationRemove  Operation = "remove"
+	OperationReplace Operation = "replace"
+)
+
+// Change is a single field level change, Path is a JSON pointer. Applying
+// the changes as a JSON patch to the old object yields the new object, Old
+// is kept so the change can be read without the old object at hand.
+type Change struct {
+	Op    Operation   `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+	Old   interface{} `json:"old,omitempty"`
+}
+
+func (c Change) String() string {
+	switch c.Op {
+	case OperationAdd:
+		return fmt.Sprintf("%s %s=%v", c.Op, c.Path, c.Value)
+	case OperationRemove:
+		return fmt.Sprintf("%s %s (was %v)", c.Op, c.Path, c.Old)
+	default:
+		return fmt.Sprintf("%s %s %v -> %v", c.Op, c.Path, c.Old, c.Value)
+	}
+}
+
+// Summary formats changes on a single line for logging.
+func Summary(changes []Change) string {
+	parts := make([]string, len(changes))
+	for i, change := range changes {
+		parts[i] = change.String()
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// Differ computes field level diffs between two versions of an object.
+type Differ struct {
+	ignore [][]string
+}
+
+// NewDiffer creates a differ skipping the given JSON pointer paths, a path
+// segment of "*" matches any map key or list index. DefaultIgnorePaths are
+// skipped when no paths are given.
+func NewDiffer(ignorePaths []string) (*Differ, error) {
+	if len(ignorePaths) == 0 {
+		ignorePaths = DefaultIgnorePaths
+	}
+
+	d := &Differ{}
+	for _, path := range ignorePaths {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("ignore path %q must be a JSON pointer starting with /", path)
+		}
+		d.ignore = append(d.ignore, SplitPointer(path))
+	}
+
+	return d, nil
+}
+
+// Diff returns the changes from oldObj to newObj, both must be runtime
+// objects, typed or unstructured.
+func (d *Differ) Diff(oldObj, newObj runtime.Object) ([]Change, error) {
+	oldMap, err := toUnstructured(oldObj)
+	if err != nil {
+		return nil, err
+	}
+	newMap, err := toUnstructured(newObj)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	d.diffValues(nil, oldMap, newMap, &changes)
+
+	return changes, nil
+}
+
+func (d *Differ) diffValues(path []string, oldValue, newValue interface{}, changes *[]Change) {
+	if d.ignored(path) {
+		return
+	}
+
+	switch oldTyped := oldValue.(type) {
+	case map[string]interface{}:
+		if newTyped, ok := newValue.(map[string]interface{}); ok {
+			d.diffMaps(path, oldTyped, newTyped, changes)
+			return
+		}
+	case []interface{}:
+		if newTyped, ok := newValue.([]interface{}); ok {
+			d.diffLists(path, oldTyped, newTyped, changes)
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(oldValue, newValue) {
+		*changes = append(*changes, Change{Op: OperationReplace, Path: JoinPointer(path), Value: newValue, Old: oldValue})
+	}
+}
+
+// diffMaps compares maps key by key in sorted order so diffs are stable.
+func (d *Differ) diffMaps(path []string, oldMap, newMap map[string]interface{}, changes *[]Change) {
+	keys := make([]string, 0, len(oldMap)+len(newMap))
+	for key := range oldMap {
+		keys = append(keys, key)
+	}
+	for key := range newMap {
+		if _, ok := oldMap[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		childPath := appendPath(path, key)
+		oldValue, inOld := oldMap[key]
+		newValue, inNew := newMap[key]
+		switch {
+		case !inNew:
+			if !d.ignored(childPath) {
+				*changes = append(*changes, Change{Op: OperationRemove, Path: JoinPointer(childPath), Old: oldValue})
+			}
+		case !inOld:
+			if !d.ignored(childPath) {
+				*changes = append(*changes, Change{Op: OperationAdd, Path: JoinPointer(childPath), Value: newValue})
+			}
+		default:
+			d.diffValues(childPath, oldValue, newValue, changes)
+		}
+	}
+}
+
+// diffLists compares lists index by index, extra elements are added or
+// removed at the tail. Removals are emitted from the last index so the
+// changes apply in order.
+func (d *Differ) diffLists(path []string, oldList, newList []interface{}, changes *[]Change) {
+	common := len(oldList)
+	if len(newList) < common {
+		common = len(newList)
+	}
+
+	for i := 0; i < common; i++ {
+		d.diffValues(appendPath(path, strconv.Itoa(i)), oldList[i], newList[i], changes)
+	}
+	for i := common; i < len(newList); i++ {
+		childPath := appendPath(path, strconv.Itoa(i))
+		if !d.ignored(childPath) {
+			*changes = append(*changes, Change{Op: OperationAdd, Path: JoinPointer(childPath), Value: newList[i]})
+		}
+	}
+	for i := len(oldList) - 1; i >= common; i-- {
+		childPath := appendPath(path, strconv.Itoa(i))
+		if !d.ignored(childPath) {
+			*changes = append(*changes, Change{Op: OperationRemove, Path: JoinPointer(childPath), Old: oldList[i]})
+		}
+	}
+}
+
+// ignored returns true if the path or one of its parents is ignored.
+func (d *Differ) ignored(path []string) bool {
+	for _, pattern := range d.ignore {
+		if len(pattern) > len(path) {
+			continue
+		}
+		matched := true
+		for i, segment := range pattern {
+			if segment != "*" && segment != path[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+func toUnstructured(obj runtime.Object) (map[string]interface{}, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u.Object, nil
+	}
+
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+}
+
+func appendPath(path []string, segment string) []string {
+	childPath := make([]string, len(path)+1)
+	copy(childPath, path)
+	childPath[len(path)] = segment
+
+	return childPath
+}
+
+var (
+	pointerEscaper   = strings.NewReplacer("~", "~0", "/", "~1")
+	pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+// JoinPointer returns the JSON pointer of a path.
+func JoinPointer(path []string) string {
+	var b strings.Builder
+	for _, segment := range path {
+		b.WriteString("/")
+		b.WriteString(pointerEscaper.Replace(segment))
+	}
+
+	return b.String()
+}
+
+// SplitPointer returns the path of a JSON pointer, the inverse of
+// JoinPointer.
+func SplitPointer(pointer string) []string {
+	segments := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i := range segments {
+		segments[i] = pointerUnescaper.Replace(segments[i])
+	}
+
+	return segments
+}
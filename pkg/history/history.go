@@ -0,0 +1,412 @@
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"k8s.io/klog/v2"
+
+	"github.com/lqshow/access-kubernetes-cluster/pkg/diff"
+	"github.com/lqshow/access-kubernetes-cluster/pkg/informer"
+)
+
+var (
+	// recordsBucket holds the records by time and sequence number.
+	recordsBucket = []byte("records")
+	// objectsBucket indexes the records by kind/namespace/name.
+	objectsBucket = []byte("objects")
+	// metaBucket holds the record count and size.
+	metaBucket = []byte("meta")
+
+	countKey = []byte("count")
+	bytesKey = []byte("bytes")
+)
+
+const (
+	// batchSize is the maximum number of records written in a transaction.
+	batchSize = 500
+	// queueSize is the number of events buffered before they are written,
+	// events are dropped when the store falls behind.
+	queueSize = 10000
+)
+
+// Record is a change of an object stored in the history.
+type Record struct {
+	Type            informer.EventType `json:"type"`
+	Kind            string             `json:"kind"`
+	Namespace       string             `json:"namespace,omitempty"`
+	Name            string             `json:"name"`
+	UID             string             `json:"uid,omitempty"`
+	ResourceVersion string             `json:"resourceVersion,omitempty"`
+	Time            time.Time          `json:"time"`
+
+	// Object is the object after the change, or the last known state of a
+	// deleted object.
+	Object json.RawMessage `json:"object"`
+	// Diff holds the field level changes of an update.
+	Diff []diff.Change `json:"diff,omitempty"`
+}
+
+// Options configures the location and the retention of the history.
+type Options struct {
+	// Path is the file of the store.
+	Path string
+	// MaxAge drops records older than it, 0 keeps records of any age.
+	MaxAge time.Duration
+	// MaxRecords drops the oldest records over it, 0 disables the limit.
+	MaxRecords int64
+	// MaxBytes drops the oldest records once the records take more, 0
+	// disables the limit.
+	MaxBytes int64
+	// PrunePeriod is the period retention is applied with.
+	PrunePeriod time.Duration
+	// FlushPeriod is the longest an event is buffered before it is written.
+	FlushPeriod time.Duration
+}
+
+// Store is an embedded, size-bounded store of the changes of the watched
+// objects, it answers what an object looked like at a point in time.
+type Store struct {
+	db      *bolt.DB
+	options Options
+	events  chan *informer.Event
+	seq     uint64
+}
+
+// Open opens or creates the store at options.Path.
+func Open(options Options) (*Store, error) {
+	if options.PrunePeriod <= 0 || options.FlushPeriod <= 0 {
+		return nil, fmt.Errorf("prune and flush periods must be positive")
+	}
+
+	db, err := bolt.Open(options.Path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history %s: %v", options.Path, err)
+	}
+	s := &Store{
+		db:      db,
+		options: options,
+		events:  make(chan *informer.Event, queueSize),
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{recordsBucket, objectsBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		// continue the sequence numbers of the records of a previous run.
+		if k, _ := tx.Bucket(recordsBucket).Cursor().Last(); k != nil {
+			s.seq = binary.BigEndian.Uint64(k[8:])
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Close closes the store.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// HandleEvent queues an event to be appended to the history, it is an
+// informer.EventHandler.
+func (s *Store) HandleEvent(event *informer.Event) {
+	select {
+	case s.events <- event:
+	default:
+		klog.Warningf("History queue is full, dropped %s %s %s", event.Type, event.Kind, event.Key())
+	}
+}
+
+// Run writes the queued events in batches and applies retention until
+// stopCh is closed, the queued events are written before it returns.
+func (s *Store) Run(stopCh <-chan struct{}) {
+	flush := time.NewTicker(s.options.FlushPeriod)
+	defer flush.Stop()
+	prune := time.NewTicker(s.options.PrunePeriod)
+	defer prune.Stop()
+
+	var batch []*informer.Event
+	write := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.Append(batch...); err != nil {
+			klog.Errorf("Failed to append %d events to history: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case event := <-s.events:
+			batch = append(batch, event)
+			if len(batch) >= batchSize {
+				write()
+			}
+		case <-flush.C:
+			write()
+		case <-prune.C:
+			if err := s.Prune(time.Now()); err != nil {
+				klog.Errorf("Failed to prune history: %v", err)
+			}
+		case <-stopCh:
+			for {
+				select {
+				case event := <-s.events:
+					batch = append(batch, event)
+				default:
+					write()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Append stores events in a single transaction.
+func (s *Store) Append(events ...*informer.Event) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		records := tx.Bucket(recordsBucket)
+		objects := tx.Bucket(objectsBucket)
+		meta := tx.Bucket(metaBucket)
+
+		count, size := getInt(meta, countKey), getInt(meta, bytesKey)
+		for _, event := range events {
+			object, err := json.Marshal(event.Object)
+			if err != nil {
+				return fmt.Errorf("failed to encode %s %s: %v", event.Kind, event.Key(), err)
+			}
+			value, err := json.Marshal(Record{
+				Type:            event.Type,
+				Kind:            event.Kind,
+				Namespace:       event.Namespace,
+				Name:            event.Name,
+				UID:             event.UID,
+				ResourceVersion: event.ResourceVersion,
+				Time:            event.Time,
+				Object:          object,
+				Diff:            event.Diff,
+			})
+			if err != nil {
+				return err
+			}
+
+			s.seq++
+			key := recordKey(event.Time, s.seq)
+			if err := records.Put(key, value); err != nil {
+				return err
+			}
+			if err := objects.Put(objectKey(event.Kind, event.Namespace, event.Name, key), nil); err != nil {
+				return err
+			}
+			count++
+			size += int64(len(value))
+		}
+
+		return putCounters(meta, count, size)
+	})
+}
+
+// Prune drops the records older than MaxAge, then the oldest records while
+// there are more than MaxRecords or they take more than MaxBytes.
+func (s *Store) Prune(now time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		records := tx.Bucket(recordsBucket)
+		objects := tx.Bucket(objectsBucket)
+		meta := tx.Bucket(metaBucket)
+
+		count, size := getInt(meta, countKey), getInt(meta, bytesKey)
+		cutoff := time.Time{}
+		if s.options.MaxAge > 0 {
+			cutoff = now.Add(-s.options.MaxAge)
+		}
+
+		var pruned int64
+		c := records.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.First() {
+			overCount := s.options.MaxRecords > 0 && count > s.options.MaxRecords
+			overSize := s.options.MaxBytes > 0 && size > s.options.MaxBytes
+			if !overCount && !overSize && !recordTime(k).Before(cutoff) {
+				break
+			}
+
+			var record Record
+			if err := json.Unmarshal(v, &record); err != nil {
+				return err
+			}
+			if err := objects.Delete(objectKey(record.Kind, record.Namespace, record.Name, k)); err != nil {
+				return err
+			}
+			count--
+			size -= int64(len(v))
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			pruned++
+		}
+		if pruned > 0 {
+			klog.V(2).Infof("Pruned %d records from history", pruned)
+		}
+
+		return putCounters(meta, count, size)
+	})
+}
+
+// History returns the records of an object between since and until in time
+// order, zero times leave the range open.
+func (s *Store) History(kind, namespace, name string, since, until time.Time) ([]Record, error) {
+	var result []Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		records := tx.Bucket(recordsBucket)
+		prefix := objectKey(kind, namespace, name, nil)
+
+		c := tx.Bucket(objectsBucket).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			key := k[len(prefix):]
+			t := recordTime(key)
+			if t.Before(since) {
+				continue
+			}
+			if !until.IsZero() && t.After(until) {
+				break
+			}
+
+			record, err := getRecord(records, key)
+			if err != nil {
+				return err
+			}
+			result = append(result, record)
+		}
+		return nil
+	})
+
+	return result, err
+}
+
+// At returns the state of an object at a point in time, false is returned
+// if the object didn't exist or its history doesn't go back that far.
+func (s *Store) At(kind, namespace, name string, at time.Time) (*Record, bool, error) {
+	var result *Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		records := tx.Bucket(recordsBucket)
+		prefix := objectKey(kind, namespace, name, nil)
+
+		var last []byte
+		c := tx.Bucket(objectsBucket).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			key := k[len(prefix):]
+			if recordTime(key).After(at) {
+				break
+			}
+			last = append(last[:0], key...)
+		}
+		if last == nil {
+			return nil
+		}
+
+		record, err := getRecord(records, last)
+		if err != nil {
+			return err
+		}
+		if record.Type != informer.EventDeleted {
+			result = &record
+		}
+		return nil
+	})
+
+	return result, result != nil, err
+}
+
+// Changes returns the records of a namespace between since and until in
+// time order, an empty namespace returns the records of every namespace.
+// At most limit records are returned if limit is positive.
+func (s *Store) Changes(namespace string, since, until time.Time, limit int) ([]Record, error) {
+	var result []Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(recordsBucket).Cursor()
+		for k, v := c.Seek(recordKey(since, 0)); k != nil; k, v = c.Next() {
+			if !until.IsZero() && recordTime(k).After(until) {
+				break
+			}
+
+			var record Record
+			if err := json.Unmarshal(v, &record); err != nil {
+				return err
+			}
+			if namespace != "" && record.Namespace != namespace {
+				continue
+			}
+			result = append(result, record)
+			if limit > 0 && len(result) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+
+	return result, err
+}
+
+// recordKey orders records by time, the sequence number keeps records of the
+// same time apart.
+func recordKey(t time.Time, seq uint64) []byte {
+	key := make([]byte, 16)
+	nanos := int64(0)
+	if !t.IsZero() {
+		nanos = t.UnixNano()
+	}
+	binary.BigEndian.PutUint64(key, uint64(nanos))
+	binary.BigEndian.PutUint64(key[8:], seq)
+	return key
+}
+
+func recordTime(key []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key[:8])))
+}
+
+func objectKey(kind, namespace, name string, key []byte) []byte {
+	prefix := []byte(kind + "/" + namespace + "/" + name + "\x00")
+	return append(prefix, key...)
+}
+
+func getRecord(records *bolt.Bucket, key []byte) (Record, error) {
+	var record Record
+	v := records.Get(key)
+	if v == nil {
+		return record, fmt.Errorf("history record %x is missing", key)
+	}
+	err := json.Unmarshal(v, &record)
+
+	return record, err
+}
+
+func getInt(b *bolt.Bucket, key []byte) int64 {
+	v := b.Get(key)
+	if len(v) != 8 {
+		return 0
+	}
+
+	return int64(binary.BigEndian.Uint64(v))
+}
+
+func putCounters(meta *bolt.Bucket, count, size int64) error {
+	for key, value := range map[string]int64{string(countKey): count, string(bytesKey): size} {
+		v := make([]byte, 8)
+		binary.BigEndian.PutUint64(v, uint64(value))
+		if err := meta.Put([]byte(key), v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
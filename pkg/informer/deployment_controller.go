@@ -2,6 +2,7 @@ package informer
 
 import (
 	"fmt"
+	"time"
 
 	"k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -11,6 +12,9 @@ import (
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 
+	"github.com/lqshow/access-kubernetes-cluster/pkg/diff"
+	"github.com/lqshow/access-kubernetes-cluster/pkg/metrics"
+
 	applisters "k8s.io/client-go/listers/apps/v1"
 )
 
@@ -18,12 +22,19 @@ type DeploymentController struct {
 	informer         cache.SharedIndexInformer
 	deploymentLister applisters.DeploymentLister
 
+	// dispatcher publishes the changes of deployments to the event handlers.
+	dispatcher *Dispatcher
+	// rollouts follows the rollouts of the synced deployments, it may be nil.
+	rollouts *RolloutTracker
+
 	// workqueue is a rate limited work queue. This is used to queue work to be
 	// processed instead of performing it as soon as a change happens. This
 	// means we can ensure we only process a fixed amount of resources at a
 	// time, and makes it easy to ensure we are never processing the same item
 	// simultaneously in two different workers.
 	workqueue workqueue.RateLimitingInterface
+	// queueName names the work queue in the metrics, per namespace.
+	queueName string
 }
 
 // Run starts shared informers and waits for the shared informer cache to
@@ -31,6 +42,12 @@ type DeploymentController struct {
 func (c *DeploymentController) Run(stopCh <-chan struct{}) error {
 	// run starts and runs the shared informer
 	go c.informer.Run(stopCh)
+	// shut down the workqueue so the workers return once we are stopped
+	go func() {
+		<-stopCh
+		c.workqueue.ShutDown()
+		metrics.ForgetWorkQueue(c.queueName)
+	}()
 
 	// wait for the initial synchronization of the local cache.
 	klog.Info("Waiting for informer caches to sync.")
@@ -41,6 +58,17 @@ func (c *DeploymentController) Run(stopCh <-chan struct{}) error {
 	return nil
 }
 
+// HasSynced returns true once the informer cache has been synchronized.
+func (c *DeploymentController) HasSynced() bool {
+	return c.informer.HasSynced()
+}
+
+// Indexer returns the indexed cache of the deployments, see
+// DeploymentIndexers.
+func (c *DeploymentController) Indexer() cache.Indexer {
+	return c.informer.GetIndexer()
+}
+
 // runWorker is a long-running function that will continually call the
 // processNextWorkItem function in order to read and process a message on the
 // workqueue.
@@ -80,7 +108,9 @@ func (c *DeploymentController) processNextWorkItem() bool {
 			return nil
 		}
 
-		if err := c.syncHandler(key); err != nil {
+		err := c.syncHandler(key)
+		metrics.ObserveReconcile("deployments", err)
+		if err != nil {
 			return fmt.Errorf("error syncing '%s': %s", key, err.Error())
 		}
 
@@ -112,6 +142,9 @@ func (c *DeploymentController) syncHandler(key string) error {
 	if err != nil {
 		if errors.IsNotFound(err) {
 			klog.Infof("Deploy: %s/%s does not exist in local cache, will delete it ...", namespace, name)
+			if c.rollouts != nil {
+				c.rollouts.Forget(namespace, name)
+			}
 			return nil
 		}
 
@@ -119,6 +152,9 @@ func (c *DeploymentController) syncHandler(key string) error {
 		return err
 	}
 	klog.Infof("Try to process deploy, name: %v, ResourceVersion: %v ...", deploy.Name, deploy.ResourceVersion)
+	if c.rollouts != nil {
+		c.rollouts.Observe(deploy, time.Now())
+	}
 
 	return nil
 }
@@ -141,6 +177,14 @@ func (c *DeploymentController) enqueue(obj interface{}) {
 	klog.Infof("DEPLOYMENT SYNCED: %s/%s %v", deploy.Namespace, deploy.Name, deploy.Status.AvailableReplicas)
 }
 
+// EnqueueAll puts the key of every Deployment in the informer cache onto the
+// work queue, it is used to periodically reconcile all Deployments.
+func (c *DeploymentController) EnqueueAll() {
+	for _, key := range c.informer.GetStore().ListKeys() {
+		c.workqueue.Add(key)
+	}
+}
+
 // enqueueForDelete takes a deleted Deployment resource and converts it into a namespace/name
 // string which is then put onto the work queue. This method should *not* be
 // passed resources of any type other than Deployment.
@@ -155,38 +199,57 @@ func (c *DeploymentController) enqueueForDelete(obj interface{}) {
 	}
 	c.workqueue.AddRateLimited(key)
 
-	deploy := obj.(*v1.Deployment)
-	klog.Infof("DEPLOYMENT DELETED: %s/%v", deploy.Namespace, deploy.Name)
+	if event := c.dispatcher.Deleted("Deployment", obj); event != nil {
+		klog.Infof("DEPLOYMENT DELETED: %s", event.Key())
+	}
 }
 
-func NewDeploymentController(informerFactory informers.SharedInformerFactory) *DeploymentController {
+// NewDeploymentController creates the controller of the deployments of a
+// namespace, all namespaces when it is empty.
+func NewDeploymentController(namespace string, informerFactory informers.SharedInformerFactory, dispatcher *Dispatcher, rollouts *RolloutTracker) *DeploymentController {
+	queueName := workQueueName("deployments", namespace)
 	// Deployment Informer
 	deployInformer := informerFactory.Apps().V1().Deployments()
 	// create informer
 	informer := deployInformer.Informer()
+	if err := informer.AddIndexers(DeploymentIndexers()); err != nil {
+		runtime.HandleError(fmt.Errorf("failed to add deployment indexers: %v", err))
+	}
 	// create deployment lister
 	deploymentLister := deployInformer.Lister()
 
 	c := &DeploymentController{
 		informer:         informer,
 		deploymentLister: deploymentLister,
+		dispatcher:       dispatcher,
+		rollouts:         rollouts,
 
 		// create the workqueue
-		workqueue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "deployments"),
+		workqueue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), queueName),
+		queueName: queueName,
 	}
 
 	// Set up an event handler for when Deployment resources change
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: c.enqueue,
+		AddFunc: func(obj interface{}) {
+			c.enqueue(obj)
+			c.dispatcher.Added("Deployment", obj)
+		},
 		UpdateFunc: func(old, new interface{}) {
 			oldDeploy := old.(*v1.Deployment)
 			newDeploy := new.(*v1.Deployment)
 			if oldDeploy.ResourceVersion == newDeploy.ResourceVersion {
 				// Periodic resync will send update events for all known Deployments.
-				// Two different versions of the same Deployment will always have different RVs.
+				// Two different versions of the same Deployment will always have different RVs,
+				// the resync is still reconciled so drift gets corrected.
+				c.enqueue(new)
 				return
 			}
 			c.enqueue(new)
+
+			if event := c.dispatcher.Updated("Deployment", old, new); event != nil {
+				klog.Infof("DEPLOYMENT UPDATED: %s: %s", event.Key(), diff.Summary(event.Diff))
+			}
 		},
 		DeleteFunc: c.enqueueForDelete,
 	})
@@ -0,0 +1,149 @@
+package informer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"github.com/lqshow/access-kubernetes-cluster/pkg/diff"
+)
+
+// dynamicInformer is a running informer of a single resource.
+type dynamicInformer struct {
+	kind     string
+	informer cache.SharedIndexInformer
+	stopCh   chan struct{}
+}
+
+// DynamicController watches arbitrary resources, including custom resources,
+// with dynamic informers and publishes their changes as unstructured
+// objects through the same dispatcher as the typed controllers.
+type DynamicController struct {
+	client           dynamic.Interface
+	namespace        string
+	resyncPeriod     time.Duration
+	tweakListOptions dynamicinformer.TweakListOptionsFunc
+	dispatcher       *Dispatcher
+
+	mu        sync.Mutex
+	informers map[schema.GroupVersionResource]*dynamicInformer
+	stopped   bool
+}
+
+// NewDynamicController creates a controller watching resources in a
+// namespace, an empty namespace watches all namespaces and cluster scoped
+// resources. tweakListOptions may be nil.
+func NewDynamicController(client dynamic.Interface, namespace string, resyncPeriod time.Duration,
+	tweakListOptions dynamicinformer.TweakListOptionsFunc, dispatcher *Dispatcher) *DynamicController {
+	return &DynamicController{
+		client:           client,
+		namespace:        namespace,
+		resyncPeriod:     resyncPeriod,
+		tweakListOptions: tweakListOptions,
+		dispatcher:       dispatcher,
+		informers:        make(map[schema.GroupVersionResource]*dynamicInformer),
+	}
+}
+
+// Run stops every informer once stopCh is closed, resources watched
+// afterwards are ignored.
+func (c *DynamicController) Run(stopCh <-chan struct{}) {
+	go func() {
+		<-stopCh
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.stopped = true
+		for gvr := range c.informers {
+			c.unwatch(gvr)
+		}
+	}()
+}
+
+// HasSynced returns true once every informer cache has been synchronized.
+func (c *DynamicController) HasSynced() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, i := range c.informers {
+		if !i.informer.HasSynced() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Watch starts an informer for the resource, events are published with the
+// given kind. It is a no-op if the resource is already watched.
+func (c *DynamicController) Watch(gvr schema.GroupVersionResource, kind string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.informers[gvr]; ok || c.stopped {
+		return
+	}
+
+	klog.Infof("Starting dynamic informer for %s in namespace %q", gvr, c.namespace)
+	informer := dynamicinformer.NewFilteredDynamicInformer(c.client, gvr, c.namespace, c.resyncPeriod,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}, c.tweakListOptions).Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			c.dispatcher.Added(kind, obj)
+		},
+		UpdateFunc: func(old, new interface{}) {
+			if event := c.dispatcher.Updated(kind, old, new); event != nil {
+				klog.V(4).Infof("%s UPDATED: %s: %s", kind, event.Key(), diff.Summary(event.Diff))
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			c.dispatcher.Deleted(kind, obj)
+		},
+	})
+
+	i := &dynamicInformer{
+		kind:     kind,
+		informer: informer,
+		stopCh:   make(chan struct{}),
+	}
+	c.informers[gvr] = i
+	go informer.Run(i.stopCh)
+}
+
+// Unwatch stops the informer of the resource.
+func (c *DynamicController) Unwatch(gvr schema.GroupVersionResource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.unwatch(gvr)
+}
+
+// Informer returns the informer of a watched resource.
+func (c *DynamicController) Informer(gvr schema.GroupVersionResource) (cache.SharedIndexInformer, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i, ok := c.informers[gvr]
+	if !ok {
+		return nil, fmt.Errorf("resource %s is not watched", gvr)
+	}
+
+	return i.informer, nil
+}
+
+func (c *DynamicController) unwatch(gvr schema.GroupVersionResource) {
+	i, ok := c.informers[gvr]
+	if !ok {
+		return
+	}
+
+	klog.Infof("Stopping dynamic informer for %s in namespace %q", gvr, c.namespace)
+	close(i.stopCh)
+	delete(c.informers, gvr)
+}
@@ -0,0 +1,170 @@
+package informer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"github.com/lqshow/access-kubernetes-cluster/pkg/diff"
+)
+
+// EventType is the type of change of a watched object.
+type EventType string
+
+const (
+	EventAdded   EventType = "ADDED"
+	EventUpdated EventType = "MODIFIED"
+	EventDeleted EventType = "DELETED"
+)
+
+// Event is a change of a watched object produced by the controllers.
+type Event struct {
+	Type            EventType `json:"type"`
+	Kind            string    `json:"kind"`
+	Namespace       string    `json:"namespace,omitempty"`
+	Name            string    `json:"name"`
+	UID             string    `json:"uid,omitempty"`
+	ResourceVersion string    `json:"resourceVersion,omitempty"`
+	Time            time.Time `json:"time"`
+
+	// Object is the object after the change, or the last known state of a
+	// deleted object.
+	Object runtime.Object `json:"object"`
+	// OldObject is the object before an update.
+	OldObject runtime.Object `json:"-"`
+	// Diff holds the field level changes of an update.
+	Diff []diff.Change `json:"diff,omitempty"`
+}
+
+// Key returns the namespace/name key of the object.
+func (e *Event) Key() string {
+	if e.Namespace == "" {
+		return e.Name
+	}
+
+	return e.Namespace + "/" + e.Name
+}
+
+// EventHandler is called for every event published to a Dispatcher.
+type EventHandler func(event *Event)
+
+// Dispatcher turns informer notifications into events and passes them to
+// the registered handlers. Update events carry the field level diff between
+// the old and the new object, updates that only touch ignored fields are
+// dropped.
+type Dispatcher struct {
+	differ *diff.Differ
+
+	mu       sync.RWMutex
+	handlers []EventHandler
+}
+
+// NewDispatcher creates a dispatcher computing diffs with differ.
+func NewDispatcher(differ *diff.Differ) *Dispatcher {
+	return &Dispatcher{
+		differ: differ,
+	}
+}
+
+// AddHandler registers a handler called for every event.
+func (d *Dispatcher) AddHandler(handler EventHandler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.handlers = append(d.handlers, handler)
+}
+
+// Added publishes the creation of an object and returns the event, nil is
+// returned if no event could be created.
+func (d *Dispatcher) Added(kind string, obj interface{}) *Event {
+	event, err := newEvent(EventAdded, kind, obj)
+	if err != nil {
+		klog.Errorf("Couldn't create %s event for %s: %v", EventAdded, kind, err)
+		return nil
+	}
+
+	d.Publish(event)
+	return event
+}
+
+// Updated publishes the update of an object with the diff of old and new and
+// returns the event, nil is returned if only ignored fields changed.
+func (d *Dispatcher) Updated(kind string, old, new interface{}) *Event {
+	event, err := newEvent(EventUpdated, kind, new)
+	if err != nil {
+		klog.Errorf("Couldn't create %s event for %s: %v", EventUpdated, kind, err)
+		return nil
+	}
+
+	oldObject, ok := old.(runtime.Object)
+	if !ok {
+		klog.Errorf("Couldn't diff %s %s: %T is not a runtime object", kind, event.Key(), old)
+		return nil
+	}
+	event.OldObject = oldObject
+	event.Diff, err = d.differ.Diff(oldObject, event.Object)
+	if err != nil {
+		klog.Errorf("Couldn't diff %s %s: %v", kind, event.Key(), err)
+		return nil
+	}
+	if len(event.Diff) == 0 {
+		return nil
+	}
+
+	d.Publish(event)
+	return event
+}
+
+// Deleted publishes the deletion of an object and returns the event, obj may
+// be a tombstone.
+func (d *Dispatcher) Deleted(kind string, obj interface{}) *Event {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	event, err := newEvent(EventDeleted, kind, obj)
+	if err != nil {
+		klog.Errorf("Couldn't create %s event for %s: %v", EventDeleted, kind, err)
+		return nil
+	}
+
+	d.Publish(event)
+	return event
+}
+
+// Publish passes an event to every handler.
+func (d *Dispatcher) Publish(event *Event) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	for _, handler := range d.handlers {
+		handler(event)
+	}
+}
+
+func newEvent(eventType EventType, kind string, obj interface{}) (*Event, error) {
+	object, ok := obj.(runtime.Object)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a runtime object", obj)
+	}
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Event{
+		Type:            eventType,
+		Kind:            kind,
+		Namespace:       accessor.GetNamespace(),
+		Name:            accessor.GetName(),
+		UID:             string(accessor.GetUID()),
+		ResourceVersion: accessor.GetResourceVersion(),
+		Time:            time.Now(),
+		Object:          object,
+	}, nil
+}
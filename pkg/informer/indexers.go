@@ -0,0 +1,176 @@
+package informer
+
+import (
+	"fmt"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/cache"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Names of the indexers added to the informer caches.
+const (
+	// NodeNameIndex indexes pods by spec.nodeName.
+	NodeNameIndex = "nodeName"
+	// OwnerUIDIndex indexes objects by the UIDs of their ownerReferences.
+	OwnerUIDIndex = "ownerUID"
+	// ImageIndex indexes pods and deployments by container image.
+	ImageIndex = "image"
+	// LabelIndex indexes objects by label key and by key=value.
+	LabelIndex = "label"
+	// ServiceAccountIndex indexes pods by spec.serviceAccountName.
+	ServiceAccountIndex = "serviceAccount"
+)
+
+// ObjectIndexers returns the indexers applicable to objects of any kind.
+func ObjectIndexers() cache.Indexers {
+	return cache.Indexers{
+		OwnerUIDIndex: ownerUIDIndexFunc,
+		LabelIndex:    labelIndexFunc,
+	}
+}
+
+// PodIndexers returns the indexers added to pod informers.
+func PodIndexers() cache.Indexers {
+	return cache.Indexers{
+		NodeNameIndex:       podNodeNameIndexFunc,
+		OwnerUIDIndex:       ownerUIDIndexFunc,
+		ImageIndex:          podImageIndexFunc,
+		LabelIndex:          labelIndexFunc,
+		ServiceAccountIndex: podServiceAccountIndexFunc,
+	}
+}
+
+// DeploymentIndexers returns the indexers added to deployment informers.
+func DeploymentIndexers() cache.Indexers {
+	return cache.Indexers{
+		ImageIndex: deploymentImageIndexFunc,
+		LabelIndex: labelIndexFunc,
+	}
+}
+
+func podNodeNameIndexFunc(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return nil, fmt.Errorf("expected pod but got %T", obj)
+	}
+	if pod.Spec.NodeName == "" {
+		return nil, nil
+	}
+
+	return []string{pod.Spec.NodeName}, nil
+}
+
+func podServiceAccountIndexFunc(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return nil, fmt.Errorf("expected pod but got %T", obj)
+	}
+
+	return []string{pod.Spec.ServiceAccountName}, nil
+}
+
+func podImageIndexFunc(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return nil, fmt.Errorf("expected pod but got %T", obj)
+	}
+
+	return podSpecImages(&pod.Spec), nil
+}
+
+func deploymentImageIndexFunc(obj interface{}) ([]string, error) {
+	deploy, ok := obj.(*appsv1.Deployment)
+	if !ok {
+		return nil, fmt.Errorf("expected deployment but got %T", obj)
+	}
+
+	return podSpecImages(&deploy.Spec.Template.Spec), nil
+}
+
+func ownerUIDIndexFunc(obj interface{}) ([]string, error) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	var uids []string
+	for _, owner := range accessor.GetOwnerReferences() {
+		uids = append(uids, string(owner.UID))
+	}
+
+	return uids, nil
+}
+
+func labelIndexFunc(obj interface{}) ([]string, error) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []string
+	for key, value := range accessor.GetLabels() {
+		values = append(values, key, key+"="+value)
+	}
+
+	return values, nil
+}
+
+// podSpecImages returns the distinct images of the containers and init
+// containers of a pod spec.
+func podSpecImages(spec *corev1.PodSpec) []string {
+	seen := make(map[string]bool)
+	var images []string
+	for _, containers := range [][]corev1.Container{spec.InitContainers, spec.Containers} {
+		for _, container := range containers {
+			if !seen[container.Image] {
+				seen[container.Image] = true
+				images = append(images, container.Image)
+			}
+		}
+	}
+
+	return images
+}
+
+// IndexQuery selects the objects of a cache by index name and value, an
+// object must match every criterion.
+type IndexQuery map[string]string
+
+// Query returns the keys of the objects of an indexer matching the query, in
+// key order. Every criterion is answered by its index, an empty query
+// returns every key.
+func (q IndexQuery) Query(indexer cache.Indexer) ([]string, error) {
+	if len(q) == 0 {
+		keys := indexer.ListKeys()
+		sort.Strings(keys)
+		return keys, nil
+	}
+
+	var matches map[string]bool
+	for name, value := range q {
+		keys, err := indexer.IndexKeys(name, value)
+		if err != nil {
+			return nil, err
+		}
+
+		next := make(map[string]bool, len(keys))
+		for _, key := range keys {
+			if matches == nil || matches[key] {
+				next[key] = true
+			}
+		}
+		matches = next
+	}
+
+	keys := make([]string, 0, len(matches))
+	for key := range matches {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
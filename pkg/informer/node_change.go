@@ -0,0 +1,289 @@
+package informer
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NodeChangeType is the kind of change observed on a Node.
+type NodeChangeType string
+
+const (
+	NodeAdded              NodeChangeType = "Added"
+	NodeDeleted            NodeChangeType = "Deleted"
+	NodeNotReady           NodeChangeType = "NotReady"
+	NodeRecovered          NodeChangeType = "Recovered"
+	NodeConditionChanged   NodeChangeType = "ConditionChanged"
+	NodeCordoned           NodeChangeType = "Cordoned"
+	NodeUncordoned         NodeChangeType = "Uncordoned"
+	NodeTainted            NodeChangeType = "Tainted"
+	NodeUntainted          NodeChangeType = "Untainted"
+	NodeAllocatableChanged NodeChangeType = "AllocatableChanged"
+	NodeLabelsChanged      NodeChangeType = "LabelsChanged"
+)
+
+// monitoredConditions are the node conditions whose status is diffed.
+var monitoredConditions = []corev1.NodeConditionType{
+	corev1.NodeReady,
+	corev1.NodeMemoryPressure,
+	corev1.NodeDiskPressure,
+	corev1.NodePIDPressure,
+	corev1.NodeNetworkUnavailable,
+}
+
+// ConditionChange is a status transition of a node condition.
+type ConditionChange struct {
+	Type      corev1.NodeConditionType `json:"type"`
+	OldStatus corev1.ConditionStatus   `json:"oldStatus"`
+	NewStatus corev1.ConditionStatus   `json:"newStatus"`
+	Reason    string                   `json:"reason,omitempty"`
+	Message   string                   `json:"message,omitempty"`
+	// Since is the last transition time reported by the kubelet.
+	Since time.Time `json:"since"`
+}
+
+// ValueChange is the old and new value of a label or an allocatable
+// resource, an empty value means it is absent.
+type ValueChange struct {
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+// NodeDiff is the structured difference between two versions of a Node.
+type NodeDiff struct {
+	Conditions           []ConditionChange                   `json:"conditions,omitempty"`
+	TaintsAdded          []corev1.Taint                      `json:"taintsAdded,omitempty"`
+	TaintsRemoved        []corev1.Taint                      `json:"taintsRemoved,omitempty"`
+	UnschedulableChanged bool                                `json:"unschedulableChanged,omitempty"`
+	Unschedulable        bool                                `json:"unschedulable,omitempty"`
+	Allocatable          map[corev1.ResourceName]ValueChange `json:"allocatable,omitempty"`
+	Labels               map[string]ValueChange              `json:"labels,omitempty"`
+}
+
+// Empty returns true if none of the monitored fields changed.
+func (d *NodeDiff) Empty() bool {
+	return len(d.Conditions) == 0 && len(d.TaintsAdded) == 0 && len(d.TaintsRemoved) == 0 &&
+		!d.UnschedulableChanged && len(d.Allocatable) == 0 && len(d.Labels) == 0
+}
+
+// NodeChange is a typed change of a Node, recorded in the node timeline.
+type NodeChange struct {
+	Type NodeChangeType `json:"type"`
+	Node string         `json:"node"`
+	// Time is when the change was observed by the informer.
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+
+	// Since is when the node condition transitioned, set for condition
+	// changes.
+	Since       *time.Time                          `json:"since,omitempty"`
+	Condition   *ConditionChange                    `json:"condition,omitempty"`
+	Taint       *corev1.Taint                       `json:"taint,omitempty"`
+	Allocatable map[corev1.ResourceName]ValueChange `json:"allocatable,omitempty"`
+	Labels      map[string]ValueChange              `json:"labels,omitempty"`
+}
+
+// NodeChangeHandler is called for every change of a Node.
+type NodeChangeHandler func(change NodeChange)
+
+// DiffNodes computes the difference of the monitored fields of two versions
+// of a Node.
+func DiffNodes(oldNode, newNode *corev1.Node) NodeDiff {
+	var diff NodeDiff
+
+	for _, conditionType := range monitoredConditions {
+		oldCondition := nodeCondition(oldNode, conditionType)
+		newCondition := nodeCondition(newNode, conditionType)
+		if oldCondition.Status == newCondition.Status {
+			continue
+		}
+		diff.Conditions = append(diff.Conditions, ConditionChange{
+			Type:      conditionType,
+			OldStatus: oldCondition.Status,
+			NewStatus: newCondition.Status,
+			Reason:    newCondition.Reason,
+			Message:   newCondition.Message,
+			Since:     newCondition.LastTransitionTime.Time,
+		})
+	}
+
+	diff.TaintsAdded = taintsDifference(newNode.Spec.Taints, oldNode.Spec.Taints)
+	diff.TaintsRemoved = taintsDifference(oldNode.Spec.Taints, newNode.Spec.Taints)
+
+	if oldNode.Spec.Unschedulable != newNode.Spec.Unschedulable {
+		diff.UnschedulableChanged = true
+		diff.Unschedulable = newNode.Spec.Unschedulable
+	}
+
+	for name, change := range diffStrings(quantityStrings(oldNode.Status.Allocatable), quantityStrings(newNode.Status.Allocatable)) {
+		if diff.Allocatable == nil {
+			diff.Allocatable = make(map[corev1.ResourceName]ValueChange)
+		}
+		diff.Allocatable[corev1.ResourceName(name)] = change
+	}
+
+	if labels := diffStrings(oldNode.Labels, newNode.Labels); len(labels) > 0 {
+		diff.Labels = labels
+	}
+
+	return diff
+}
+
+// Changes converts the diff into typed node changes observed at now.
+func (d *NodeDiff) Changes(node string, now time.Time) []NodeChange {
+	var changes []NodeChange
+
+	for i := range d.Conditions {
+		condition := d.Conditions[i]
+		change := NodeChange{
+			Type:      NodeConditionChanged,
+			Node:      node,
+			Time:      now,
+			Since:     &condition.Since,
+			Condition: &condition,
+			Message: fmt.Sprintf("condition %s changed from %s to %s: %s",
+				condition.Type, statusOrUnknown(condition.OldStatus), statusOrUnknown(condition.NewStatus), condition.Reason),
+		}
+		if condition.Type == corev1.NodeReady {
+			if condition.NewStatus == corev1.ConditionTrue {
+				change.Type = NodeRecovered
+				change.Message = fmt.Sprintf("node is Ready since %s", condition.Since.Format(time.RFC3339))
+			} else {
+				change.Type = NodeNotReady
+				change.Message = fmt.Sprintf("node is NotReady (%s) since %s: %s",
+					statusOrUnknown(condition.NewStatus), condition.Since.Format(time.RFC3339), condition.Message)
+			}
+		}
+		changes = append(changes, change)
+	}
+
+	if d.UnschedulableChanged {
+		change := NodeChange{Type: NodeUncordoned, Node: node, Time: now, Message: "node is schedulable"}
+		if d.Unschedulable {
+			change.Type = NodeCordoned
+			change.Message = "node is unschedulable"
+		}
+		changes = append(changes, change)
+	}
+
+	for i := range d.TaintsAdded {
+		taint := d.TaintsAdded[i]
+		changes = append(changes, NodeChange{
+			Type: NodeTainted, Node: node, Time: now, Taint: &taint,
+			Message: fmt.Sprintf("taint %s added", taint.ToString()),
+		})
+	}
+	for i := range d.TaintsRemoved {
+		taint := d.TaintsRemoved[i]
+		changes = append(changes, NodeChange{
+			Type: NodeUntainted, Node: node, Time: now, Taint: &taint,
+			Message: fmt.Sprintf("taint %s removed", taint.ToString()),
+		})
+	}
+
+	if len(d.Allocatable) > 0 {
+		changes = append(changes, NodeChange{
+			Type: NodeAllocatableChanged, Node: node, Time: now, Allocatable: d.Allocatable,
+			Message: fmt.Sprintf("allocatable changed: %s", formatValueChanges(d.Allocatable)),
+		})
+	}
+
+	if len(d.Labels) > 0 {
+		changes = append(changes, NodeChange{
+			Type: NodeLabelsChanged, Node: node, Time: now, Labels: d.Labels,
+			Message: fmt.Sprintf("labels changed: %s", formatValueChanges(d.Labels)),
+		})
+	}
+
+	return changes
+}
+
+// nodeCondition returns the condition of the given type, a zero condition
+// is returned if the node doesn't report it.
+func nodeCondition(node *corev1.Node, conditionType corev1.NodeConditionType) corev1.NodeCondition {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == conditionType {
+			return condition
+		}
+	}
+
+	return corev1.NodeCondition{Type: conditionType}
+}
+
+// nodeReadyStatus returns the status of the Ready condition of a node.
+func nodeReadyStatus(node *corev1.Node) corev1.ConditionStatus {
+	return statusOrUnknown(nodeCondition(node, corev1.NodeReady).Status)
+}
+
+func statusOrUnknown(status corev1.ConditionStatus) corev1.ConditionStatus {
+	if status == "" {
+		return corev1.ConditionUnknown
+	}
+
+	return status
+}
+
+// taintsDifference returns the taints of a that are not in b.
+func taintsDifference(a, b []corev1.Taint) []corev1.Taint {
+	var taints []corev1.Taint
+	for i := range a {
+		found := false
+		for j := range b {
+			if a[i].MatchTaint(&b[j]) && a[i].Value == b[j].Value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			taints = append(taints, a[i])
+		}
+	}
+
+	return taints
+}
+
+func quantityStrings(resources corev1.ResourceList) map[string]string {
+	values := make(map[string]string, len(resources))
+	for name, quantity := range resources {
+		values[string(name)] = quantity.String()
+	}
+
+	return values
+}
+
+// diffStrings returns the keys whose values differ between old and new.
+func diffStrings(oldValues, newValues map[string]string) map[string]ValueChange {
+	changes := make(map[string]ValueChange)
+	for key, oldValue := range oldValues {
+		if newValue, ok := newValues[key]; !ok || newValue != oldValue {
+			changes[key] = ValueChange{Old: oldValue, New: newValue}
+		}
+	}
+	for key, newValue := range newValues {
+		if _, ok := oldValues[key]; !ok {
+			changes[key] = ValueChange{New: newValue}
+		}
+	}
+
+	return changes
+}
+
+func formatValueChanges(changes interface{}) string {
+	var parts []string
+	switch changes := changes.(type) {
+	case map[string]ValueChange:
+		for key, change := range changes {
+			parts = append(parts, fmt.Sprintf("%s=%q->%q", key, change.Old, change.New))
+		}
+	case map[corev1.ResourceName]ValueChange:
+		for key, change := range changes {
+			parts = append(parts, fmt.Sprintf("%s=%q->%q", key, change.Old, change.New))
+		}
+	}
+	sort.Strings(parts)
+
+	return fmt.Sprint(parts)
+}
@@ -2,6 +2,8 @@ package informer
 
 import (
 	"fmt"
+	"sync"
+	"time"
 
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/informers"
@@ -12,10 +14,19 @@ import (
 	corelisters "k8s.io/client-go/listers/core/v1"
 )
 
+// NodeController diffs node conditions, taints, schedulability, allocatable
+// resources and labels, and records the resulting changes in a timeline.
 type NodeController struct {
 	nodeLister corelisters.NodeLister
 
 	informer cache.SharedIndexInformer
+
+	timeline *NodeTimeline
+	// dispatcher publishes the changes of nodes to the event handlers.
+	dispatcher *Dispatcher
+
+	mu       sync.RWMutex
+	handlers []NodeChangeHandler
 }
 
 // Run starts shared informers and waits for the shared informer cache to
@@ -32,6 +43,29 @@ func (c *NodeController) Run(stopCh <-chan struct{}) error {
 	return nil
 }
 
+// HasSynced returns true once the informer cache has been synchronized.
+func (c *NodeController) HasSynced() bool {
+	return c.informer.HasSynced()
+}
+
+// Indexer returns the cache of the nodes.
+func (c *NodeController) Indexer() cache.Indexer {
+	return c.informer.GetIndexer()
+}
+
+// Timeline returns the timeline of node changes.
+func (c *NodeController) Timeline() *NodeTimeline {
+	return c.timeline
+}
+
+// AddChangeHandler registers a handler called for every node change.
+func (c *NodeController) AddChangeHandler(handler NodeChangeHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.handlers = append(c.handlers, handler)
+}
+
 func (c *NodeController) List() error {
 	// List lists all Nodes in the indexer.
 	nodeList, err := c.nodeLister.List(labels.Everything())
@@ -40,16 +74,35 @@ func (c *NodeController) List() error {
 	}
 
 	for _, node := range nodeList {
-		klog.Infof("Got node detail info, name: %s, status: %v, labels: %v", node.Name, node.Status.Phase, node.Labels)
+		klog.Infof("Got node detail info, name: %s, ready: %v, unschedulable: %v, labels: %v",
+			node.Name, nodeReadyStatus(node), node.Spec.Unschedulable, node.Labels)
 	}
 
 	return nil
 }
 
+// emit records a change in the timeline and passes it to the handlers.
+func (c *NodeController) emit(change NodeChange) {
+	klog.Infof("NODE %s: %s %s", change.Type, change.Node, change.Message)
+	c.timeline.Add(change)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, handler := range c.handlers {
+		handler(change)
+	}
+}
+
 func (c *NodeController) onAdd(obj interface{}) {
 	node := obj.(*corev1.Node)
+	c.dispatcher.Added("Node", obj)
 
-	klog.Infof("NODE CREATED: %s", node.Name)
+	c.emit(NodeChange{
+		Type:    NodeAdded,
+		Node:    node.Name,
+		Time:    time.Now(),
+		Message: fmt.Sprintf("node added, ready: %v, unschedulable: %v", nodeReadyStatus(node), node.Spec.Unschedulable),
+	})
 }
 
 func (c *NodeController) onUpdate(old, new interface{}) {
@@ -58,15 +111,46 @@ func (c *NodeController) onUpdate(old, new interface{}) {
 	if oldNode.ResourceVersion == newNode.ResourceVersion {
 		return
 	}
+	c.dispatcher.Updated("Node", old, new)
 
-	klog.Info("NODE UPDATED: not implemented")
+	// most updates are kubelet heartbeats which don't change any of the
+	// monitored fields.
+	diff := DiffNodes(oldNode, newNode)
+	if diff.Empty() {
+		return
+	}
+
+	for _, change := range diff.Changes(newNode.Name, time.Now()) {
+		c.emit(change)
+	}
 }
 
 func (c *NodeController) onDelete(obj interface{}) {
-	klog.Info("NODE UPDATED: not implemented")
+	c.dispatcher.Deleted("Node", obj)
+
+	node, ok := obj.(*corev1.Node)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			klog.Errorf("Couldn't get object from tombstone %#v", obj)
+			return
+		}
+		node, ok = tombstone.Obj.(*corev1.Node)
+		if !ok {
+			klog.Errorf("Tombstone contained object that is not a Node %#v", obj)
+			return
+		}
+	}
+
+	c.emit(NodeChange{
+		Type:    NodeDeleted,
+		Node:    node.Name,
+		Time:    time.Now(),
+		Message: "node deleted",
+	})
 }
 
-func NewNodeController(informerFactory informers.SharedInformerFactory) *NodeController {
+func NewNodeController(informerFactory informers.SharedInformerFactory, timelineSize int, timelineRetention time.Duration, dispatcher *Dispatcher) *NodeController {
 	// node informer
 	nodeInformer := informerFactory.Core().V1().Nodes()
 	// create informer
@@ -77,6 +161,8 @@ func NewNodeController(informerFactory informers.SharedInformerFactory) *NodeCon
 	c := &NodeController{
 		informer:   informer,
 		nodeLister: nodeLister,
+		timeline:   NewNodeTimeline(timelineSize, timelineRetention),
+		dispatcher: dispatcher,
 	}
 
 	klog.Info("Setting up custom resource event handlers.")
@@ -0,0 +1,108 @@
+package informer
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultNodeTimelineSize is the number of changes kept per node.
+	DefaultNodeTimelineSize = 100
+	// DefaultNodeTimelineRetention is the time the timeline of a deleted
+	// node is kept.
+	DefaultNodeTimelineRetention = time.Hour
+)
+
+// NodeTimeline keeps the most recent changes of every node, the timeline of a
+// deleted node is kept for the retention so its last moments can be
+// inspected.
+type NodeTimeline struct {
+	size      int
+	retention time.Duration
+
+	mu      sync.RWMutex
+	changes map[string][]NodeChange
+	// deleted holds the time deleted nodes were deleted at.
+	deleted map[string]time.Time
+}
+
+// NewNodeTimeline creates a timeline keeping up to size changes per node, and
+// the timelines of deleted nodes for retention.
+func NewNodeTimeline(size int, retention time.Duration) *NodeTimeline {
+	if size <= 0 {
+		size = DefaultNodeTimelineSize
+	}
+	if retention <= 0 {
+		retention = DefaultNodeTimelineRetention
+	}
+
+	return &NodeTimeline{
+		size:      size,
+		retention: retention,
+		changes:   make(map[string][]NodeChange),
+		deleted:   make(map[string]time.Time),
+	}
+}
+
+// Add appends a change to the timeline of its node, dropping the oldest
+// change once the timeline is full. The timelines of the nodes deleted more
+// than the retention before the change are dropped.
+func (t *NodeTimeline) Add(change NodeChange) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	changes := append(t.changes[change.Node], change)
+	if len(changes) > t.size {
+		changes = changes[len(changes)-t.size:]
+	}
+	t.changes[change.Node] = changes
+
+	if change.Type == NodeDeleted {
+		t.deleted[change.Node] = change.Time
+	} else {
+		// a node recreated with the same name.
+		delete(t.deleted, change.Node)
+	}
+	for node, deleted := range t.deleted {
+		if change.Time.Sub(deleted) > t.retention {
+			delete(t.changes, node)
+			delete(t.deleted, node)
+		}
+	}
+}
+
+// Get returns the changes of a node observed after since, oldest first.
+func (t *NodeTimeline) Get(node string, since time.Time) []NodeChange {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return changesSince(t.changes[node], since)
+}
+
+// List returns the changes of all nodes observed after since, oldest first.
+func (t *NodeTimeline) List(since time.Time) []NodeChange {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var changes []NodeChange
+	for _, nodeChanges := range t.changes {
+		changes = append(changes, changesSince(nodeChanges, since)...)
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Time.Before(changes[j].Time)
+	})
+
+	return changes
+}
+
+func changesSince(changes []NodeChange, since time.Time) []NodeChange {
+	result := make([]NodeChange, 0, len(changes))
+	for _, change := range changes {
+		if change.Time.After(since) {
+			result = append(result, change)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,34 @@
+package informer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNodeTimelineDropsDeletedNodesAfterRetention(t *testing.T) {
+	timeline := NewNodeTimeline(2, time.Hour)
+	start := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	timeline.Add(NodeChange{Node: "node-a", Type: NodeAdded, Time: start})
+	timeline.Add(NodeChange{Node: "node-a", Type: NodeNotReady, Time: start.Add(time.Minute)})
+	timeline.Add(NodeChange{Node: "node-a", Type: NodeDeleted, Time: start.Add(2 * time.Minute)})
+	if changes := timeline.Get("node-a", time.Time{}); len(changes) != 2 || changes[1].Type != NodeDeleted {
+		t.Fatalf("changes = %v, want the 2 most recent", changes)
+	}
+
+	// a node recreated with the same name keeps its timeline.
+	timeline.Add(NodeChange{Node: "node-b", Type: NodeDeleted, Time: start.Add(3 * time.Minute)})
+	timeline.Add(NodeChange{Node: "node-b", Type: NodeAdded, Time: start.Add(4 * time.Minute)})
+
+	timeline.Add(NodeChange{Node: "node-c", Type: NodeAdded, Time: start.Add(time.Hour)})
+	if changes := timeline.Get("node-a", time.Time{}); len(changes) != 2 {
+		t.Fatalf("changes = %v, want node-a kept within the retention", changes)
+	}
+	timeline.Add(NodeChange{Node: "node-c", Type: NodeCordoned, Time: start.Add(2 * time.Hour)})
+	if changes := timeline.Get("node-a", time.Time{}); len(changes) != 0 {
+		t.Errorf("changes = %v, want node-a dropped after the retention", changes)
+	}
+	if changes := timeline.Get("node-b", time.Time{}); len(changes) != 2 {
+		t.Errorf("changes = %v, want the recreated node-b kept", changes)
+	}
+}
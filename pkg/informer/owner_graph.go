@@ -0,0 +1,326 @@
+package informer
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ObjectRef identifies an object of the ownership graph.
+type ObjectRef struct {
+	APIVersion string    `json:"apiVersion,omitempty"`
+	Kind       string    `json:"kind"`
+	Namespace  string    `json:"namespace,omitempty"`
+	Name       string    `json:"name"`
+	UID        types.UID `json:"uid"`
+}
+
+func (r ObjectRef) String() string {
+	if r.Namespace == "" {
+		return r.Kind + " " + r.Name
+	}
+
+	return r.Kind + " " + r.Namespace + "/" + r.Name
+}
+
+// ObjectReference returns a reference Kubernetes Events can be recorded
+// against.
+func (r ObjectRef) ObjectReference() *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		APIVersion: r.APIVersion,
+		Kind:       r.Kind,
+		Namespace:  r.Namespace,
+		Name:       r.Name,
+		UID:        r.UID,
+	}
+}
+
+// ownerNode is an object of the graph with the edges to its owners and
+// dependents.
+type ownerNode struct {
+	ref ObjectRef
+	// observed is false for owners only known from the ownerReferences of
+	// their dependents.
+	observed   bool
+	owners     []types.UID
+	controller types.UID
+	dependents map[types.UID]struct{}
+}
+
+// OwnerGraph is an in-memory graph of the ownerReferences of the objects in
+// the informer caches, e.g. Pod -> ReplicaSet -> Deployment or Job ->
+// CronJob. Owners that are not watched are kept as long as one of their
+// dependents is.
+type OwnerGraph struct {
+	mu    sync.RWMutex
+	nodes map[types.UID]*ownerNode
+	// uids indexes the nodes by kind/namespace/name.
+	uids map[string]types.UID
+}
+
+// NewOwnerGraph creates an empty graph.
+func NewOwnerGraph() *OwnerGraph {
+	return &OwnerGraph{
+		nodes: make(map[types.UID]*ownerNode),
+		uids:  make(map[string]types.UID),
+	}
+}
+
+// HandleEvent keeps the graph up to date with the events of a Dispatcher.
+// The dependents of a deleted object are logged as they are garbage
+// collected in cascade.
+func (g *OwnerGraph) HandleEvent(event *Event) {
+	if event.Type != EventDeleted {
+		g.Set(event.Object)
+		return
+	}
+
+	if dependents := g.Descendants(types.UID(event.UID)); len(dependents) > 0 {
+		klog.Infof("%s %s deleted, cascades to %d dependents: %v", event.Kind, event.Key(), len(dependents), dependents)
+	}
+	g.Remove(event.Object)
+}
+
+// ResourceEventHandler returns a handler keeping the graph up to date with
+// an informer whose objects are not published to a Dispatcher.
+func (g *OwnerGraph) ResourceEventHandler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: g.Set,
+		UpdateFunc: func(old, new interface{}) {
+			g.Set(new)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			g.Remove(obj)
+		},
+	}
+}
+
+// Set adds or updates an object and the edges to its owners.
+func (g *OwnerGraph) Set(obj interface{}) {
+	ref, accessor, err := objectRef(obj)
+	if err != nil {
+		klog.Errorf("Couldn't add %T to the owner graph: %v", obj, err)
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	n := g.node(ref)
+	n.ref = ref
+	n.observed = true
+	g.detachOwners(n)
+	for _, owner := range accessor.GetOwnerReferences() {
+		o := g.node(ObjectRef{
+			APIVersion: owner.APIVersion,
+			Kind:       owner.Kind,
+			Namespace:  ref.Namespace,
+			Name:       owner.Name,
+			UID:        owner.UID,
+		})
+		o.dependents[ref.UID] = struct{}{}
+		n.owners = append(n.owners, owner.UID)
+		if owner.Controller != nil && *owner.Controller {
+			n.controller = owner.UID
+		}
+	}
+}
+
+// Remove removes an object, it is kept as an unobserved owner while it still
+// has dependents.
+func (g *OwnerGraph) Remove(obj interface{}) {
+	ref, _, err := objectRef(obj)
+	if err != nil {
+		klog.Errorf("Couldn't remove %T from the owner graph: %v", obj, err)
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	n, ok := g.nodes[ref.UID]
+	if !ok {
+		return
+	}
+	n.observed = false
+	g.detachOwners(n)
+	g.prune(n)
+}
+
+// Lookup returns the object of a kind with a namespace and name.
+func (g *OwnerGraph) Lookup(kind, namespace, name string) (ObjectRef, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	uid, ok := g.uids[ownerGraphKey(kind, namespace, name)]
+	if !ok {
+		return ObjectRef{}, false
+	}
+
+	return g.nodes[uid].ref, true
+}
+
+// Ancestors returns the owners of an object, their owners and so on, the
+// closest owners first.
+func (g *OwnerGraph) Ancestors(uid types.UID) []ObjectRef {
+	return g.walk(uid, func(n *ownerNode) []types.UID {
+		return n.owners
+	})
+}
+
+// Descendants returns the dependents of an object, their dependents and so
+// on, the closest dependents first. These are the objects garbage collected
+// in cascade when the object is deleted.
+func (g *OwnerGraph) Descendants(uid types.UID) []ObjectRef {
+	return g.walk(uid, func(n *ownerNode) []types.UID {
+		uids := make([]types.UID, 0, len(n.dependents))
+		for dependent := range n.dependents {
+			uids = append(uids, dependent)
+		}
+		sort.Slice(uids, func(i, j int) bool {
+			return uids[i] < uids[j]
+		})
+		return uids
+	})
+}
+
+// Root follows the controller references of an object up to the top-most
+// controller, e.g. the Deployment of a Pod. false is returned if the object
+// has no controller.
+func (g *OwnerGraph) Root(uid types.UID) (ObjectRef, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var root ObjectRef
+	found := false
+	seen := map[types.UID]bool{uid: true}
+	n, ok := g.nodes[uid]
+	for ok && n.controller != "" && !seen[n.controller] {
+		seen[n.controller] = true
+		if n, ok = g.nodes[n.controller]; ok {
+			root, found = n.ref, true
+		}
+	}
+
+	return root, found
+}
+
+// walk visits the graph breadth first from an object, excluding it.
+func (g *OwnerGraph) walk(uid types.UID, next func(n *ownerNode) []types.UID) []ObjectRef {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var refs []ObjectRef
+	seen := map[types.UID]bool{uid: true}
+	queue := []types.UID{uid}
+	for len(queue) > 0 {
+		n, ok := g.nodes[queue[0]]
+		queue = queue[1:]
+		if !ok {
+			continue
+		}
+		for _, u := range next(n) {
+			if seen[u] {
+				continue
+			}
+			seen[u] = true
+			if m, ok := g.nodes[u]; ok {
+				refs = append(refs, m.ref)
+				queue = append(queue, u)
+			}
+		}
+	}
+
+	return refs
+}
+
+// node returns the node of an object, an unobserved node is created if the
+// object is unknown. The caller must hold g.mu.
+func (g *OwnerGraph) node(ref ObjectRef) *ownerNode {
+	n, ok := g.nodes[ref.UID]
+	if !ok {
+		n = &ownerNode{
+			ref:        ref,
+			dependents: make(map[types.UID]struct{}),
+		}
+		g.nodes[ref.UID] = n
+		g.uids[ownerGraphKey(ref.Kind, ref.Namespace, ref.Name)] = ref.UID
+	}
+
+	return n
+}
+
+// detachOwners removes the edges to the owners of a node. The caller must
+// hold g.mu.
+func (g *OwnerGraph) detachOwners(n *ownerNode) {
+	for _, uid := range n.owners {
+		if owner, ok := g.nodes[uid]; ok {
+			delete(owner.dependents, n.ref.UID)
+			g.prune(owner)
+		}
+	}
+	n.owners = nil
+	n.controller = ""
+}
+
+// prune removes a node that is neither observed nor owns observed objects.
+// The caller must hold g.mu.
+func (g *OwnerGraph) prune(n *ownerNode) {
+	if n.observed || len(n.dependents) > 0 {
+		return
+	}
+
+	delete(g.nodes, n.ref.UID)
+	key := ownerGraphKey(n.ref.Kind, n.ref.Namespace, n.ref.Name)
+	if g.uids[key] == n.ref.UID {
+		delete(g.uids, key)
+	}
+}
+
+func ownerGraphKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+// objectRef returns the reference of an object, the kind of typed objects
+// whose type meta isn't set is looked up in the client-go scheme.
+func objectRef(obj interface{}) (ObjectRef, metav1.Object, error) {
+	object, ok := obj.(runtime.Object)
+	if !ok {
+		return ObjectRef{}, nil, fmt.Errorf("%T is not a runtime object", obj)
+	}
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return ObjectRef{}, nil, err
+	}
+
+	gvk := object.GetObjectKind().GroupVersionKind()
+	if gvk.Kind == "" {
+		gvks, _, err := scheme.Scheme.ObjectKinds(object)
+		if err != nil {
+			return ObjectRef{}, nil, err
+		}
+		gvk = gvks[0]
+	}
+
+	apiVersion, kind := gvk.ToAPIVersionAndKind()
+	return ObjectRef{
+		APIVersion: apiVersion,
+		Kind:       kind,
+		Namespace:  accessor.GetNamespace(),
+		Name:       accessor.GetName(),
+		UID:        accessor.GetUID(),
+	}, accessor, nil
+}
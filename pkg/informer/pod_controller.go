@@ -2,13 +2,20 @@ package informer
 
 import (
 	"fmt"
+	"time"
+
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 
+	"github.com/lqshow/access-kubernetes-cluster/pkg/diff"
+	"github.com/lqshow/access-kubernetes-cluster/pkg/metrics"
+
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	//coreinformers "k8s.io/client-go/informers/core/v1"
 	corelisters "k8s.io/client-go/listers/core/v1"
@@ -22,12 +29,33 @@ type PodController struct {
 	informer cache.SharedIndexInformer
 	indexer  cache.Indexer
 
+	// recorder is an event recorder for recording Event resources to the
+	// Kubernetes API.
+	recorder record.EventRecorder
+	// dispatcher publishes the changes of pods to the event handlers.
+	dispatcher *Dispatcher
+	// owners reports failed pods against their top-most controller, it may
+	// be nil.
+	owners *OwnerGraph
+	// health analyzes the container statuses of reconciled pods, it may be
+	// nil.
+	health *PodHealthAnalyzer
+	// gc collects finished pods, it may be nil.
+	gc *PodGarbageCollector
+	// gcScope hands the pods to the gc with the informer of the Jobs of the
+	// namespace, the gc keeps the pods of running Jobs. Its Done channel is
+	// closed when the controller is stopped.
+	gcScope *PodGCScope
+	done    chan struct{}
+
 	// workqueue is a rate limited work queue. This is used to queue work to be
 	// processed instead of performing it as soon as a change happens. This
 	// means we can ensure we only process a fixed amount of resources at a
 	// time, and makes it easy to ensure we are never processing the same item
 	// simultaneously in two different workers.
 	workqueue workqueue.RateLimitingInterface
+	// queueName names the work queue in the metrics, per namespace.
+	queueName string
 }
 
 // Run starts shared informers and waits for the shared informer cache to
@@ -35,6 +63,13 @@ type PodController struct {
 func (c *PodController) Run(stopCh <-chan struct{}) error {
 	// run starts and runs the shared informer
 	go c.informer.Run(stopCh)
+	// shut down the workqueue so the workers return once we are stopped
+	go func() {
+		<-stopCh
+		c.workqueue.ShutDown()
+		close(c.done)
+		metrics.ForgetWorkQueue(c.queueName)
+	}()
 
 	// wait for the initial synchronization of the local cache.
 	klog.Info("Waiting for informer caches to sync.")
@@ -45,36 +80,81 @@ func (c *PodController) Run(stopCh <-chan struct{}) error {
 	return nil
 }
 
+// HasSynced returns true once the informer cache has been synchronized.
+func (c *PodController) HasSynced() bool {
+	return c.informer.HasSynced()
+}
+
+// Indexer returns the indexed cache of the pods, see PodIndexers.
+func (c *PodController) Indexer() cache.Indexer {
+	return c.indexer
+}
+
+// RunWorker is a long-running function that will continually call the
+// processNextWorkItem function in order to read and process a message on the
+// workqueue.
 func (c *PodController) RunWorker() {
-	workFunc := func() bool {
-		// Wait until there is a new item in the working queue
-		key, shutdown := c.workqueue.Get()
-		if shutdown {
-			return false
-		}
-		defer c.workqueue.Done(key)
+	for c.processNextWorkItem() {
+	}
+}
 
-		obj, exists, err := c.indexer.GetByKey(key.(string))
-		if err != nil {
-			klog.Errorf("Fetching object with key %s from store failed with %v", key, err)
-			return false
-		}
+// processNextWorkItem waits until there is a new item in the working queue and
+// processes it, it returns false once the workqueue has been shut down.
+func (c *PodController) processNextWorkItem() bool {
+	key, shutdown := c.workqueue.Get()
+	if shutdown {
+		klog.Infof("pod worker shutting down.")
+		return false
+	}
+	defer c.workqueue.Done(key)
 
-		if !exists {
-			klog.Infof("Pod %s does not exist anymore", key)
-			return false
+	obj, exists, err := c.indexer.GetByKey(key.(string))
+	metrics.ObserveReconcile("pods", err)
+	if err != nil {
+		klog.Errorf("Fetching object with key %s from store failed with %v", key, err)
+		return true
+	}
+	c.workqueue.Forget(key)
+
+	if !exists {
+		klog.Infof("Pod %s does not exist anymore", key)
+		if c.health != nil {
+			if namespace, name, err := cache.SplitMetaNamespaceKey(key.(string)); err == nil {
+				c.health.Forget(namespace, name)
+			}
+		}
+		if c.gc != nil {
+			c.gc.Forget(key.(string))
 		}
-
-		klog.Infof("Sync/Add/Update for Pod %s, phase: %v", obj.(*corev1.Pod).GetName(), obj.(*corev1.Pod).Status.Phase)
 		return true
 	}
 
-	for {
-		if shutdown := workFunc(); shutdown {
-			klog.Infof("pod worker shutting down.")
-			return
+	pod := obj.(*corev1.Pod)
+	klog.Infof("Sync/Add/Update for Pod %s, phase: %v", pod.GetName(), pod.Status.Phase)
+	if c.health != nil {
+		now := time.Now()
+		c.health.Analyze(pod, now)
+		if wait, ok := c.health.RecheckAfter(pod, now); ok {
+			c.workqueue.AddAfter(key, wait)
 		}
 	}
+	if c.gc != nil {
+		c.gc.Collect(pod, c.gcScope)
+	}
+
+	return true
+}
+
+// recordFailed records a PodFailed Event on a pod that just failed and on the
+// root owner of the pod.
+func (c *PodController) recordFailed(pod *corev1.Pod) {
+	c.recorder.Eventf(pod, corev1.EventTypeWarning, "PodFailed", "Pod failed: %s %s", pod.Status.Reason, pod.Status.Message)
+	if c.owners == nil {
+		return
+	}
+	if owner, ok := c.owners.Root(pod.UID); ok {
+		c.recorder.Eventf(owner.ObjectReference(), corev1.EventTypeWarning, "PodFailed", "Pod %s failed: %s %s", pod.Name, pod.Status.Reason, pod.Status.Message)
+	}
 }
 
 func (c *PodController) List() error {
@@ -103,6 +183,14 @@ func (c *PodController) enqueue(obj interface{}) {
 	c.workqueue.AddRateLimited(key)
 }
 
+// EnqueueAll puts the key of every Pod in the informer cache onto the work
+// queue, it is used to periodically reconcile all Pods.
+func (c *PodController) EnqueueAll() {
+	for _, key := range c.indexer.ListKeys() {
+		c.workqueue.Add(key)
+	}
+}
+
 func (c *PodController) enqueueForDelete(obj interface{}) {
 	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
 	if err != nil {
@@ -117,6 +205,7 @@ func (c *PodController) onAdd(obj interface{}) {
 	pod := obj.(*corev1.Pod)
 
 	c.enqueue(obj)
+	c.dispatcher.Added("Pod", obj)
 
 	klog.Infof("POD CREATED: %s/%s", pod.Namespace, pod.Name)
 }
@@ -125,42 +214,69 @@ func (c *PodController) onUpdate(old, new interface{}) {
 	oldPod := old.(*corev1.Pod)
 	newPod := new.(*corev1.Pod)
 	if oldPod.ResourceVersion == newPod.ResourceVersion {
+		// Periodic resync will send update events for all known Pods, they
+		// are reconciled but not reported as changes.
+		c.enqueue(new)
 		return
 	}
 
 	c.enqueue(new)
+	// the failure is recorded once, on the transition into the Failed phase.
+	if oldPod.Status.Phase != corev1.PodFailed && newPod.Status.Phase == corev1.PodFailed {
+		c.recordFailed(newPod)
+	}
 
+	event := c.dispatcher.Updated("Pod", old, new)
+	if event == nil {
+		return
+	}
 	klog.Infof(
-		"POD UPDATED. %s/%s %s",
-		oldPod.Namespace, oldPod.Name, newPod.Status.Phase,
+		"POD UPDATED. %s/%s %s: %s",
+		oldPod.Namespace, oldPod.Name, newPod.Status.Phase, diff.Summary(event.Diff),
 	)
 }
 
 func (c *PodController) onDelete(obj interface{}) {
-	pod := obj.(*corev1.Pod)
-
 	c.enqueueForDelete(obj)
 
-	klog.Infof("POD DELETED: %s/%s", pod.Namespace, pod.Name)
+	if event := c.dispatcher.Deleted("Pod", obj); event != nil {
+		klog.Infof("POD DELETED: %s", event.Key())
+	}
 }
 
-func NewPodController(informerFactory informers.SharedInformerFactory) *PodController {
+// NewPodController creates the controller of the pods of a namespace, all
+// namespaces when it is empty. jobs is only needed with a gc, which then
+// keeps the pods of running Jobs.
+func NewPodController(namespace string, informerFactory informers.SharedInformerFactory, recorder record.EventRecorder, dispatcher *Dispatcher, owners *OwnerGraph, health *PodHealthAnalyzer, gc *PodGarbageCollector, jobs cache.SharedIndexInformer) *PodController {
+	queueName := workQueueName("pods", namespace)
 	// pod informer
 	podInformer := informerFactory.Core().V1().Pods()
 	// create informer
 	informer := podInformer.Informer()
+	if err := informer.AddIndexers(PodIndexers()); err != nil {
+		runtime.HandleError(fmt.Errorf("failed to add pod indexers: %v", err))
+	}
 	// create pod lister
 	podLister := podInformer.Lister()
 
 	c := &PodController{
-		informer:  informer,
-		indexer:   informer.GetIndexer(),
-		podLister: podLister,
+		informer:   informer,
+		indexer:    informer.GetIndexer(),
+		podLister:  podLister,
+		recorder:   recorder,
+		dispatcher: dispatcher,
+		owners:     owners,
+		health:     health,
+		gc:         gc,
+		done:       make(chan struct{}),
 
 		// create the workqueue
-		workqueue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "pods"),
+		workqueue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), queueName),
+		queueName: queueName,
 	}
 
+	c.gcScope = &PodGCScope{Indexer: c.indexer, Jobs: jobs, Done: c.done}
+
 	klog.Info("Setting up custom resource event handlers.")
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		// Called on creation
@@ -170,6 +286,41 @@ func NewPodController(informerFactory informers.SharedInformerFactory) *PodContr
 		// Called on resource deletion.
 		DeleteFunc: c.onDelete,
 	})
+	if gc != nil && jobs != nil {
+		jobs.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			UpdateFunc: c.onJobUpdate,
+		})
+	}
 
 	return c
 }
+
+// onJobUpdate hands the pods of a Job that just completed or failed to the
+// gc, they were kept while it ran.
+func (c *PodController) onJobUpdate(old, new interface{}) {
+	oldJob, newJob := old.(*batchv1.Job), new.(*batchv1.Job)
+	if jobDone(oldJob) || !jobDone(newJob) {
+		return
+	}
+
+	objs, err := c.indexer.ByIndex(OwnerUIDIndex, string(newJob.UID))
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	for _, obj := range objs {
+		if pod, ok := obj.(*corev1.Pod); ok {
+			c.gc.Collect(pod, c.gcScope)
+		}
+	}
+}
+
+// workQueueName names the work queue of a resource in a namespace, so the
+// queues of the namespace scopes have metrics of their own.
+func workQueueName(resource, namespace string) string {
+	if namespace == "" {
+		return resource
+	}
+
+	return resource + "/" + namespace
+}
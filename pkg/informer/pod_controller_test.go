@@ -0,0 +1,85 @@
+package informer
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/lqshow/access-kubernetes-cluster/pkg/diff"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestDispatcher(t *testing.T) *Dispatcher {
+	differ, err := diff.NewDiffer(nil)
+	if err != nil {
+		t.Fatalf("NewDiffer: %v", err)
+	}
+
+	return NewDispatcher(differ)
+}
+
+// expectEvents asserts the Events recorded by a FakeRecorder, each given as
+// "<type> <reason>".
+func expectEvents(t *testing.T, recorder *record.FakeRecorder, want ...string) {
+	t.Helper()
+
+	var got []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			fields := strings.SplitN(event, " ", 3)
+			got = append(got, strings.Join(fields[:2], " "))
+			continue
+		default:
+		}
+		break
+	}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Fatalf("events = %q, want %q", got, want)
+	}
+}
+
+func newTestPodController(t *testing.T, recorder record.EventRecorder, health *PodHealthAnalyzer) *PodController {
+	factory := informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0)
+	c := NewPodController("default", factory, recorder, newTestDispatcher(t), nil, health, nil, nil)
+	t.Cleanup(c.workqueue.ShutDown)
+
+	return c
+}
+
+func testPod(name, resourceVersion string, phase corev1.PodPhase) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            name,
+			UID:             types.UID("uid-" + name),
+			ResourceVersion: resourceVersion,
+		},
+		Status: corev1.PodStatus{Phase: phase},
+	}
+}
+
+func TestPodControllerRecordsFailureOnTransition(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	c := newTestPodController(t, recorder, nil)
+
+	running := testPod("job-1", "1", corev1.PodRunning)
+	failed := testPod("job-1", "2", corev1.PodFailed)
+	failed.Status.Reason = "Error"
+	c.onUpdate(running, failed)
+	expectEvents(t, recorder, "Warning PodFailed")
+
+	// a failed pod updated again, or resynced, is not reported again.
+	stillFailed := testPod("job-1", "3", corev1.PodFailed)
+	stillFailed.Status.Reason = "Error"
+	stillFailed.Status.Message = "exit code 1"
+	c.onUpdate(failed, stillFailed)
+	c.onUpdate(stillFailed, stillFailed)
+	expectEvents(t, recorder)
+}
@@ -0,0 +1,400 @@
+package informer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	"github.com/lqshow/access-kubernetes-cluster/pkg/metrics"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ReasonPodCollected is the Event reason of a finished pod deleted by the
+// garbage collector.
+const ReasonPodCollected = "PodCollected"
+
+// PodGCOptions configures a PodGarbageCollector.
+type PodGCOptions struct {
+	// MinAge is the time since a pod finished after which it is collected.
+	MinAge time.Duration
+	// KeepPerOwner is the number of the most recently finished pods kept per
+	// controller, e.g. per Job, pods without a controller are not kept.
+	KeepPerOwner int
+	// Namespaces restricts the collection to these namespaces when set,
+	// pods of ExcludeNamespaces are never collected.
+	Namespaces        []string
+	ExcludeNamespaces []string
+	// DeleteRate is the maximum number of deletes per second, DeleteBurst
+	// the number of deletes allowed at once.
+	DeleteRate  float32
+	DeleteBurst int
+	// DryRun only reports the pods that would be collected with an Event and
+	// a log line.
+	DryRun bool
+}
+
+// PodGCScope is the namespace scope pods are handed to the collector from.
+type PodGCScope struct {
+	// Indexer is the pod cache of the scope.
+	Indexer cache.Indexer
+	// Jobs is the informer of the Jobs of the scope, it may be nil.
+	Jobs cache.SharedIndexInformer
+	// Done is closed once the scope is stopped, its caches are stale from
+	// then on and its pods no longer collected.
+	Done <-chan struct{}
+}
+
+// podGCItem is a pod on the work queue of the collector, with the scope it
+// was reconciled from.
+type podGCItem struct {
+	scope *PodGCScope
+	key   string
+}
+
+// PodGarbageCollector deletes the pods of the Succeeded and Failed phases,
+// evicted pods included, once they finished MinAge ago. The pods of a Job are
+// kept until it completes or fails, the Job controller counts them towards
+// its completions and backoff limit. Pods are handed to
+// the collector by the PodController when reconciled, and deleted from a
+// work queue of its own, so the rate limit doesn't hold up the pod workers.
+type PodGarbageCollector struct {
+	kubeClient kubernetes.Interface
+	options    PodGCOptions
+	recorder   record.EventRecorder
+
+	namespaces map[string]bool
+	excluded   map[string]bool
+	limiter    flowcontrol.RateLimiter
+	workqueue  workqueue.RateLimitingInterface
+
+	mu sync.Mutex
+	// reported holds the UIDs of the pods reported in dry-run mode by key,
+	// so they are reported once.
+	reported map[string]types.UID
+}
+
+// NewPodGarbageCollector creates a collector, unset delete limits default to
+// 5 deletes per second.
+func NewPodGarbageCollector(kubeClient kubernetes.Interface, options PodGCOptions, recorder record.EventRecorder) (*PodGarbageCollector, error) {
+	if options.MinAge < 0 || options.KeepPerOwner < 0 {
+		return nil, fmt.Errorf("pod gc minimum age and pods kept per owner must not be negative")
+	}
+	if options.DeleteRate <= 0 {
+		options.DeleteRate = 5
+	}
+	if options.DeleteBurst <= 0 {
+		options.DeleteBurst = int(options.DeleteRate)
+		if options.DeleteBurst < 1 {
+			options.DeleteBurst = 1
+		}
+	}
+
+	gc := &PodGarbageCollector{
+		kubeClient: kubeClient,
+		options:    options,
+		recorder:   recorder,
+		namespaces: make(map[string]bool),
+		excluded:   make(map[string]bool),
+		limiter:    flowcontrol.NewTokenBucketRateLimiter(options.DeleteRate, options.DeleteBurst),
+		workqueue:  workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "podgc"),
+		reported:   make(map[string]types.UID),
+	}
+	for _, namespace := range options.Namespaces {
+		gc.namespaces[namespace] = true
+	}
+	for _, namespace := range options.ExcludeNamespaces {
+		gc.excluded[namespace] = true
+	}
+
+	return gc, nil
+}
+
+// Run runs the delete worker and blocks until stopCh is closed.
+func (gc *PodGarbageCollector) Run(stopCh <-chan struct{}) {
+	defer runtime.HandleCrash()
+	defer gc.workqueue.ShutDown()
+
+	// a single worker, the deletes are rate limited anyway.
+	go wait.Until(gc.runWorker, time.Second, stopCh)
+
+	<-stopCh
+	klog.Info("Shutting down pod gc worker")
+}
+
+// Collect queues a pod reconciled in a scope for collection if it has
+// finished, along with the other finished pods of its controller that may now
+// exceed the pods kept.
+func (gc *PodGarbageCollector) Collect(pod *corev1.Pod, scope *PodGCScope) {
+	if !podFinished(pod) || !gc.collectsNamespace(pod.Namespace) {
+		return
+	}
+
+	gc.enqueue(scope, pod)
+	if gc.options.KeepPerOwner == 0 {
+		return
+	}
+	for _, sibling := range gc.finishedSiblings(pod, scope.Indexer) {
+		if sibling.UID != pod.UID {
+			gc.enqueue(scope, sibling)
+		}
+	}
+}
+
+// Forget drops a deleted pod from the pods reported in dry-run mode.
+func (gc *PodGarbageCollector) Forget(key string) {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	delete(gc.reported, key)
+}
+
+func (gc *PodGarbageCollector) runWorker() {
+	for gc.processNextWorkItem() {
+	}
+}
+
+func (gc *PodGarbageCollector) processNextWorkItem() bool {
+	obj, shutdown := gc.workqueue.Get()
+	if shutdown {
+		return false
+	}
+	defer gc.workqueue.Done(obj)
+
+	item, ok := obj.(podGCItem)
+	if !ok {
+		gc.workqueue.Forget(obj)
+		runtime.HandleError(fmt.Errorf("expected podGCItem in workqueue but got %#v", obj))
+		return true
+	}
+
+	err := gc.syncHandler(item)
+	metrics.ObserveReconcile("podgc", err)
+	if err != nil {
+		gc.workqueue.AddRateLimited(item)
+		runtime.HandleError(fmt.Errorf("error collecting pod '%s': %s", item.key, err.Error()))
+		return true
+	}
+	gc.workqueue.Forget(obj)
+
+	return true
+}
+
+// syncHandler deletes a finished pod old enough and not among the most
+// recent pods of its controller, a pod finished too recently is requeued.
+func (gc *PodGarbageCollector) syncHandler(item podGCItem) error {
+	select {
+	case <-item.scope.Done:
+		// the namespace is no longer watched, e.g. an item added after a
+		// delay, its cache is stale.
+		gc.Forget(item.key)
+		return nil
+	default:
+	}
+
+	obj, exists, err := item.scope.Indexer.GetByKey(item.key)
+	if err != nil || !exists {
+		return err
+	}
+	pod := obj.(*corev1.Pod)
+	if pod.DeletionTimestamp != nil || !podFinished(pod) {
+		return nil
+	}
+
+	finished := podFinishedAt(pod)
+	if wait := gc.options.MinAge - time.Since(finished); wait > 0 {
+		gc.workqueue.AddAfter(item, wait)
+		return nil
+	}
+	// the pods of a running Job are collected once it finishes, see
+	// PodController.onJobUpdate.
+	if done, err := jobFinished(pod, item.scope.Jobs); err != nil || !done {
+		return err
+	}
+	if gc.options.KeepPerOwner > 0 {
+		for i, sibling := range gc.finishedSiblings(pod, item.scope.Indexer) {
+			if i >= gc.options.KeepPerOwner {
+				break
+			}
+			if sibling.UID == pod.UID {
+				return nil
+			}
+		}
+	}
+
+	reason := podGCReason(pod)
+	if gc.options.DryRun {
+		gc.mu.Lock()
+		reported := gc.reported[item.key] == pod.UID
+		gc.reported[item.key] = pod.UID
+		gc.mu.Unlock()
+		if !reported {
+			klog.Infof("Dry run: collecting %s pod %s, finished at %s", reason, item.key, finished.Format(time.RFC3339))
+			gc.recorder.Eventf(pod, corev1.EventTypeNormal, ReasonPodCollected, "Collecting the %s pod, finished at %s, not deleted in dry-run mode", reason, finished.Format(time.RFC3339))
+			metrics.ObservePodCollected(reason, metrics.PodGCDryRun)
+		}
+		return nil
+	}
+
+	gc.limiter.Accept()
+	klog.Infof("Collecting %s pod %s, finished at %s", reason, item.key, finished.Format(time.RFC3339))
+	uid := pod.UID
+	err = gc.kubeClient.CoreV1().Pods(pod.Namespace).Delete(context.TODO(), pod.Name, metav1.DeleteOptions{
+		// a pod recreated with the same name, e.g. by a StatefulSet, is not
+		// deleted.
+		Preconditions: &metav1.Preconditions{UID: &uid},
+	})
+	if errors.IsNotFound(err) || errors.IsConflict(err) {
+		return nil
+	}
+	if err != nil {
+		metrics.ObservePodCollected(reason, metrics.PodGCFailed)
+		return err
+	}
+	metrics.ObservePodCollected(reason, metrics.PodGCDeleted)
+	gc.recorder.Eventf(pod, corev1.EventTypeNormal, ReasonPodCollected, "Collected the %s pod, finished at %s", reason, finished.Format(time.RFC3339))
+
+	return nil
+}
+
+func (gc *PodGarbageCollector) collectsNamespace(namespace string) bool {
+	if gc.excluded[namespace] {
+		return false
+	}
+
+	return len(gc.namespaces) == 0 || gc.namespaces[namespace]
+}
+
+func (gc *PodGarbageCollector) enqueue(scope *PodGCScope, pod *corev1.Pod) {
+	key, err := cache.MetaNamespaceKeyFunc(pod)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+
+	gc.workqueue.Add(podGCItem{scope: scope, key: key})
+}
+
+// jobFinished returns true unless a pod is controlled by a Job without a
+// Complete or Failed condition. A Job missing from the cache is taken as
+// finished, e.g. deleted with its pods orphaned, so the cache has to be
+// synced first.
+func jobFinished(pod *corev1.Pod, jobs cache.SharedIndexInformer) (bool, error) {
+	owner := metav1.GetControllerOf(pod)
+	if jobs == nil || owner == nil || owner.Kind != "Job" {
+		return true, nil
+	}
+	if !jobs.HasSynced() {
+		return false, fmt.Errorf("jobs of namespace %q not synced", pod.Namespace)
+	}
+	obj, exists, err := jobs.GetIndexer().GetByKey(pod.Namespace + "/" + owner.Name)
+	if err != nil || !exists {
+		return err == nil, err
+	}
+	job := obj.(*batchv1.Job)
+	if job.UID != owner.UID {
+		return true, nil
+	}
+
+	return jobDone(job), nil
+}
+
+// jobDone returns true if a Job has a Complete or Failed condition.
+func jobDone(job *batchv1.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if (condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed) &&
+			condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+
+	return false
+}
+
+// finishedSiblings returns the finished pods sharing the controller of a
+// pod, most recently finished first, nil for a pod without controller.
+func (gc *PodGarbageCollector) finishedSiblings(pod *corev1.Pod, indexer cache.Indexer) []*corev1.Pod {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return nil
+	}
+	objs, err := indexer.ByIndex(OwnerUIDIndex, string(owner.UID))
+	if err != nil {
+		runtime.HandleError(err)
+		return nil
+	}
+
+	var pods []*corev1.Pod
+	for _, obj := range objs {
+		sibling, ok := obj.(*corev1.Pod)
+		if !ok || sibling.DeletionTimestamp != nil || !podFinished(sibling) {
+			continue
+		}
+		if ref := metav1.GetControllerOf(sibling); ref != nil && ref.UID == owner.UID {
+			pods = append(pods, sibling)
+		}
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		ti, tj := podFinishedAt(pods[i]), podFinishedAt(pods[j])
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return pods[i].Name < pods[j].Name
+	})
+
+	return pods
+}
+
+func podFinished(pod *corev1.Pod) bool {
+	return pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed
+}
+
+// podFinishedAt returns the time the last container of a pod terminated,
+// the start or else the creation of the pod if none did, e.g. when it was
+// evicted before its containers started.
+func podFinishedAt(pod *corev1.Pod) time.Time {
+	var finished time.Time
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			if t := status.State.Terminated; t != nil && t.FinishedAt.After(finished) {
+				finished = t.FinishedAt.Time
+			}
+		}
+	}
+	if finished.IsZero() && pod.Status.StartTime != nil {
+		finished = pod.Status.StartTime.Time
+	}
+	if finished.IsZero() {
+		finished = pod.CreationTimestamp.Time
+	}
+
+	return finished
+}
+
+// podGCReason describes why a pod is collected: evicted, failed or
+// succeeded.
+func podGCReason(pod *corev1.Pod) string {
+	if pod.Status.Phase == corev1.PodFailed && pod.Status.Reason == "Evicted" {
+		return "evicted"
+	}
+	if pod.Status.Phase == corev1.PodFailed {
+		return "failed"
+	}
+
+	return "succeeded"
+}
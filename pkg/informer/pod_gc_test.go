@@ -0,0 +1,56 @@
+package informer
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPodGarbageCollectorSkipsPodsOfStoppedScopes(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "done", UID: "done-uid"},
+		Status:     corev1.PodStatus{Phase: corev1.PodSucceeded},
+	}
+	client := fake.NewSimpleClientset(pod)
+	gc, err := NewPodGarbageCollector(client, PodGCOptions{}, record.NewFakeRecorder(10))
+	if err != nil {
+		t.Fatalf("NewPodGarbageCollector: %v", err)
+	}
+	defer gc.workqueue.ShutDown()
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := indexer.Add(pod); err != nil {
+		t.Fatalf("add to indexer: %v", err)
+	}
+	done := make(chan struct{})
+	scope := &PodGCScope{Indexer: indexer, Done: done}
+
+	// an item of something else than a pod is dropped.
+	gc.workqueue.Add("default/done")
+	if !gc.processNextWorkItem() || gc.workqueue.Len() != 0 {
+		t.Fatal("the unexpected item wasn't dropped")
+	}
+
+	close(done)
+	gc.Collect(pod, scope)
+	if !gc.processNextWorkItem() {
+		t.Fatal("processNextWorkItem: queue shut down")
+	}
+	if _, err := client.CoreV1().Pods("default").Get(context.TODO(), "done", metav1.GetOptions{}); err != nil {
+		t.Fatalf("the pod of the stopped scope was collected: %v", err)
+	}
+
+	gc.Collect(pod, &PodGCScope{Indexer: indexer, Done: make(chan struct{})})
+	if !gc.processNextWorkItem() {
+		t.Fatal("processNextWorkItem: queue shut down")
+	}
+	if _, err := client.CoreV1().Pods("default").Get(context.TODO(), "done", metav1.GetOptions{}); err == nil {
+		t.Error("the finished pod wasn't collected")
+	}
+}
@@ -0,0 +1,373 @@
+package informer
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// PodProblem is a problem of a pod container detected from its status.
+type PodProblem string
+
+const (
+	PodCrashLoopBackOff           PodProblem = "CrashLoopBackOff"
+	PodOOMKilled                  PodProblem = "OOMKilled"
+	PodImagePullFailure           PodProblem = "ImagePullFailure"
+	PodCreateContainerConfigError PodProblem = "CreateContainerConfigError"
+	PodInitContainerStuck         PodProblem = "InitContainerStuck"
+	PodFrequentRestarts           PodProblem = "FrequentRestarts"
+)
+
+// imagePullReasons are the waiting reasons of containers whose image can't
+// be pulled.
+var imagePullReasons = map[string]bool{
+	"ImagePullBackOff":  true,
+	"ErrImagePull":      true,
+	"InvalidImageName":  true,
+	"ErrImageNeverPull": true,
+}
+
+// PodAlert is an ongoing problem of a container, it is emitted once when the
+// problem is first detected and kept until the problem is gone.
+type PodAlert struct {
+	Problem       PodProblem `json:"problem"`
+	Namespace     string     `json:"namespace"`
+	Pod           string     `json:"pod"`
+	Container     string     `json:"container"`
+	InitContainer bool       `json:"initContainer,omitempty"`
+	Reason        string     `json:"reason,omitempty"`
+	Message       string     `json:"message"`
+	// Restarts is the number of restarts of the container within the
+	// restart window.
+	Restarts int `json:"restarts,omitempty"`
+	// Owner is the top-most controller of the pod, e.g. its Deployment.
+	Owner *ObjectRef `json:"owner,omitempty"`
+
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	// Count is the number of times the pod was analyzed with the problem.
+	Count int `json:"count"`
+	// Resolved is set when the problem is gone, or the pod deleted.
+	Resolved bool `json:"resolved,omitempty"`
+}
+
+// PodAlertHandler is called for every new and resolved alert, pod is nil if
+// the alert is resolved by the deletion of the pod.
+type PodAlertHandler func(alert PodAlert, pod *corev1.Pod)
+
+// PodHealthOptions configures the thresholds of a PodHealthAnalyzer.
+type PodHealthOptions struct {
+	// RestartWindow is the sliding window restarts are counted in, an
+	// OOMKill older than it is no longer reported.
+	RestartWindow time.Duration
+	// RestartThreshold is the number of restarts within RestartWindow a
+	// container is reported as restarting frequently at.
+	RestartThreshold int
+	// InitContainerTimeout is the time after which an init container that
+	// hasn't completed is reported as stuck.
+	InitContainerTimeout time.Duration
+}
+
+// podHealth is the state kept per pod.
+type podHealth struct {
+	uid types.UID
+	// restartCounts holds the last seen restart count per container.
+	restartCounts map[string]int32
+	// restarts holds the times restarts were observed per container, within
+	// the restart window.
+	restarts map[string][]time.Time
+	// alerts holds the ongoing alerts by problem/container.
+	alerts map[string]*PodAlert
+}
+
+// PodHealthAnalyzer inspects the container statuses of pods for problems the
+// pod phase doesn't reveal, e.g. a crash looping pod stays Running. Alerts
+// are deduplicated per pod, container and problem, new alerts are logged,
+// recorded as Kubernetes Events on the pod and its owning workload, and
+// passed to the handlers.
+type PodHealthAnalyzer struct {
+	options  PodHealthOptions
+	recorder record.EventRecorder
+	// owners resolves the owning workloads, it may be nil.
+	owners *OwnerGraph
+
+	mu       sync.Mutex
+	pods     map[string]*podHealth
+	handlers []PodAlertHandler
+}
+
+// NewPodHealthAnalyzer creates an analyzer, recorder and owners may be nil.
+func NewPodHealthAnalyzer(options PodHealthOptions, recorder record.EventRecorder, owners *OwnerGraph) (*PodHealthAnalyzer, error) {
+	if options.RestartWindow <= 0 || options.InitContainerTimeout <= 0 {
+		return nil, fmt.Errorf("restart window and init container timeout must be positive")
+	}
+	if options.RestartThreshold <= 0 {
+		return nil, fmt.Errorf("restart threshold must be positive")
+	}
+
+	return &PodHealthAnalyzer{
+		options:  options,
+		recorder: recorder,
+		owners:   owners,
+		pods:     make(map[string]*podHealth),
+	}, nil
+}
+
+// AddHandler registers a handler called for every new and resolved alert.
+func (a *PodHealthAnalyzer) AddHandler(handler PodAlertHandler) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.handlers = append(a.handlers, handler)
+}
+
+// Analyze detects the problems of a pod at now and returns the new alerts.
+func (a *PodHealthAnalyzer) Analyze(pod *corev1.Pod, now time.Time) []PodAlert {
+	a.mu.Lock()
+
+	key := pod.Namespace + "/" + pod.Name
+	h, ok := a.pods[key]
+	if !ok || h.uid != pod.UID {
+		h = &podHealth{
+			uid:           pod.UID,
+			restartCounts: make(map[string]int32),
+			restarts:      make(map[string][]time.Time),
+			alerts:        make(map[string]*PodAlert),
+		}
+		a.pods[key] = h
+	}
+
+	detected := make(map[string]*PodAlert)
+	for _, statuses := range []struct {
+		init     bool
+		statuses []corev1.ContainerStatus
+	}{{true, pod.Status.InitContainerStatuses}, {false, pod.Status.ContainerStatuses}} {
+		for i := range statuses.statuses {
+			for _, alert := range a.detect(pod, h, &statuses.statuses[i], statuses.init, now) {
+				alert.InitContainer = statuses.init
+				detected[string(alert.Problem)+"/"+alert.Container] = alert
+			}
+		}
+	}
+
+	var created []PodAlert
+	for k, alert := range detected {
+		if existing, ok := h.alerts[k]; ok {
+			existing.Reason = alert.Reason
+			existing.Message = alert.Message
+			existing.Restarts = alert.Restarts
+			existing.LastSeen = now
+			existing.Count++
+			continue
+		}
+
+		alert.FirstSeen = now
+		alert.LastSeen = now
+		alert.Count = 1
+		if a.owners != nil {
+			if owner, ok := a.owners.Root(pod.UID); ok {
+				alert.Owner = &owner
+			}
+		}
+		h.alerts[k] = alert
+		created = append(created, *alert)
+	}
+	var resolved []PodAlert
+	for k, alert := range h.alerts {
+		if _, ok := detected[k]; !ok {
+			klog.Infof("Pod %s/%s container %s recovered from %s", alert.Namespace, alert.Pod, alert.Container, alert.Problem)
+			alert.Resolved = true
+			alert.LastSeen = now
+			resolved = append(resolved, *alert)
+			delete(h.alerts, k)
+		}
+	}
+	handlers := a.handlers
+	a.mu.Unlock()
+
+	sortPodAlerts(created)
+	for _, alert := range created {
+		a.emit(pod, alert, handlers)
+	}
+	for _, alert := range resolved {
+		for _, handler := range handlers {
+			handler(alert, pod)
+		}
+	}
+
+	return created
+}
+
+// Forget drops the state of a deleted pod, its alerts are resolved.
+func (a *PodHealthAnalyzer) Forget(namespace, name string) {
+	a.mu.Lock()
+	key := namespace + "/" + name
+	var resolved []PodAlert
+	if h, ok := a.pods[key]; ok {
+		for _, alert := range h.alerts {
+			alert.Resolved = true
+			alert.LastSeen = time.Now()
+			resolved = append(resolved, *alert)
+		}
+	}
+	delete(a.pods, key)
+	handlers := a.handlers
+	a.mu.Unlock()
+
+	for _, alert := range resolved {
+		for _, handler := range handlers {
+			handler(alert, nil)
+		}
+	}
+}
+
+// Alerts returns the ongoing alerts of a namespace, of every namespace if
+// namespace is empty.
+func (a *PodHealthAnalyzer) Alerts(namespace string) []PodAlert {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var alerts []PodAlert
+	for _, h := range a.pods {
+		for _, alert := range h.alerts {
+			if namespace == "" || alert.Namespace == namespace {
+				alerts = append(alerts, *alert)
+			}
+		}
+	}
+	sortPodAlerts(alerts)
+
+	return alerts
+}
+
+// detect returns the problems of a container and updates its restarts. The
+// caller must hold a.mu.
+func (a *PodHealthAnalyzer) detect(pod *corev1.Pod, h *podHealth, status *corev1.ContainerStatus, init bool, now time.Time) []*PodAlert {
+	newAlert := func(problem PodProblem, reason, message string) *PodAlert {
+		return &PodAlert{
+			Problem:   problem,
+			Namespace: pod.Namespace,
+			Pod:       pod.Name,
+			Container: status.Name,
+			Reason:    reason,
+			Message:   message,
+		}
+	}
+
+	// count the restarts within the sliding window, at most the threshold
+	// is kept per container.
+	restarts := h.restarts[status.Name]
+	if previous, ok := h.restartCounts[status.Name]; ok && status.RestartCount > previous {
+		for i := previous; i < status.RestartCount && int(i-previous) < a.options.RestartThreshold; i++ {
+			restarts = append(restarts, now)
+		}
+	}
+	h.restartCounts[status.Name] = status.RestartCount
+	cutoff := now.Add(-a.options.RestartWindow)
+	for len(restarts) > 0 && restarts[0].Before(cutoff) {
+		restarts = restarts[1:]
+	}
+	if len(restarts) > a.options.RestartThreshold {
+		restarts = restarts[len(restarts)-a.options.RestartThreshold:]
+	}
+	h.restarts[status.Name] = restarts
+
+	var alerts []*PodAlert
+	if waiting := status.State.Waiting; waiting != nil {
+		switch {
+		case waiting.Reason == "CrashLoopBackOff":
+			message := fmt.Sprintf("back-off restarting container %s, %d restarts", status.Name, status.RestartCount)
+			if last := status.LastTerminationState.Terminated; last != nil {
+				message += fmt.Sprintf(", last terminated with %s (exit code %d)", last.Reason, last.ExitCode)
+			}
+			alerts = append(alerts, newAlert(PodCrashLoopBackOff, waiting.Reason, message))
+		case imagePullReasons[waiting.Reason]:
+			alerts = append(alerts, newAlert(PodImagePullFailure, waiting.Reason,
+				fmt.Sprintf("failed to pull image %s: %s", status.Image, waiting.Message)))
+		case waiting.Reason == "CreateContainerConfigError":
+			alerts = append(alerts, newAlert(PodCreateContainerConfigError, waiting.Reason, waiting.Message))
+		}
+	}
+
+	for _, terminated := range []*corev1.ContainerStateTerminated{status.State.Terminated, status.LastTerminationState.Terminated} {
+		if terminated != nil && terminated.Reason == "OOMKilled" && terminated.FinishedAt.Time.After(cutoff) {
+			alerts = append(alerts, newAlert(PodOOMKilled, terminated.Reason,
+				fmt.Sprintf("container %s was OOMKilled at %s", status.Name, terminated.FinishedAt.Format(time.RFC3339))))
+			break
+		}
+	}
+
+	if len(restarts) >= a.options.RestartThreshold {
+		alert := newAlert(PodFrequentRestarts, "",
+			fmt.Sprintf("container %s restarted %d times within %s", status.Name, len(restarts), a.options.RestartWindow))
+		alert.Restarts = len(restarts)
+		alerts = append(alerts, alert)
+	}
+
+	if init && pod.Status.Phase == corev1.PodPending && pod.Status.StartTime != nil {
+		if running := now.Sub(pod.Status.StartTime.Time); !initContainerCompleted(status) && running >= a.options.InitContainerTimeout {
+			alerts = append(alerts, newAlert(PodInitContainerStuck, "",
+				fmt.Sprintf("init container %s hasn't completed after %s", status.Name, running.Round(time.Second))))
+		}
+	}
+
+	return alerts
+}
+
+// RecheckAfter returns the time after which a pod analyzed at now is to be
+// analyzed again, false if it needn't be. An init container that hangs
+// doesn't change the pod status, no update would have it reported as stuck.
+func (a *PodHealthAnalyzer) RecheckAfter(pod *corev1.Pod, now time.Time) (time.Duration, bool) {
+	if pod.Status.Phase != corev1.PodPending || pod.Status.StartTime == nil {
+		return 0, false
+	}
+	for i := range pod.Status.InitContainerStatuses {
+		if !initContainerCompleted(&pod.Status.InitContainerStatuses[i]) {
+			wait := a.options.InitContainerTimeout - now.Sub(pod.Status.StartTime.Time)
+			return wait, wait >= 0
+		}
+	}
+
+	return 0, false
+}
+
+func initContainerCompleted(status *corev1.ContainerStatus) bool {
+	return status.State.Terminated != nil && status.State.Terminated.ExitCode == 0
+}
+
+// emit logs and records a new alert and passes it to the handlers.
+func (a *PodHealthAnalyzer) emit(pod *corev1.Pod, alert PodAlert, handlers []PodAlertHandler) {
+	klog.Warningf("Pod %s/%s container %s: %s: %s", alert.Namespace, alert.Pod, alert.Container, alert.Problem, alert.Message)
+	if a.recorder != nil {
+		a.recorder.Eventf(pod, corev1.EventTypeWarning, string(alert.Problem), "%s", alert.Message)
+		if alert.Owner != nil {
+			a.recorder.Eventf(alert.Owner.ObjectReference(), corev1.EventTypeWarning, string(alert.Problem), "Pod %s: %s", alert.Pod, alert.Message)
+		}
+	}
+	for _, handler := range handlers {
+		handler(alert, pod)
+	}
+}
+
+func sortPodAlerts(alerts []PodAlert) {
+	sort.Slice(alerts, func(i, j int) bool {
+		a, b := alerts[i], alerts[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Pod != b.Pod {
+			return a.Pod < b.Pod
+		}
+		if a.Container != b.Container {
+			return a.Container < b.Container
+		}
+		return a.Problem < b.Problem
+	})
+}
@@ -0,0 +1,95 @@
+package informer
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/client-go/tools/record"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPodControllerRecordsHealthWarnings(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	health, err := NewPodHealthAnalyzer(PodHealthOptions{
+		RestartWindow:        time.Hour,
+		RestartThreshold:     5,
+		InitContainerTimeout: time.Hour,
+	}, recorder, nil)
+	if err != nil {
+		t.Fatalf("NewPodHealthAnalyzer: %v", err)
+	}
+	c := newTestPodController(t, recorder, health)
+
+	crashing := testPod("web-1", "1", corev1.PodRunning)
+	crashing.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name:         "web",
+		RestartCount: 3,
+		State: corev1.ContainerState{
+			Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+		},
+	}}
+	for _, pod := range []*corev1.Pod{crashing, testPod("job-1", "1", corev1.PodFailed)} {
+		if err := c.indexer.Add(pod); err != nil {
+			t.Fatalf("add to indexer: %v", err)
+		}
+		c.workqueue.Add("default/" + pod.Name)
+	}
+
+	// the failed pod is only reported on its transition into Failed, the
+	// crash looping pod by the health analyzer.
+	for i := 0; i < 2; i++ {
+		if !c.processNextWorkItem() {
+			t.Fatal("work queue shut down")
+		}
+	}
+	expectEvents(t, recorder, "Warning "+string(PodCrashLoopBackOff))
+
+	// the ongoing alert isn't recorded again.
+	c.workqueue.Add("default/web-1")
+	c.processNextWorkItem()
+	expectEvents(t, recorder)
+}
+
+func TestPodControllerRequeuesPendingInitContainers(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	health, err := NewPodHealthAnalyzer(PodHealthOptions{
+		RestartWindow:        time.Hour,
+		RestartThreshold:     5,
+		InitContainerTimeout: 50 * time.Millisecond,
+	}, recorder, nil)
+	if err != nil {
+		t.Fatalf("NewPodHealthAnalyzer: %v", err)
+	}
+	c := newTestPodController(t, recorder, health)
+
+	// the hanging init container never updates the pod.
+	pending := testPod("init-1", "1", corev1.PodPending)
+	pending.Status.StartTime = &metav1.Time{Time: time.Now()}
+	pending.Status.InitContainerStatuses = []corev1.ContainerStatus{{
+		Name:  "migrate",
+		State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+	}}
+	if err := c.indexer.Add(pending); err != nil {
+		t.Fatalf("add to indexer: %v", err)
+	}
+	c.workqueue.Add("default/init-1")
+	c.processNextWorkItem()
+	expectEvents(t, recorder)
+
+	// the pod is analyzed again once the init container timed out.
+	requeued := make(chan bool, 1)
+	go func() { requeued <- c.processNextWorkItem() }()
+	select {
+	case <-requeued:
+	case <-time.After(5 * time.Second):
+		t.Fatal("pod not requeued")
+	}
+	expectEvents(t, recorder, "Warning "+string(PodInitContainerStuck))
+
+	// a stuck init container is reported once, the pod isn't requeued.
+	if wait, ok := health.RecheckAfter(pending, time.Now()); ok {
+		t.Errorf("RecheckAfter = %s, want none once stuck", wait)
+	}
+}
@@ -0,0 +1,382 @@
+package informer
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+
+	"github.com/lqshow/access-kubernetes-cluster/pkg/metrics"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// revisionAnnotation is set on deployments by the deployment controller.
+const revisionAnnotation = "deployment.kubernetes.io/revision"
+
+// RolloutPhase is the phase of a rollout.
+type RolloutPhase string
+
+const (
+	RolloutProgressing RolloutPhase = "Progressing"
+	RolloutComplete    RolloutPhase = "Complete"
+	RolloutStalled     RolloutPhase = "Stalled"
+	// RolloutSuperseded is a rollout replaced by a newer revision before it
+	// completed.
+	RolloutSuperseded RolloutPhase = "Superseded"
+)
+
+// Reasons of the Kubernetes Events recorded for rollouts.
+const (
+	RolloutStartedReason     = "RolloutStarted"
+	RolloutProgressingReason = "RolloutProgressing"
+	RolloutCompletedReason   = "RolloutCompleted"
+	RolloutStalledReason     = "RolloutStalled"
+	RolloutRolledBackReason  = "RolloutRolledBack"
+)
+
+// Rollout is the rollout of a revision of a deployment.
+type Rollout struct {
+	Namespace        string       `json:"namespace"`
+	Name             string       `json:"name"`
+	Revision         string       `json:"revision"`
+	PreviousRevision string       `json:"previousRevision,omitempty"`
+	Phase            RolloutPhase `json:"phase"`
+	Message          string       `json:"message,omitempty"`
+	// RolledBackTo is the earlier revision whose pod template the rollout
+	// brings back.
+	RolledBackTo string `json:"rolledBackTo,omitempty"`
+	// ProgressDeadlineExceeded is set once the rollout made no progress for
+	// progressDeadlineSeconds.
+	ProgressDeadlineExceeded bool `json:"progressDeadlineExceeded,omitempty"`
+
+	Replicas          int32 `json:"replicas"`
+	UpdatedReplicas   int32 `json:"updatedReplicas"`
+	ReadyReplicas     int32 `json:"readyReplicas"`
+	AvailableReplicas int32 `json:"availableReplicas"`
+
+	// StartTime is when the revision was first observed, the informer start
+	// for rollouts ongoing at start.
+	StartTime        time.Time  `json:"startTime"`
+	LastProgressTime time.Time  `json:"lastProgressTime"`
+	CompletionTime   *time.Time `json:"completionTime,omitempty"`
+	DurationSeconds  float64    `json:"durationSeconds,omitempty"`
+}
+
+// RolloutHandler is called when a rollout starts or changes phase.
+type RolloutHandler func(rollout Rollout, deploy *appsv1.Deployment)
+
+// deploymentRollouts are the rollouts of a deployment.
+type deploymentRollouts struct {
+	uid     types.UID
+	current *Rollout
+	// history holds the finished rollouts, the most recent last.
+	history []Rollout
+	// templates holds the pod template hash per revision of the current and
+	// past rollouts, to tell rollbacks apart.
+	templates map[string]uint64
+}
+
+// RolloutTracker follows the rollouts of deployments: new revisions, the
+// updated, ready and available replicas against the progress deadline, and
+// the completion or stall of every rollout. Transitions are recorded as
+// Kubernetes Events on the deployment.
+type RolloutTracker struct {
+	recorder record.EventRecorder
+	// historySize is the number of finished rollouts kept per deployment.
+	historySize int
+
+	mu          sync.Mutex
+	deployments map[string]*deploymentRollouts
+	handlers    []RolloutHandler
+}
+
+// NewRolloutTracker creates a tracker keeping historySize finished rollouts
+// per deployment, recorder may be nil.
+func NewRolloutTracker(recorder record.EventRecorder, historySize int) *RolloutTracker {
+	return &RolloutTracker{
+		recorder:    recorder,
+		historySize: historySize,
+		deployments: make(map[string]*deploymentRollouts),
+	}
+}
+
+// AddHandler registers a handler called when a rollout starts or changes
+// phase, a rollout superseded by a new revision is passed before the new
+// one.
+func (t *RolloutTracker) AddHandler(handler RolloutHandler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.handlers = append(t.handlers, handler)
+}
+
+// Observe updates the rollout of a deployment with its current state. A
+// deployment seen for the first time doesn't start a rollout, its current
+// revision is tracked from now on.
+func (t *RolloutTracker) Observe(deploy *appsv1.Deployment, now time.Time) {
+	t.mu.Lock()
+	changed := t.observe(deploy, now)
+	handlers := t.handlers
+	t.mu.Unlock()
+
+	for _, r := range changed {
+		for _, handler := range handlers {
+			handler(r, deploy)
+		}
+	}
+}
+
+// observe updates the rollout of a deployment and returns the rollouts that
+// started or changed phase. The caller must hold t.mu.
+func (t *RolloutTracker) observe(deploy *appsv1.Deployment, now time.Time) []Rollout {
+	key := deploy.Namespace + "/" + deploy.Name
+	revision := deploy.Annotations[revisionAnnotation]
+	hash := templateHash(&deploy.Spec.Template)
+
+	d, ok := t.deployments[key]
+	if !ok || d.uid != deploy.UID {
+		r := newRollout(deploy, revision, now)
+		if rolloutComplete(deploy) {
+			r.Phase = RolloutComplete
+		}
+		d = &deploymentRollouts{
+			uid:       deploy.UID,
+			current:   r,
+			templates: map[string]uint64{revision: hash},
+		}
+		t.deployments[key] = d
+		return nil
+	}
+
+	var changed []Rollout
+	r := d.current
+	phase := r.Phase
+	if revision != "" && revision != r.Revision {
+		if r.Phase != RolloutComplete {
+			r.Phase = RolloutSuperseded
+			r.Message = fmt.Sprintf("superseded by revision %s", revision)
+			changed = append(changed, *r)
+		}
+		t.archive(d)
+
+		next := newRollout(deploy, revision, now)
+		next.PreviousRevision = r.Revision
+		for rev, h := range d.templates {
+			if h == hash && rev != r.Revision && (next.RolledBackTo == "" || revisionLess(next.RolledBackTo, rev)) {
+				next.RolledBackTo = rev
+			}
+		}
+		d.templates[revision] = hash
+		d.current = next
+		r = next
+		phase = ""
+
+		if r.RolledBackTo != "" {
+			t.event(deploy, corev1.EventTypeWarning, RolloutRolledBackReason, "Rolled back from revision %s to the template of revision %s as revision %s", r.PreviousRevision, r.RolledBackTo, r.Revision)
+		} else {
+			t.event(deploy, corev1.EventTypeNormal, RolloutStartedReason, "Rollout of revision %s started", r.Revision)
+		}
+	}
+
+	if r.Phase == RolloutComplete {
+		return changed
+	}
+
+	progressed := r.Replicas != desiredReplicas(deploy) || r.UpdatedReplicas != deploy.Status.UpdatedReplicas ||
+		r.ReadyReplicas != deploy.Status.ReadyReplicas || r.AvailableReplicas != deploy.Status.AvailableReplicas
+	setReplicas(r, deploy)
+	if progressed {
+		r.LastProgressTime = now
+	}
+
+	deadline := time.Duration(0)
+	if deploy.Spec.ProgressDeadlineSeconds != nil {
+		deadline = time.Duration(*deploy.Spec.ProgressDeadlineSeconds) * time.Second
+	}
+	switch {
+	case rolloutComplete(deploy):
+		r.Phase = RolloutComplete
+		r.Message = ""
+		r.CompletionTime = &now
+		r.DurationSeconds = now.Sub(r.StartTime).Seconds()
+		metrics.ObserveRollout(metrics.RolloutCompleted, r.DurationSeconds)
+		t.event(deploy, corev1.EventTypeNormal, RolloutCompletedReason, "Rollout of revision %s completed in %s", r.Revision, now.Sub(r.StartTime).Round(time.Second))
+	case !deploy.Spec.Paused && (progressDeadlineExceeded(deploy) || (deadline > 0 && now.Sub(r.LastProgressTime) > deadline)):
+		r.ProgressDeadlineExceeded = true
+		if r.Phase != RolloutStalled {
+			r.Phase = RolloutStalled
+			r.Message = fmt.Sprintf("ProgressDeadlineExceeded: no progress for %s, %s", deadline, replicaSummary(r))
+			metrics.ObserveRollout(metrics.RolloutStalled, now.Sub(r.StartTime).Seconds())
+			t.event(deploy, corev1.EventTypeWarning, RolloutStalledReason, "Rollout of revision %s stalled: %s", r.Revision, r.Message)
+		}
+	case progressed:
+		r.Phase = RolloutProgressing
+		r.Message = replicaSummary(r)
+		t.event(deploy, corev1.EventTypeNormal, RolloutProgressingReason, "Rollout of revision %s progressing: %s", r.Revision, r.Message)
+	}
+
+	if r.Phase != phase {
+		changed = append(changed, *r)
+	}
+	return changed
+}
+
+// Forget drops the rollouts of a deleted deployment.
+func (t *RolloutTracker) Forget(namespace, name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.deployments, namespace+"/"+name)
+}
+
+// Rollouts returns the current rollout of every deployment of a namespace,
+// of every namespace if namespace is empty.
+func (t *RolloutTracker) Rollouts(namespace string) []Rollout {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var rollouts []Rollout
+	for _, d := range t.deployments {
+		if namespace == "" || d.current.Namespace == namespace {
+			rollouts = append(rollouts, *d.current)
+		}
+	}
+	sort.Slice(rollouts, func(i, j int) bool {
+		if rollouts[i].Namespace != rollouts[j].Namespace {
+			return rollouts[i].Namespace < rollouts[j].Namespace
+		}
+		return rollouts[i].Name < rollouts[j].Name
+	})
+
+	return rollouts
+}
+
+// Get returns the current rollout of a deployment and its finished rollouts,
+// the most recent first.
+func (t *RolloutTracker) Get(namespace, name string) (Rollout, []Rollout, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	d, ok := t.deployments[namespace+"/"+name]
+	if !ok {
+		return Rollout{}, nil, false
+	}
+
+	history := make([]Rollout, 0, len(d.history))
+	for i := len(d.history) - 1; i >= 0; i-- {
+		history = append(history, d.history[i])
+	}
+
+	return *d.current, history, true
+}
+
+// archive moves the current rollout to the history and drops the templates
+// of revisions no longer kept. The caller must hold t.mu.
+func (t *RolloutTracker) archive(d *deploymentRollouts) {
+	d.history = append(d.history, *d.current)
+	if len(d.history) > t.historySize {
+		d.history = d.history[len(d.history)-t.historySize:]
+	}
+
+	kept := map[string]bool{d.current.Revision: true}
+	for _, r := range d.history {
+		kept[r.Revision] = true
+	}
+	for revision := range d.templates {
+		if !kept[revision] {
+			delete(d.templates, revision)
+		}
+	}
+}
+
+func (t *RolloutTracker) event(deploy *appsv1.Deployment, eventType, reason, messageFmt string, args ...interface{}) {
+	klog.Infof("Deployment %s/%s: "+messageFmt, append([]interface{}{deploy.Namespace, deploy.Name}, args...)...)
+	if t.recorder != nil {
+		t.recorder.Eventf(deploy, eventType, reason, messageFmt, args...)
+	}
+}
+
+func newRollout(deploy *appsv1.Deployment, revision string, now time.Time) *Rollout {
+	r := &Rollout{
+		Namespace:        deploy.Namespace,
+		Name:             deploy.Name,
+		Revision:         revision,
+		Phase:            RolloutProgressing,
+		StartTime:        now,
+		LastProgressTime: now,
+	}
+	setReplicas(r, deploy)
+
+	return r
+}
+
+func setReplicas(r *Rollout, deploy *appsv1.Deployment) {
+	r.Replicas = desiredReplicas(deploy)
+	r.UpdatedReplicas = deploy.Status.UpdatedReplicas
+	r.ReadyReplicas = deploy.Status.ReadyReplicas
+	r.AvailableReplicas = deploy.Status.AvailableReplicas
+}
+
+func replicaSummary(r *Rollout) string {
+	return fmt.Sprintf("%d/%d updated, %d ready, %d available", r.UpdatedReplicas, r.Replicas, r.ReadyReplicas, r.AvailableReplicas)
+}
+
+func desiredReplicas(deploy *appsv1.Deployment) int32 {
+	if deploy.Spec.Replicas == nil {
+		return 1
+	}
+
+	return *deploy.Spec.Replicas
+}
+
+// rolloutComplete mirrors kubectl rollout status: the latest generation is
+// observed and every replica is updated and available.
+func rolloutComplete(deploy *appsv1.Deployment) bool {
+	status := deploy.Status
+	replicas := desiredReplicas(deploy)
+
+	return deploy.Generation <= status.ObservedGeneration &&
+		status.UpdatedReplicas >= replicas &&
+		status.Replicas <= status.UpdatedReplicas &&
+		status.AvailableReplicas >= status.UpdatedReplicas
+}
+
+// progressDeadlineExceeded returns whether the deployment controller reported
+// the rollout as stalled.
+func progressDeadlineExceeded(deploy *appsv1.Deployment) bool {
+	for _, condition := range deploy.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing {
+			return condition.Reason == "ProgressDeadlineExceeded"
+		}
+	}
+
+	return false
+}
+
+func templateHash(template *corev1.PodTemplateSpec) uint64 {
+	h := fnv.New64a()
+	b, _ := json.Marshal(template)
+	h.Write(b)
+
+	return h.Sum64()
+}
+
+// revisionLess compares revisions numerically.
+func revisionLess(a, b string) bool {
+	i, errA := strconv.ParseInt(a, 10, 64)
+	j, errB := strconv.ParseInt(b, 10, 64)
+	if errA != nil || errB != nil {
+		return a < b
+	}
+
+	return i < j
+}
@@ -0,0 +1,74 @@
+package informer
+
+import (
+	"testing"
+
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testDeployment(revision, image string, generation int64, updated int32) *appsv1.Deployment {
+	replicas := int32(1)
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "web",
+			UID:         "web-uid",
+			Generation:  generation,
+			Annotations: map[string]string{revisionAnnotation: revision},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "web", Image: image}}},
+			},
+		},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: generation,
+			Replicas:           1,
+			UpdatedReplicas:    updated,
+			AvailableReplicas:  updated,
+		},
+	}
+}
+
+func TestDeploymentSyncHandlerRecordsRolloutEvents(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	factory := informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0)
+	c := NewDeploymentController("default", factory, newTestDispatcher(t), NewRolloutTracker(recorder, 5))
+	indexer := c.informer.GetIndexer()
+
+	for _, step := range []struct {
+		deploy *appsv1.Deployment
+		want   []string
+	}{
+		// the first revision seen is tracked without an Event.
+		{testDeployment("1", "web:1", 1, 1), nil},
+		{testDeployment("1", "web:1", 1, 1), nil},
+		{testDeployment("2", "web:2", 2, 0), []string{"Normal " + RolloutStartedReason}},
+		{testDeployment("2", "web:2", 2, 1), []string{"Normal " + RolloutCompletedReason}},
+		{testDeployment("2", "web:2", 2, 1), nil},
+		{testDeployment("3", "web:1", 3, 0), []string{"Warning " + RolloutRolledBackReason}},
+	} {
+		if err := indexer.Update(step.deploy); err != nil {
+			t.Fatalf("update indexer: %v", err)
+		}
+		if err := c.syncHandler("default/web"); err != nil {
+			t.Fatalf("syncHandler: %v", err)
+		}
+		expectEvents(t, recorder, step.want...)
+	}
+
+	if err := indexer.Delete(testDeployment("3", "web:1", 3, 0)); err != nil {
+		t.Fatalf("delete from indexer: %v", err)
+	}
+	if err := c.syncHandler("default/web"); err != nil {
+		t.Fatalf("syncHandler of a deleted deployment: %v", err)
+	}
+	expectEvents(t, recorder)
+}
@@ -0,0 +1,305 @@
+package informer
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	"github.com/lqshow/access-kubernetes-cluster/pkg/metrics"
+)
+
+const (
+	// DefaultSinkBufferSize is the number of events queued for a sink when
+	// its buffer size isn't configured.
+	DefaultSinkBufferSize = 1000
+	// sinkDrainTimeout bounds the time the queued events are sent for at
+	// stop, the events left are dropped.
+	sinkDrainTimeout = 10 * time.Second
+)
+
+// EventSink delivers events to a downstream system.
+type EventSink interface {
+	// Name identifies the sink in logs and metrics.
+	Name() string
+	// Send delivers an event, it may block until the event is delivered or
+	// ctx is done.
+	Send(ctx context.Context, event *Event) error
+	// Close flushes the sink and releases its resources.
+	Close() error
+}
+
+// EventFilter selects events, an empty list matches any value.
+type EventFilter struct {
+	Types             []EventType `json:"types,omitempty"`
+	Kinds             []string    `json:"kinds,omitempty"`
+	Namespaces        []string    `json:"namespaces,omitempty"`
+	ExcludeNamespaces []string    `json:"excludeNamespaces,omitempty"`
+}
+
+// Matches returns whether an event passes the filter.
+func (f *EventFilter) Matches(event *Event) bool {
+	if len(f.Types) > 0 && !containsEventType(f.Types, event.Type) {
+		return false
+	}
+	if len(f.Kinds) > 0 && !containsString(f.Kinds, event.Kind) {
+		return false
+	}
+	if len(f.Namespaces) > 0 && !containsString(f.Namespaces, event.Namespace) {
+		return false
+	}
+
+	return !containsString(f.ExcludeNamespaces, event.Namespace)
+}
+
+// sinkOutput is a sink of a FanOut with its filter and buffer.
+type sinkOutput struct {
+	sink   EventSink
+	filter EventFilter
+	events chan *Event
+}
+
+// FanOut passes the events of a Dispatcher to several sinks. Every sink has
+// its own buffer and goroutine so a slow sink holds back neither the other
+// sinks nor the informers, events are dropped when the buffer of a sink is
+// full.
+type FanOut struct {
+	outputs []*sinkOutput
+	byName  map[string]*sinkOutput
+}
+
+// NewFanOut creates a fan-out without sinks.
+func NewFanOut() *FanOut {
+	return &FanOut{
+		byName: make(map[string]*sinkOutput),
+	}
+}
+
+// AddSink adds a sink receiving the events matching filter, a bufferSize of
+// 0 uses DefaultSinkBufferSize. Sinks must be added before events are
+// handled.
+func (f *FanOut) AddSink(sink EventSink, filter EventFilter, bufferSize int) {
+	if bufferSize <= 0 {
+		bufferSize = DefaultSinkBufferSize
+	}
+
+	o := &sinkOutput{
+		sink:   sink,
+		filter: filter,
+		events: make(chan *Event, bufferSize),
+	}
+	f.outputs = append(f.outputs, o)
+	f.byName[sink.Name()] = o
+}
+
+// HasSink returns whether the fan-out has a sink with the name.
+func (f *FanOut) HasSink(name string) bool {
+	_, ok := f.byName[name]
+	return ok
+}
+
+// HandleEvent queues an event for the sinks whose filter it matches, it is an
+// EventHandler.
+func (f *FanOut) HandleEvent(event *Event) {
+	for _, o := range f.outputs {
+		if o.filter.Matches(event) {
+			o.queue(event)
+		}
+	}
+}
+
+// SendTo queues an event for the named sink regardless of its filter, false
+// is returned if there is no such sink.
+func (f *FanOut) SendTo(name string, event *Event) bool {
+	o, ok := f.byName[name]
+	if ok {
+		o.queue(event)
+	}
+
+	return ok
+}
+
+// Run sends the queued events to the sinks until stopCh is closed, the
+// queued events are sent for up to sinkDrainTimeout and the sinks closed
+// before it returns.
+func (f *FanOut) Run(stopCh <-chan struct{}) {
+	done := make(chan struct{}, len(f.outputs))
+	for _, o := range f.outputs {
+		go func(o *sinkOutput) {
+			o.run(stopCh)
+			done <- struct{}{}
+		}(o)
+	}
+
+	for range f.outputs {
+		<-done
+	}
+}
+
+func (o *sinkOutput) queue(event *Event) {
+	select {
+	case o.events <- event:
+	default:
+		metrics.ObserveSinkEvent(o.sink.Name(), metrics.SinkDropped)
+		klog.Warningf("Sink %s is full, dropped %s %s %s", o.sink.Name(), event.Type, event.Kind, event.Key())
+	}
+}
+
+func (o *sinkOutput) run(stopCh <-chan struct{}) {
+	defer func() {
+		if err := o.sink.Close(); err != nil {
+			klog.Errorf("Failed to close sink %s: %v", o.sink.Name(), err)
+		}
+	}()
+
+	// the send in progress at stop is cancelled, e.g. a webhook retry.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		select {
+		case event := <-o.events:
+			o.send(ctx, event)
+		case <-stopCh:
+			o.drain()
+			return
+		}
+	}
+}
+
+// drain sends the queued events until none is left or sinkDrainTimeout has
+// passed, the events left are dropped.
+func (o *sinkOutput) drain() {
+	ctx, cancel := context.WithTimeout(context.Background(), sinkDrainTimeout)
+	defer cancel()
+
+	dropped := 0
+	for {
+		select {
+		case event := <-o.events:
+			if ctx.Err() != nil {
+				metrics.ObserveSinkEvent(o.sink.Name(), metrics.SinkDropped)
+				dropped++
+				continue
+			}
+			o.send(ctx, event)
+		default:
+			if dropped > 0 {
+				klog.Warningf("Sink %s didn't drain in %s, dropped %d events", o.sink.Name(), sinkDrainTimeout, dropped)
+			}
+			return
+		}
+	}
+}
+
+func (o *sinkOutput) send(ctx context.Context, event *Event) {
+	if err := o.sink.Send(ctx, event); err != nil {
+		metrics.ObserveSinkEvent(o.sink.Name(), metrics.SinkFailed)
+		klog.Errorf("Sink %s failed to send %s %s %s: %v", o.sink.Name(), event.Type, event.Kind, event.Key(), err)
+		return
+	}
+
+	metrics.ObserveSinkEvent(o.sink.Name(), metrics.SinkSent)
+}
+
+// SinkConfig configures a sink of a fan-out, exactly one of Webhook, File and
+// Stdout must be set.
+type SinkConfig struct {
+	Name   string      `json:"name"`
+	Filter EventFilter `json:"filter,omitempty"`
+	// BufferSize is the number of events queued for the sink.
+	BufferSize int `json:"bufferSize,omitempty"`
+
+	Webhook *WebhookSinkOptions `json:"webhook,omitempty"`
+	File    *FileSinkOptions    `json:"file,omitempty"`
+	Stdout  *StdoutSinkOptions  `json:"stdout,omitempty"`
+}
+
+// SinksConfig is the file a fan-out is loaded from.
+type SinksConfig struct {
+	Sinks []SinkConfig `json:"sinks"`
+}
+
+// LoadFanOut creates a fan-out with the sinks of a YAML or JSON SinksConfig
+// file.
+func LoadFanOut(path string) (*FanOut, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sinks config %s: %v", path, err)
+	}
+	var config SinksConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse sinks config %s: %v", path, err)
+	}
+
+	f := NewFanOut()
+	names := make(map[string]bool)
+	for _, c := range config.Sinks {
+		if c.Name == "" {
+			return nil, fmt.Errorf("sink name is required")
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("duplicate sink %s", c.Name)
+		}
+		names[c.Name] = true
+
+		sink, err := newSink(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sink %s: %v", c.Name, err)
+		}
+		f.AddSink(sink, c.Filter, c.BufferSize)
+	}
+
+	return f, nil
+}
+
+func newSink(c SinkConfig) (EventSink, error) {
+	set := 0
+	for _, options := range []bool{c.Webhook != nil, c.File != nil, c.Stdout != nil} {
+		if options {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("exactly one of webhook, file or stdout must be set")
+	}
+
+	switch {
+	case c.Webhook != nil:
+		return NewWebhookSink(c.Name, *c.Webhook)
+	case c.File != nil:
+		return NewFileSink(c.Name, *c.File)
+	default:
+		return NewStdoutSink(c.Name, *c.Stdout), nil
+	}
+}
+
+func containsEventType(types []EventType, t EventType) bool {
+	for _, s := range types {
+		if s == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, s := range values {
+		if s == value {
+			return true
+		}
+	}
+
+	return false
+}
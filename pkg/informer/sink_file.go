@@ -0,0 +1,161 @@
+package informer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"k8s.io/klog/v2"
+)
+
+// FileSinkOptions configures a sink appending events to a JSON-lines file.
+type FileSinkOptions struct {
+	Path string `json:"path"`
+	// MaxSizeBytes rotates the file before it grows over it, 0 disables
+	// rotation.
+	MaxSizeBytes int64 `json:"maxSizeBytes,omitempty"`
+	// MaxBackups is the number of rotated files kept as Path.1, the most
+	// recent, to Path.N.
+	MaxBackups int `json:"maxBackups,omitempty"`
+}
+
+// FileSink appends every event as a line of JSON to a file.
+type FileSink struct {
+	name    string
+	options FileSinkOptions
+
+	mu sync.Mutex
+	// file is nil when it couldn't be reopened by a rotation, it is opened
+	// again by the next Send.
+	file   *os.File
+	size   int64
+	closed bool
+}
+
+// NewFileSink opens or creates the file of a file sink.
+func NewFileSink(name string, options FileSinkOptions) (*FileSink, error) {
+	if options.Path == "" {
+		return nil, fmt.Errorf("file path is required")
+	}
+
+	s := &FileSink{
+		name:    name,
+		options: options,
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Name implements EventSink.
+func (s *FileSink) Name() string {
+	return s.name
+}
+
+// Send implements EventSink.
+func (s *FileSink) Send(_ context.Context, event *Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("file sink %s is closed", s.name)
+	}
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	if s.options.MaxSizeBytes > 0 && s.size > 0 && s.size+int64(len(line)) > s.options.MaxSizeBytes {
+		if err := s.rotate(); err != nil {
+			if s.file == nil {
+				return err
+			}
+			// the event is appended to the file that couldn't be rotated.
+			klog.Errorf("Failed to rotate the file of sink %s: %v", s.name, err)
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// Close implements EventSink.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+
+	return err
+}
+
+// open opens the file for appending. The caller must hold s.mu unless the
+// sink isn't shared yet.
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.options.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", s.options.Path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// rotate shifts the backups, moves the file to Path.1 and opens a new file.
+// The oldest backup is removed once there are MaxBackups. The file is
+// reopened for appending if it can't be moved, s.file is only left nil if
+// that fails too. The caller must hold s.mu.
+func (s *FileSink) rotate() error {
+	err := s.file.Close()
+	s.file = nil
+	if err == nil {
+		err = s.shift()
+	}
+	if openErr := s.open(); openErr != nil {
+		return openErr
+	}
+
+	return err
+}
+
+// shift removes the file, or moves it to Path.1 after shifting the backups.
+func (s *FileSink) shift() error {
+	path := s.options.Path
+	if s.options.MaxBackups <= 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	for i := s.options.MaxBackups - 1; i > 0; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return os.Rename(path, path+".1")
+}
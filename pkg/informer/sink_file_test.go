@@ -0,0 +1,43 @@
+package informer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileSinkKeepsWritingWhenRotationFails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filesink")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "events.jsonl")
+	// a non-empty directory in place of the first backup fails the rename.
+	if err := os.MkdirAll(filepath.Join(path+".1", "blocked"), 0755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	s, err := NewFileSink("file", FileSinkOptions{Path: path, MaxSizeBytes: 1, MaxBackups: 1})
+	if err != nil {
+		t.Fatalf("NewFileSink: %v", err)
+	}
+	defer s.Close()
+
+	for _, name := range []string{"web-1", "web-2", "web-3"} {
+		if err := s.Send(context.TODO(), &Event{Kind: "Pod", Name: name}); err != nil {
+			t.Fatalf("Send %s: %v", name, err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 3 {
+		t.Errorf("lines = %d, want the 3 events appended to the file that couldn't be rotated", lines)
+	}
+}
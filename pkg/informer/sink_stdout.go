@@ -0,0 +1,92 @@
+package informer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/lqshow/access-kubernetes-cluster/pkg/diff"
+)
+
+// StdoutSinkOptions configures a sink writing events to the standard output.
+type StdoutSinkOptions struct {
+	// IncludeObject adds the object to the lines, only the identity and the
+	// diff of the change are written otherwise.
+	IncludeObject bool `json:"includeObject,omitempty"`
+}
+
+// stdoutLine is the structured line written for an event.
+type stdoutLine struct {
+	Time            time.Time      `json:"time"`
+	Sink            string         `json:"sink"`
+	Type            EventType      `json:"type"`
+	Kind            string         `json:"kind"`
+	Namespace       string         `json:"namespace,omitempty"`
+	Name            string         `json:"name"`
+	UID             string         `json:"uid,omitempty"`
+	ResourceVersion string         `json:"resourceVersion,omitempty"`
+	Diff            []diff.Change  `json:"diff,omitempty"`
+	Object          runtime.Object `json:"object,omitempty"`
+}
+
+// StdoutSink writes every event as a line of JSON to the standard output,
+// next to the logs of the process.
+type StdoutSink struct {
+	name    string
+	options StdoutSinkOptions
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewStdoutSink creates a stdout sink.
+func NewStdoutSink(name string, options StdoutSinkOptions) *StdoutSink {
+	return &StdoutSink{
+		name:    name,
+		options: options,
+		w:       os.Stdout,
+	}
+}
+
+// Name implements EventSink.
+func (s *StdoutSink) Name() string {
+	return s.name
+}
+
+// Send implements EventSink.
+func (s *StdoutSink) Send(_ context.Context, event *Event) error {
+	line := stdoutLine{
+		Time:            event.Time,
+		Sink:            s.name,
+		Type:            event.Type,
+		Kind:            event.Kind,
+		Namespace:       event.Namespace,
+		Name:            event.Name,
+		UID:             event.UID,
+		ResourceVersion: event.ResourceVersion,
+		Diff:            event.Diff,
+	}
+	if s.options.IncludeObject {
+		line.Object = event.Object
+	}
+	b, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+// Close implements EventSink.
+func (s *StdoutSink) Close() error {
+	return nil
+}
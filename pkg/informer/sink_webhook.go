@@ -0,0 +1,207 @@
+package informer
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	defaultWebhookTimeout         = 10 * time.Second
+	defaultWebhookRetryInterval   = time.Second
+	defaultWebhookSignatureHeader = "X-Signature-256"
+	// maxWebhookRetryInterval caps the exponential backoff between retries.
+	maxWebhookRetryInterval = 30 * time.Second
+)
+
+// WebhookSinkOptions configures a sink sending events with HTTP requests.
+type WebhookSinkOptions struct {
+	URL string `json:"url"`
+	// Method defaults to POST.
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Template is a text/template rendering the request body from the Event,
+	// the event is sent as JSON when empty. The json function encodes a value
+	// as JSON, e.g. {"text": {{ printf "%s %s" .Type .Key | json }}}.
+	Template string `json:"template,omitempty"`
+	// ContentType defaults to application/json.
+	ContentType string `json:"contentType,omitempty"`
+
+	// Secret signs the request body with HMAC-SHA256, the signature is sent
+	// in SignatureHeader as sha256=<hex>. SecretFile reads the secret from a
+	// file, e.g. a mounted Secret.
+	Secret          string `json:"secret,omitempty"`
+	SecretFile      string `json:"secretFile,omitempty"`
+	SignatureHeader string `json:"signatureHeader,omitempty"`
+
+	// Timeout bounds a single request.
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+	// Retries is the number of times a failed request is retried, after
+	// RetryInterval and doubling the interval for every retry. Requests
+	// failing with a 4xx status other than 429 are not retried.
+	Retries       int             `json:"retries,omitempty"`
+	RetryInterval metav1.Duration `json:"retryInterval,omitempty"`
+}
+
+// WebhookSink sends every event in an HTTP request.
+type WebhookSink struct {
+	name     string
+	options  WebhookSinkOptions
+	template *template.Template
+	secret   []byte
+	client   *http.Client
+}
+
+// NewWebhookSink creates a webhook sink, unset options are defaulted.
+func NewWebhookSink(name string, options WebhookSinkOptions) (*WebhookSink, error) {
+	if options.URL == "" {
+		return nil, fmt.Errorf("webhook url is required")
+	}
+	if options.Method == "" {
+		options.Method = http.MethodPost
+	}
+	if options.ContentType == "" {
+		options.ContentType = "application/json"
+	}
+	if options.SignatureHeader == "" {
+		options.SignatureHeader = defaultWebhookSignatureHeader
+	}
+	if options.Timeout.Duration <= 0 {
+		options.Timeout.Duration = defaultWebhookTimeout
+	}
+	if options.RetryInterval.Duration <= 0 {
+		options.RetryInterval.Duration = defaultWebhookRetryInterval
+	}
+
+	s := &WebhookSink{
+		name:    name,
+		options: options,
+		secret:  []byte(options.Secret),
+		client:  &http.Client{Timeout: options.Timeout.Duration},
+	}
+	if options.SecretFile != "" {
+		secret, err := ioutil.ReadFile(options.SecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read webhook secret: %v", err)
+		}
+		s.secret = bytes.TrimSpace(secret)
+	}
+	if options.Template != "" {
+		t, err := template.New(name).Funcs(template.FuncMap{"json": templateJSON}).Parse(options.Template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid webhook template: %v", err)
+		}
+		s.template = t
+	}
+
+	return s, nil
+}
+
+// Name implements EventSink.
+func (s *WebhookSink) Name() string {
+	return s.name
+}
+
+// Send implements EventSink, the request is retried with exponential backoff
+// until it succeeds, the retries are exhausted or ctx is done.
+func (s *WebhookSink) Send(ctx context.Context, event *Event) error {
+	body, err := s.render(event)
+	if err != nil {
+		return err
+	}
+
+	interval := s.options.RetryInterval.Duration
+	for attempt := 0; ; attempt++ {
+		retry, err := s.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= s.options.Retries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%v, not retried: %v", err, ctx.Err())
+		case <-time.After(interval):
+		}
+		if interval *= 2; interval > maxWebhookRetryInterval {
+			interval = maxWebhookRetryInterval
+		}
+	}
+}
+
+// Close implements EventSink.
+func (s *WebhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+func (s *WebhookSink) render(event *Event) ([]byte, error) {
+	if s.template == nil {
+		return json.Marshal(event)
+	}
+
+	var buf bytes.Buffer
+	if err := s.template.Execute(&buf, event); err != nil {
+		return nil, fmt.Errorf("failed to render webhook template: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// post sends a request and returns whether a failed request may be retried.
+func (s *WebhookSink) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, s.options.Method, s.options.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", s.options.ContentType)
+	for key, value := range s.options.Headers {
+		req.Header.Set(key, value)
+	}
+	if len(s.secret) > 0 {
+		req.Header.Set(s.options.SignatureHeader, "sha256="+sign(s.secret, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("failed to send to webhook %s: %v", s.options.URL, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook %s returned %s", s.options.URL, resp.Status)
+}
+
+// sign returns the hex encoded HMAC-SHA256 of body.
+func sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func templateJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
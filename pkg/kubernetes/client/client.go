@@ -1,9 +1,12 @@
 package client
 
 import (
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/lqshow/access-kubernetes-cluster/pkg/generated/clientset/versioned"
 )
 
 type Option func(c *rest.Config)
@@ -26,3 +29,31 @@ func newFromConfig(c *rest.Config, options ...Option) (*kubernetes.Clientset, er
 
 	return kubernetes.NewForConfig(c)
 }
+
+// NewDynamicClient generates a dynamic client by master URL and kube config.
+func NewDynamicClient(masterUrl, kubeconfigPath string, options ...Option) (dynamic.Interface, error) {
+	config, err := clientcmd.BuildConfigFromFlags(masterUrl, kubeconfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, option := range options {
+		option(config)
+	}
+
+	return dynamic.NewForConfig(config)
+}
+
+// NewClusterWatchClient generates a ClusterWatch client by master URL and kube config.
+func NewClusterWatchClient(masterUrl, kubeconfigPath string, options ...Option) (versioned.Interface, error) {
+	config, err := clientcmd.BuildConfigFromFlags(masterUrl, kubeconfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, option := range options {
+		option(config)
+	}
+
+	return versioned.NewForConfig(config)
+}
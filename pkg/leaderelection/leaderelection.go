@@ -0,0 +1,181 @@
+package leaderelection
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Config describes the Lease used to elect a leader among the replicas.
+type Config struct {
+	// LeaseName and LeaseNamespace identify the coordination.k8s.io Lease.
+	LeaseName      string
+	LeaseNamespace string
+
+	// Identity is the holder identity recorded in the Lease, it defaults to
+	// the hostname suffixed with a random id.
+	Identity string
+
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
+// Status is a point in time view of the election, served by the status endpoint.
+type Status struct {
+	LeaseName      string     `json:"leaseName"`
+	LeaseNamespace string     `json:"leaseNamespace"`
+	Identity       string     `json:"identity"`
+	Leader         string     `json:"leader"`
+	IsLeader       bool       `json:"isLeader"`
+	LeaderSince    *time.Time `json:"leaderSince,omitempty"`
+}
+
+// LeaderElector runs a callback only while this replica holds the Lease.
+type LeaderElector struct {
+	client kubernetes.Interface
+	config Config
+
+	// the leadership is tracked from the callbacks, the IsLeader and
+	// GetLeader of client-go read the observed record without locking.
+	mu          sync.RWMutex
+	leader      string
+	leaderSince *time.Time
+}
+
+// NewLeaderElector creates a Lease based leader elector. The client may be a
+// fake clientset in tests.
+func NewLeaderElector(client kubernetes.Interface, config Config) (*LeaderElector, error) {
+	if config.LeaseName == "" || config.LeaseNamespace == "" {
+		return nil, fmt.Errorf("lease name and namespace are required")
+	}
+
+	if config.Identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get hostname: %v", err)
+		}
+		config.Identity = hostname + "_" + string(uuid.NewUUID())
+	}
+
+	return &LeaderElector{
+		client: client,
+		config: config,
+	}, nil
+}
+
+// Run blocks campaigning for the Lease and calls run once it is acquired. The
+// stop channel handed to run is closed when leadership is lost or stopCh is
+// closed, in the latter case the Lease is released so another replica can
+// take over without waiting for it to expire. An error is returned when
+// leadership is lost while stopCh is still open.
+func (le *LeaderElector) Run(stopCh <-chan struct{}, run func(stopCh <-chan struct{})) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta: metav1.ObjectMeta{
+				Name:      le.config.LeaseName,
+				Namespace: le.config.LeaseNamespace,
+			},
+			Client: le.client.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{
+				Identity: le.config.Identity,
+			},
+		},
+		ReleaseOnCancel: true,
+		LeaseDuration:   le.config.LeaseDuration,
+		RenewDeadline:   le.config.RenewDeadline,
+		RetryPeriod:     le.config.RetryPeriod,
+		Name:            le.config.LeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				klog.Infof("Started leading as %s", le.config.Identity)
+				le.setLeaderSince(time.Now())
+				run(ctx.Done())
+			},
+			OnStoppedLeading: func() {
+				klog.Infof("Stopped leading as %s", le.config.Identity)
+				le.setLeaderSince(time.Time{})
+			},
+			OnNewLeader: func(identity string) {
+				le.mu.Lock()
+				le.leader = identity
+				le.mu.Unlock()
+				if identity != le.config.Identity {
+					klog.Infof("New leader elected: %s", identity)
+				}
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	elector.Run(ctx)
+
+	select {
+	case <-stopCh:
+		return nil
+	default:
+		return fmt.Errorf("leader election lost by %s", le.config.Identity)
+	}
+}
+
+// IsLeader returns true if this replica currently holds the Lease.
+func (le *LeaderElector) IsLeader() bool {
+	le.mu.RLock()
+	defer le.mu.RUnlock()
+
+	return le.leaderSince != nil
+}
+
+// Status returns the identity of the current leader as last observed.
+func (le *LeaderElector) Status() Status {
+	le.mu.RLock()
+	defer le.mu.RUnlock()
+
+	status := Status{
+		LeaseName:      le.config.LeaseName,
+		LeaseNamespace: le.config.LeaseNamespace,
+		Identity:       le.config.Identity,
+		Leader:         le.leader,
+		IsLeader:       le.leaderSince != nil,
+		LeaderSince:    le.leaderSince,
+	}
+
+	return status
+}
+
+func (le *LeaderElector) setLeaderSince(t time.Time) {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+
+	if t.IsZero() {
+		le.leaderSince = nil
+		if le.leader == le.config.Identity {
+			le.leader = ""
+		}
+		return
+	}
+	le.leaderSince = &t
+	le.leader = le.config.Identity
+}
@@ -0,0 +1,111 @@
+package leaderelection
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestElector(t *testing.T, client *fake.Clientset) *LeaderElector {
+	le, err := NewLeaderElector(client, Config{
+		LeaseName:      "informer",
+		LeaseNamespace: "default",
+		Identity:       "replica-a",
+		LeaseDuration:  2 * time.Second,
+		RenewDeadline:  time.Second,
+		RetryPeriod:    200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewLeaderElector: %v", err)
+	}
+
+	return le
+}
+
+func TestLeaderElectorAcquiresAndReleasesLease(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	le := newTestElector(t, client)
+
+	if le.IsLeader() {
+		t.Fatal("leader before running")
+	}
+	if status := le.Status(); status.IsLeader || status.Leader != "" {
+		t.Fatalf("status before running = %+v", status)
+	}
+
+	stopCh := make(chan struct{})
+	started := make(chan struct{})
+	runStopped := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- le.Run(stopCh, func(runStopCh <-chan struct{}) {
+			close(started)
+			<-runStopCh
+			close(runStopped)
+		})
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("lease not acquired")
+	}
+
+	lease, err := client.CoordinationV1().Leases("default").Get(context.TODO(), "informer", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get lease: %v", err)
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != "replica-a" {
+		t.Fatalf("lease holder = %v, want replica-a", lease.Spec.HolderIdentity)
+	}
+
+	if !le.IsLeader() {
+		t.Fatal("IsLeader = false after acquiring the lease")
+	}
+	status := le.Status()
+	if !status.IsLeader || status.Leader != "replica-a" || status.Identity != "replica-a" || status.LeaderSince == nil {
+		t.Fatalf("status = %+v", status)
+	}
+	if status.LeaseName != "informer" || status.LeaseNamespace != "default" {
+		t.Fatalf("status lease = %s/%s", status.LeaseNamespace, status.LeaseName)
+	}
+
+	close(stopCh)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run = %v, want nil after stop", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after stop")
+	}
+	select {
+	case <-runStopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run callback not stopped")
+	}
+
+	lease, err = client.CoordinationV1().Leases("default").Get(context.TODO(), "informer", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get lease: %v", err)
+	}
+	if lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity != "" {
+		t.Fatalf("lease holder after stop = %q, want released", *lease.Spec.HolderIdentity)
+	}
+	if le.IsLeader() {
+		t.Fatal("IsLeader = true after stop")
+	}
+	if status := le.Status(); status.IsLeader || status.LeaderSince != nil {
+		t.Fatalf("status after stop = %+v", status)
+	}
+}
+
+func TestNewLeaderElectorRequiresLease(t *testing.T) {
+	if _, err := NewLeaderElector(fake.NewSimpleClientset(), Config{LeaseName: "informer"}); err == nil {
+		t.Fatal("expected an error without a lease namespace")
+	}
+}
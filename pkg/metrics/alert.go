@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Results of sending an alert notification to a channel.
+const (
+	AlertNotificationSent   = "sent"
+	AlertNotificationFailed = "failed"
+)
+
+// States of the active alerts.
+const (
+	AlertFiring   = "firing"
+	AlertSilenced = "silenced"
+)
+
+var (
+	alertNotificationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "alerts",
+		Name:      "notifications_total",
+		Help:      "Total number of alert notifications per channel and result",
+	}, []string{"channel", "result"})
+	alertsActive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: "alerts",
+		Name:      "active",
+		Help:      "Number of firing alerts, silenced or not",
+	}, []string{"state"})
+)
+
+func init() {
+	prometheus.MustRegister(alertNotificationsTotal, alertsActive)
+}
+
+// ObserveAlertNotification counts a notification sent to the named channel.
+func ObserveAlertNotification(channel, result string) {
+	alertNotificationsTotal.WithLabelValues(channel, result).Inc()
+}
+
+// SetAlertsActive sets the number of firing alerts in a state.
+func SetAlertsActive(state string, n int) {
+	alertsActive.WithLabelValues(state).Set(float64(n))
+}
@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Results of collecting a finished pod.
+const (
+	PodGCDeleted = "deleted"
+	PodGCDryRun  = "dryrun"
+	PodGCFailed  = "failed"
+)
+
+var podsCollectedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Subsystem: "podgc",
+	Name:      "pods_collected_total",
+	Help:      "Total number of finished pods collected per reason and result",
+}, []string{"reason", "result"})
+
+func init() {
+	prometheus.MustRegister(podsCollectedTotal)
+}
+
+// ObservePodCollected counts a pod collected for reason, evicted, failed or
+// succeeded.
+func ObservePodCollected(reason, result string) {
+	podsCollectedTotal.WithLabelValues(reason, result).Inc()
+}
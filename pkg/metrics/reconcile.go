@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Results of a reconcile.
+const (
+	ReconcileSuccess = "success"
+	ReconcileError   = "error"
+)
+
+var reconcileTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Subsystem: "controller",
+	Name:      "reconcile_total",
+	Help:      "Total number of reconciliations per controller and result",
+}, []string{"controller", "result"})
+
+func init() {
+	prometheus.MustRegister(reconcileTotal)
+}
+
+// ObserveReconcile counts a reconcile of the named controller, a nil error
+// is counted as a success.
+func ObserveReconcile(controller string, err error) {
+	result := ReconcileSuccess
+	if err != nil {
+		result = ReconcileError
+	}
+
+	reconcileTotal.WithLabelValues(controller, result).Inc()
+}
@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Results of a deployment rollout.
+const (
+	RolloutCompleted = "completed"
+	RolloutStalled   = "stalled"
+)
+
+var rolloutDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Subsystem: "deployment",
+	Name:      "rollout_duration_seconds",
+	Help:      "Time from the start of a rollout until it completed or stalled",
+	Buckets:   []float64{10, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+}, []string{"result"})
+
+func init() {
+	prometheus.MustRegister(rolloutDuration)
+}
+
+// ObserveRollout records the duration of a rollout that completed or
+// stalled.
+func ObserveRollout(result string, seconds float64) {
+	rolloutDuration.WithLabelValues(result).Observe(seconds)
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Results of evaluating a rule against an object.
+const (
+	RulePass      = "pass"
+	RuleViolation = "violation"
+	RuleError     = "error"
+)
+
+var (
+	ruleEvaluationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "rules",
+		Name:      "evaluations_total",
+		Help:      "Total number of rule evaluations per rule and result",
+	}, []string{"rule", "result"})
+
+	ruleViolations = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: "rules",
+		Name:      "violations",
+		Help:      "Number of objects currently violating a rule",
+	}, []string{"rule", "severity"})
+)
+
+func init() {
+	prometheus.MustRegister(ruleEvaluationsTotal, ruleViolations)
+}
+
+// ObserveRuleEvaluation counts an evaluation of the named rule.
+func ObserveRuleEvaluation(rule, result string) {
+	ruleEvaluationsTotal.WithLabelValues(rule, result).Inc()
+}
+
+// SetRuleViolations sets the number of objects violating the named rule.
+func SetRuleViolations(rule, severity string, count int) {
+	ruleViolations.WithLabelValues(rule, severity).Set(float64(count))
+}
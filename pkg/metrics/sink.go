@@ -0,0 +1,27 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Results of passing an event to a sink.
+const (
+	SinkSent    = "sent"
+	SinkFailed  = "failed"
+	SinkDropped = "dropped"
+)
+
+var sinkEventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Subsystem: "sink",
+	Name:      "events_total",
+	Help:      "Total number of events per sink and result",
+}, []string{"sink", "result"})
+
+func init() {
+	prometheus.MustRegister(sinkEventsTotal)
+}
+
+// ObserveSinkEvent counts an event passed to the named sink.
+func ObserveSinkEvent(sink, result string) {
+	sinkEventsTotal.WithLabelValues(sink, result).Inc()
+}
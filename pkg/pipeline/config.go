@@ -0,0 +1,101 @@
+package pipeline
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/lqshow/access-kubernetes-cluster/pkg/informer"
+)
+
+// Config is the file the pipelines are loaded from.
+type Config struct {
+	Pipelines []PipelineConfig `json:"pipelines"`
+}
+
+// PipelineConfig is a chain of stages every event is passed through in
+// order, the chain stops at the first match stage the event doesn't match.
+type PipelineConfig struct {
+	Name   string        `json:"name"`
+	Stages []StageConfig `json:"stages"`
+}
+
+// StageConfig is a stage of a pipeline, exactly one of Match, Transform and
+// Route must be set.
+type StageConfig struct {
+	Match     *MatchConfig     `json:"match,omitempty"`
+	Transform *TransformConfig `json:"transform,omitempty"`
+	Route     *RouteConfig     `json:"route,omitempty"`
+}
+
+// MatchConfig selects events, an event must match every criterion and an
+// empty criterion matches any event.
+type MatchConfig struct {
+	Types []informer.EventType `json:"types,omitempty"`
+	Kinds []string             `json:"kinds,omitempty"`
+	// Namespaces and ExcludeNamespaces are glob patterns, e.g. prod-*.
+	Namespaces        []string `json:"namespaces,omitempty"`
+	ExcludeNamespaces []string `json:"excludeNamespaces,omitempty"`
+	// Labels is a label selector on the labels of the object, e.g.
+	// app=web,tier!=cache.
+	Labels string            `json:"labels,omitempty"`
+	Fields []FieldExpression `json:"fields,omitempty"`
+}
+
+// FieldOperator is the operator of a field expression.
+type FieldOperator string
+
+const (
+	// FieldIn matches if the field is one of the values.
+	FieldIn FieldOperator = "In"
+	// FieldNotIn matches if the field is missing or none of the values.
+	FieldNotIn FieldOperator = "NotIn"
+	// FieldExists matches if the field is set.
+	FieldExists FieldOperator = "Exists"
+	// FieldDoesNotExist matches if the field isn't set.
+	FieldDoesNotExist FieldOperator = "DoesNotExist"
+	// FieldGt and FieldLt compare a numeric field with a single value.
+	FieldGt FieldOperator = "Gt"
+	FieldLt FieldOperator = "Lt"
+	// FieldChanged matches updates changing the field.
+	FieldChanged FieldOperator = "Changed"
+)
+
+// FieldExpression matches a field of the object. Path is a JSON pointer, a
+// "*" segment matches any key or index and the expression matches if any of
+// the matched fields does.
+type FieldExpression struct {
+	Path     string        `json:"path"`
+	Operator FieldOperator `json:"operator"`
+	Values   []string      `json:"values,omitempty"`
+}
+
+// TransformConfig rewrites the object of an event, for the following stages.
+type TransformConfig struct {
+	// Project keeps only the fields at these JSON pointers.
+	Project []string `json:"project,omitempty"`
+	// Redact replaces the values of the fields at these JSON pointers with
+	// RedactedValue.
+	Redact []string `json:"redact,omitempty"`
+}
+
+// RouteConfig sends the event to sinks of the fan-out, the following stages
+// are still evaluated.
+type RouteConfig struct {
+	Sinks []string `json:"sinks"`
+}
+
+// Load creates an engine with the pipelines of a YAML or JSON Config file.
+func Load(path string, sinks *informer.FanOut) (*Engine, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pipeline config %s: %v", path, err)
+	}
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse pipeline config %s: %v", path, err)
+	}
+
+	return New(config, sinks)
+}
@@ -0,0 +1,164 @@
+package pipeline
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// matchPrefix returns whether pattern matches path or one of its parents, a
+// "*" segment of the pattern matches any segment.
+func matchPrefix(pattern, path []string) bool {
+	if len(pattern) > len(path) {
+		return false
+	}
+
+	return matchSegments(pattern, path)
+}
+
+func matchAnyPrefix(patterns [][]string, path []string) bool {
+	for _, pattern := range patterns {
+		if matchPrefix(pattern, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchSegments compares the segments pattern and path have in common.
+func matchSegments(pattern, path []string) bool {
+	for i := 0; i < len(pattern) && i < len(path); i++ {
+		if pattern[i] != "*" && pattern[i] != path[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// lookup returns the values at a path, a "*" segment matches every key or
+// index.
+func lookup(value interface{}, path []string) []interface{} {
+	if len(path) == 0 {
+		return []interface{}{value}
+	}
+
+	var values []interface{}
+	segment, rest := path[0], path[1:]
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		if segment == "*" {
+			for _, child := range typed {
+				values = append(values, lookup(child, rest)...)
+			}
+		} else if child, ok := typed[segment]; ok {
+			values = lookup(child, rest)
+		}
+	case []interface{}:
+		for i, child := range typed {
+			if segment == "*" || segment == strconv.Itoa(i) {
+				values = append(values, lookup(child, rest)...)
+			}
+		}
+	}
+
+	return values
+}
+
+// keep returns the parts of a value at path matched by the patterns, false is
+// returned if nothing is matched. Lists keep the matched elements in order.
+func keep(value interface{}, path []string, patterns [][]string) (interface{}, bool) {
+	descend := false
+	for _, pattern := range patterns {
+		if !matchSegments(pattern, path) {
+			continue
+		}
+		if len(pattern) <= len(path) {
+			return value, true
+		}
+		descend = true
+	}
+	if !descend {
+		return nil, false
+	}
+
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{})
+		for key, child := range typed {
+			if kept, ok := keep(child, append(path[:len(path):len(path)], key), patterns); ok {
+				result[key] = kept
+			}
+		}
+		return result, len(result) > 0
+	case []interface{}:
+		var result []interface{}
+		for i, child := range typed {
+			if kept, ok := keep(child, append(path[:len(path):len(path)], strconv.Itoa(i)), patterns); ok {
+				result = append(result, kept)
+			}
+		}
+		return result, len(result) > 0
+	}
+
+	return nil, false
+}
+
+// redact replaces the values matched by a pattern with RedactedValue in place
+// and returns the value.
+func redact(value interface{}, pattern []string) interface{} {
+	if len(pattern) == 0 {
+		return redactValue(value)
+	}
+
+	segment, rest := pattern[0], pattern[1:]
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, child := range typed {
+			if segment == "*" || segment == key {
+				typed[key] = redact(child, rest)
+			}
+		}
+	case []interface{}:
+		for i, child := range typed {
+			if segment == "*" || segment == strconv.Itoa(i) {
+				typed[i] = redact(child, rest)
+			}
+		}
+	}
+
+	return value
+}
+
+// scalarString formats a string, number or boolean field, false is returned
+// for maps and lists.
+func scalarString(value interface{}) (string, bool) {
+	switch typed := value.(type) {
+	case string:
+		return typed, true
+	case bool, int, int32, int64, float32, float64:
+		return fmt.Sprint(typed), true
+	}
+
+	return "", false
+}
+
+func number(value interface{}) (float64, bool) {
+	switch typed := value.(type) {
+	case int:
+		return float64(typed), true
+	case int32:
+		return float64(typed), true
+	case int64:
+		return float64(typed), true
+	case float32:
+		return float64(typed), true
+	case float64:
+		return typed, true
+	case string:
+		n, err := strconv.ParseFloat(typed, 64)
+		return n, err == nil
+	}
+
+	return 0, false
+}
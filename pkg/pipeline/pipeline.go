@@ -0,0 +1,403 @@
+package pipeline
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2"
+
+	"github.com/lqshow/access-kubernetes-cluster/pkg/diff"
+	"github.com/lqshow/access-kubernetes-cluster/pkg/informer"
+)
+
+// RedactedValue replaces the values of redacted fields.
+const RedactedValue = "REDACTED"
+
+// Engine passes the events of a Dispatcher through every pipeline.
+type Engine struct {
+	pipelines []*pipeline
+}
+
+type pipeline struct {
+	name   string
+	stages []stage
+}
+
+// stage processes an event of a pipeline, false stops the pipeline.
+type stage interface {
+	process(e *evaluation) bool
+}
+
+// evaluation is an event passing through a pipeline, the object is
+// converted to a map the first time a stage needs it.
+type evaluation struct {
+	event  *informer.Event
+	object map[string]interface{}
+}
+
+// New creates an engine with the pipelines of a config, the routes must
+// name sinks of the fan-out.
+func New(config Config, sinks *informer.FanOut) (*Engine, error) {
+	e := &Engine{}
+	names := make(map[string]bool)
+	for _, c := range config.Pipelines {
+		if c.Name == "" {
+			return nil, fmt.Errorf("pipeline name is required")
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("duplicate pipeline %s", c.Name)
+		}
+		names[c.Name] = true
+
+		p := &pipeline{name: c.Name}
+		for i, sc := range c.Stages {
+			s, err := newStage(sc, sinks)
+			if err != nil {
+				return nil, fmt.Errorf("invalid stage %d of pipeline %s: %v", i, c.Name, err)
+			}
+			p.stages = append(p.stages, s)
+		}
+		e.pipelines = append(e.pipelines, p)
+	}
+
+	return e, nil
+}
+
+// HandleEvent passes an event through every pipeline, it is an
+// informer.EventHandler.
+func (e *Engine) HandleEvent(event *informer.Event) {
+	for _, p := range e.pipelines {
+		eval := &evaluation{event: event}
+		for _, s := range p.stages {
+			if !s.process(eval) {
+				break
+			}
+		}
+	}
+}
+
+func newStage(c StageConfig, sinks *informer.FanOut) (stage, error) {
+	set := 0
+	for _, options := range []bool{c.Match != nil, c.Transform != nil, c.Route != nil} {
+		if options {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("exactly one of match, transform or route must be set")
+	}
+
+	switch {
+	case c.Match != nil:
+		return newMatchStage(c.Match)
+	case c.Transform != nil:
+		return newTransformStage(c.Transform)
+	default:
+		for _, name := range c.Route.Sinks {
+			if !sinks.HasSink(name) {
+				return nil, fmt.Errorf("unknown sink %s", name)
+			}
+		}
+		return &routeStage{sinks: sinks, names: c.Route.Sinks}, nil
+	}
+}
+
+// objectMap returns the object of the event as a map owned by the
+// evaluation.
+func (e *evaluation) objectMap() (map[string]interface{}, error) {
+	if e.object != nil {
+		return e.object, nil
+	}
+
+	if u, ok := e.event.Object.(*unstructured.Unstructured); ok {
+		e.object = u.DeepCopy().Object
+		return e.object, nil
+	}
+	object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(e.event.Object)
+	if err != nil {
+		return nil, err
+	}
+	e.object = object
+
+	return e.object, nil
+}
+
+type matchStage struct {
+	config   *MatchConfig
+	selector labels.Selector
+	fields   []fieldMatcher
+}
+
+type fieldMatcher struct {
+	FieldExpression
+	path   []string
+	number float64
+}
+
+func newMatchStage(c *MatchConfig) (*matchStage, error) {
+	s := &matchStage{config: c}
+	for _, pattern := range append(append([]string{}, c.Namespaces...), c.ExcludeNamespaces...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid namespace pattern %q: %v", pattern, err)
+		}
+	}
+	if c.Labels != "" {
+		selector, err := labels.Parse(c.Labels)
+		if err != nil {
+			return nil, fmt.Errorf("invalid label selector %q: %v", c.Labels, err)
+		}
+		s.selector = selector
+	}
+	for _, expression := range c.Fields {
+		f, err := newFieldMatcher(expression)
+		if err != nil {
+			return nil, err
+		}
+		s.fields = append(s.fields, f)
+	}
+
+	return s, nil
+}
+
+func newFieldMatcher(expression FieldExpression) (fieldMatcher, error) {
+	f := fieldMatcher{FieldExpression: expression}
+	if len(expression.Path) == 0 || expression.Path[0] != '/' {
+		return f, fmt.Errorf("field path %q must be a JSON pointer starting with /", expression.Path)
+	}
+	f.path = diff.SplitPointer(expression.Path)
+
+	switch expression.Operator {
+	case FieldIn, FieldNotIn:
+		if len(expression.Values) == 0 {
+			return f, fmt.Errorf("operator %s of field %s requires values", expression.Operator, expression.Path)
+		}
+	case FieldExists, FieldDoesNotExist, FieldChanged:
+		if len(expression.Values) > 0 {
+			return f, fmt.Errorf("operator %s of field %s takes no values", expression.Operator, expression.Path)
+		}
+	case FieldGt, FieldLt:
+		if len(expression.Values) != 1 {
+			return f, fmt.Errorf("operator %s of field %s requires a single value", expression.Operator, expression.Path)
+		}
+		number, err := strconv.ParseFloat(expression.Values[0], 64)
+		if err != nil {
+			return f, fmt.Errorf("operator %s of field %s requires a number: %v", expression.Operator, expression.Path, err)
+		}
+		f.number = number
+	default:
+		return f, fmt.Errorf("unknown operator %q of field %s", expression.Operator, expression.Path)
+	}
+
+	return f, nil
+}
+
+func (s *matchStage) process(e *evaluation) bool {
+	c := s.config
+	if len(c.Types) > 0 && !containsEventType(c.Types, e.event.Type) {
+		return false
+	}
+	if len(c.Kinds) > 0 && !containsString(c.Kinds, e.event.Kind) {
+		return false
+	}
+	if len(c.Namespaces) > 0 && !matchGlob(c.Namespaces, e.event.Namespace) {
+		return false
+	}
+	if matchGlob(c.ExcludeNamespaces, e.event.Namespace) {
+		return false
+	}
+	if s.selector == nil && len(s.fields) == 0 {
+		return true
+	}
+
+	object, err := e.objectMap()
+	if err != nil {
+		klog.Errorf("Couldn't match %s %s: %v", e.event.Kind, e.event.Key(), err)
+		return false
+	}
+	if s.selector != nil {
+		objectLabels, _, _ := unstructured.NestedStringMap(object, "metadata", "labels")
+		if !s.selector.Matches(labels.Set(objectLabels)) {
+			return false
+		}
+	}
+	for _, f := range s.fields {
+		if !f.matches(e.event, object) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (f *fieldMatcher) matches(event *informer.Event, object map[string]interface{}) bool {
+	if f.Operator == FieldChanged {
+		for _, change := range event.Diff {
+			changed := diff.SplitPointer(change.Path)
+			if matchPrefix(f.path, changed) || matchPrefix(changed, f.path) {
+				return true
+			}
+		}
+		return false
+	}
+
+	values := lookup(object, f.path)
+	switch f.Operator {
+	case FieldExists:
+		return len(values) > 0
+	case FieldDoesNotExist:
+		return len(values) == 0
+	}
+
+	for _, value := range values {
+		switch f.Operator {
+		case FieldIn, FieldNotIn:
+			if s, ok := scalarString(value); ok && containsString(f.Values, s) {
+				return f.Operator == FieldIn
+			}
+		case FieldGt:
+			if n, ok := number(value); ok && n > f.number {
+				return true
+			}
+		case FieldLt:
+			if n, ok := number(value); ok && n < f.number {
+				return true
+			}
+		}
+	}
+
+	return f.Operator == FieldNotIn
+}
+
+type transformStage struct {
+	project [][]string
+	redact  [][]string
+}
+
+func newTransformStage(c *TransformConfig) (*transformStage, error) {
+	s := &transformStage{}
+	for _, pointers := range []struct {
+		paths  []string
+		target *[][]string
+	}{{c.Project, &s.project}, {c.Redact, &s.redact}} {
+		for _, pointer := range pointers.paths {
+			if len(pointer) == 0 || pointer[0] != '/' {
+				return nil, fmt.Errorf("path %q must be a JSON pointer starting with /", pointer)
+			}
+			*pointers.target = append(*pointers.target, diff.SplitPointer(pointer))
+		}
+	}
+
+	return s, nil
+}
+
+func (s *transformStage) process(e *evaluation) bool {
+	object, err := e.objectMap()
+	if err != nil {
+		klog.Errorf("Couldn't transform %s %s: %v", e.event.Kind, e.event.Key(), err)
+		return false
+	}
+
+	if len(s.project) > 0 {
+		projected, ok := keep(object, nil, s.project)
+		if !ok {
+			projected = map[string]interface{}{}
+		}
+		object = projected.(map[string]interface{})
+	}
+	for _, pattern := range s.redact {
+		redact(object, pattern)
+	}
+
+	event := *e.event
+	event.Object = &unstructured.Unstructured{Object: object}
+	event.OldObject = nil
+	event.Diff = s.transformDiff(e.event.Diff)
+	e.event = &event
+	e.object = object
+
+	return true
+}
+
+// transformDiff drops the changes outside of the projected fields and
+// redacts the values of the changes of redacted fields.
+func (s *transformStage) transformDiff(changes []diff.Change) []diff.Change {
+	var result []diff.Change
+	for _, change := range changes {
+		changed := diff.SplitPointer(change.Path)
+		if len(s.project) > 0 && !matchAnyPrefix(s.project, changed) {
+			continue
+		}
+
+		change.Value = runtime.DeepCopyJSONValue(change.Value)
+		change.Old = runtime.DeepCopyJSONValue(change.Old)
+		for _, pattern := range s.redact {
+			switch {
+			case matchPrefix(pattern, changed):
+				change.Value = redactValue(change.Value)
+				change.Old = redactValue(change.Old)
+			case matchPrefix(changed, pattern):
+				change.Value = redact(change.Value, pattern[len(changed):])
+				change.Old = redact(change.Old, pattern[len(changed):])
+			}
+		}
+		result = append(result, change)
+	}
+
+	return result
+}
+
+type routeStage struct {
+	sinks *informer.FanOut
+	names []string
+}
+
+func (s *routeStage) process(e *evaluation) bool {
+	for _, name := range s.names {
+		s.sinks.SendTo(name, e.event)
+	}
+
+	return true
+}
+
+// redactValue redacts a value of a change, a missing value stays missing.
+func redactValue(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	return RedactedValue
+}
+
+func matchGlob(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsEventType(types []informer.EventType, t informer.EventType) bool {
+	for _, s := range types {
+		if s == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, s := range values {
+		if s == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,348 @@
+package rules
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	"github.com/lqshow/access-kubernetes-cluster/pkg/informer"
+	"github.com/lqshow/access-kubernetes-cluster/pkg/metrics"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+// Severities of a rule.
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Config is the file the rules are loaded from.
+type Config struct {
+	Rules []RuleConfig `json:"rules"`
+}
+
+// RuleConfig is a check of the watched objects. Expression is a CEL
+// expression evaluating to true for compliant objects, the object is bound to
+// the variable object, e.g.
+// object.spec.template.spec.containers.all(c, has(c.resources.limits)).
+type RuleConfig struct {
+	Name string `json:"name"`
+	// Kinds are the kinds the rule applies to, every kind when empty.
+	Kinds      []string `json:"kinds,omitempty"`
+	Expression string   `json:"expression"`
+	// Severity is info, warning or critical, defaults to warning.
+	Severity string `json:"severity,omitempty"`
+	// Message describes the violation, the expression is used when empty.
+	Message string `json:"message,omitempty"`
+}
+
+// Violation is a rule an object doesn't comply with. Error is set if the
+// rule couldn't be evaluated against the object.
+type Violation struct {
+	Rule     string    `json:"rule"`
+	Severity string    `json:"severity"`
+	Message  string    `json:"message"`
+	Error    string    `json:"error,omitempty"`
+	Since    time.Time `json:"since"`
+}
+
+// ObjectViolations are the violations of an object.
+type ObjectViolations struct {
+	Kind       string      `json:"kind"`
+	Namespace  string      `json:"namespace,omitempty"`
+	Name       string      `json:"name"`
+	Violations []Violation `json:"violations"`
+}
+
+type rule struct {
+	RuleConfig
+	program cel.Program
+}
+
+// Engine evaluates the rules against the objects of the informer events and
+// keeps the current violations of every object.
+type Engine struct {
+	rules []*rule
+
+	mu sync.RWMutex
+	// violations holds the objects violating rules by kind/namespace/name.
+	violations map[string]*ObjectViolations
+	// counts holds the number of objects violating each rule.
+	counts map[string]int
+}
+
+// Load creates an engine with the rules of a YAML or JSON Config file.
+func Load(path string) (*Engine, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules %s: %v", path, err)
+	}
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse rules %s: %v", path, err)
+	}
+
+	return New(config)
+}
+
+// New compiles the rules of a config.
+func New(config Config) (*Engine, error) {
+	env, err := cel.NewEnv(cel.Declarations(decls.NewVar("object", decls.Dyn)))
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Engine{
+		violations: make(map[string]*ObjectViolations),
+		counts:     make(map[string]int),
+	}
+	names := make(map[string]bool)
+	for _, c := range config.Rules {
+		if c.Name == "" {
+			return nil, fmt.Errorf("rule name is required")
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("duplicate rule %s", c.Name)
+		}
+		names[c.Name] = true
+
+		switch c.Severity {
+		case "":
+			c.Severity = SeverityWarning
+		case SeverityInfo, SeverityWarning, SeverityCritical:
+		default:
+			return nil, fmt.Errorf("unknown severity %q of rule %s", c.Severity, c.Name)
+		}
+		if c.Message == "" {
+			c.Message = c.Expression
+		}
+
+		ast, issues := env.Compile(c.Expression)
+		if issues != nil && issues.Err() != nil {
+			return nil, fmt.Errorf("invalid expression of rule %s: %v", c.Name, issues.Err())
+		}
+		if t := ast.ResultType(); t.GetPrimitive() != exprpb.Type_BOOL && t.GetDyn() == nil {
+			return nil, fmt.Errorf("expression of rule %s must evaluate to a bool", c.Name)
+		}
+		program, err := env.Program(ast)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression of rule %s: %v", c.Name, err)
+		}
+
+		e.rules = append(e.rules, &rule{RuleConfig: c, program: program})
+		metrics.SetRuleViolations(c.Name, c.Severity, 0)
+	}
+
+	return e, nil
+}
+
+// Rules returns the configured rules.
+func (e *Engine) Rules() []RuleConfig {
+	rules := make([]RuleConfig, 0, len(e.rules))
+	for _, r := range e.rules {
+		rules = append(rules, r.RuleConfig)
+	}
+
+	return rules
+}
+
+// HandleEvent evaluates the rules against added and updated objects and
+// forgets deleted objects, it is an informer.EventHandler.
+func (e *Engine) HandleEvent(event *informer.Event) {
+	key := violationsKey(event.Kind, event.Namespace, event.Name)
+	if event.Type == informer.EventDeleted {
+		e.mu.Lock()
+		e.set(key, nil)
+		e.mu.Unlock()
+		return
+	}
+
+	violations, err := e.Evaluate(event.Kind, event.Object)
+	if err != nil {
+		klog.Errorf("Couldn't evaluate rules against %s %s: %v", event.Kind, event.Key(), err)
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	previous := e.violations[key]
+	if len(violations) == 0 {
+		e.set(key, nil)
+		return
+	}
+
+	// keep when an ongoing violation started.
+	now := time.Now()
+	for i := range violations {
+		violations[i].Since = now
+		if previous == nil {
+			continue
+		}
+		for _, p := range previous.Violations {
+			if p.Rule == violations[i].Rule {
+				violations[i].Since = p.Since
+			}
+		}
+	}
+	if previous == nil {
+		klog.Infof("%s %s violates %d rules", event.Kind, event.Key(), len(violations))
+	}
+	e.set(key, &ObjectViolations{
+		Kind:       event.Kind,
+		Namespace:  event.Namespace,
+		Name:       event.Name,
+		Violations: violations,
+	})
+}
+
+// Evaluate returns the violations of an object of a kind, typed or
+// unstructured, without recording them.
+func (e *Engine) Evaluate(kind string, obj runtime.Object) ([]Violation, error) {
+	var object map[string]interface{}
+	var violations []Violation
+	for _, r := range e.rules {
+		if len(r.Kinds) > 0 && !containsString(r.Kinds, kind) {
+			continue
+		}
+		if object == nil {
+			var err error
+			if object, err = toUnstructured(obj); err != nil {
+				return nil, err
+			}
+		}
+
+		out, _, err := r.program.Eval(map[string]interface{}{"object": object})
+		if err == nil {
+			if pass, ok := out.Value().(bool); !ok {
+				err = fmt.Errorf("expression evaluated to %v, not a bool", out.Value())
+			} else if pass {
+				metrics.ObserveRuleEvaluation(r.Name, metrics.RulePass)
+				continue
+			}
+		}
+
+		violation := Violation{
+			Rule:     r.Name,
+			Severity: r.Severity,
+			Message:  r.Message,
+		}
+		if err != nil {
+			violation.Error = err.Error()
+			metrics.ObserveRuleEvaluation(r.Name, metrics.RuleError)
+		} else {
+			metrics.ObserveRuleEvaluation(r.Name, metrics.RuleViolation)
+		}
+		violations = append(violations, violation)
+	}
+
+	return violations, nil
+}
+
+// Violations returns the current violations of an object.
+func (e *Engine) Violations(kind, namespace, name string) (ObjectViolations, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	v, ok := e.violations[violationsKey(kind, namespace, name)]
+	if !ok {
+		return ObjectViolations{}, false
+	}
+
+	return *v, true
+}
+
+// List returns the objects currently violating rules in kind/namespace/name
+// order. Empty kind, namespace or rule match any value.
+func (e *Engine) List(kind, namespace, rule string) []ObjectViolations {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	keys := make([]string, 0, len(e.violations))
+	for key := range e.violations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var result []ObjectViolations
+	for _, key := range keys {
+		v := e.violations[key]
+		if (kind != "" && v.Kind != kind) || (namespace != "" && v.Namespace != namespace) {
+			continue
+		}
+		if rule != "" {
+			filtered := ObjectViolations{Kind: v.Kind, Namespace: v.Namespace, Name: v.Name}
+			for _, violation := range v.Violations {
+				if violation.Rule == rule {
+					filtered.Violations = append(filtered.Violations, violation)
+				}
+			}
+			if len(filtered.Violations) == 0 {
+				continue
+			}
+			v = &filtered
+		}
+		result = append(result, *v)
+	}
+
+	return result
+}
+
+// set replaces the violations of an object and updates the violation
+// gauges, nil removes them. The caller must hold e.mu.
+func (e *Engine) set(key string, v *ObjectViolations) {
+	changed := make(map[string]bool)
+	if previous, ok := e.violations[key]; ok {
+		for _, violation := range previous.Violations {
+			e.counts[violation.Rule]--
+			changed[violation.Rule] = true
+		}
+		delete(e.violations, key)
+	}
+	if v != nil {
+		for _, violation := range v.Violations {
+			e.counts[violation.Rule]++
+			changed[violation.Rule] = true
+		}
+		e.violations[key] = v
+	}
+
+	for _, r := range e.rules {
+		if changed[r.Name] {
+			metrics.SetRuleViolations(r.Name, r.Severity, e.counts[r.Name])
+		}
+	}
+}
+
+func violationsKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+func toUnstructured(obj runtime.Object) (map[string]interface{}, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u.Object, nil
+	}
+
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+}
+
+func containsString(values []string, value string) bool {
+	for _, s := range values {
+		if s == value {
+			return true
+		}
+	}
+
+	return false
+}
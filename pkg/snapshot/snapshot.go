@@ -0,0 +1,179 @@
+package snapshot
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/cache"
+)
+
+// FormatVersion is the version of the snapshot format, snapshots of another
+// version are rejected.
+const FormatVersion = 1
+
+// Snapshot is a point in time copy of the informer stores. It is stored as
+// gzip compressed JSON.
+type Snapshot struct {
+	Version int       `json:"version"`
+	Time    time.Time `json:"time"`
+	// Kinds are the stored objects by kind.
+	Kinds map[string]*Kind `json:"kinds"`
+}
+
+// Kind holds the objects of a kind.
+type Kind struct {
+	APIVersion string `json:"apiVersion"`
+	// Objects are the objects in unstructured form.
+	Objects []map[string]interface{} `json:"objects"`
+
+	keys map[string]bool
+}
+
+// New creates an empty snapshot.
+func New() *Snapshot {
+	return &Snapshot{
+		Version: FormatVersion,
+		Time:    time.Now(),
+		Kinds:   make(map[string]*Kind),
+	}
+}
+
+// Add adds the objects of an informer, objects already added by another
+// informer are skipped.
+func (s *Snapshot) Add(gvk schema.GroupVersionKind, objects []interface{}) error {
+	k, ok := s.Kinds[gvk.Kind]
+	if !ok {
+		k = &Kind{
+			APIVersion: gvk.GroupVersion().String(),
+			keys:       make(map[string]bool),
+		}
+		s.Kinds[gvk.Kind] = k
+	}
+
+	for _, obj := range objects {
+		key, err := cache.MetaNamespaceKeyFunc(obj)
+		if err != nil {
+			return err
+		}
+		if k.keys[key] {
+			continue
+		}
+		k.keys[key] = true
+
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s %s: %v", gvk.Kind, key, err)
+		}
+		k.Objects = append(k.Objects, u)
+	}
+
+	return nil
+}
+
+// Objects returns the objects of a kind, kinds known to the client-go
+// scheme are returned as typed objects and others as unstructured objects.
+func (s *Snapshot) Objects(kind string) ([]runtime.Object, error) {
+	k, ok := s.Kinds[kind]
+	if !ok {
+		return nil, fmt.Errorf("kind %s is not in the snapshot", kind)
+	}
+	gv, err := schema.ParseGroupVersion(k.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make([]runtime.Object, 0, len(k.Objects))
+	for _, u := range k.Objects {
+		obj, err := scheme.Scheme.New(gv.WithKind(kind))
+		if err != nil {
+			objects = append(objects, &unstructured.Unstructured{Object: u})
+			continue
+		}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u, obj); err != nil {
+			return nil, fmt.Errorf("failed to convert %s: %v", kind, err)
+		}
+		objects = append(objects, obj)
+	}
+
+	return objects, nil
+}
+
+// Indexer returns an indexer holding the objects of a kind, the namespace
+// index is always added.
+func (s *Snapshot) Indexer(kind string, indexers cache.Indexers) (cache.Indexer, error) {
+	objects, err := s.Objects(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	all := cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}
+	for name, indexFunc := range indexers {
+		all[name] = indexFunc
+	}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, all)
+	for _, obj := range objects {
+		if err := indexer.Add(obj); err != nil {
+			return nil, err
+		}
+	}
+
+	return indexer, nil
+}
+
+// Write writes a snapshot to a file, the file is replaced atomically.
+func Write(path string, s *Snapshot) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	gz := gzip.NewWriter(tmp)
+	if err := json.NewEncoder(gz).Encode(s); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Read reads a snapshot from a file.
+func Read(path string) (*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	var s Snapshot
+	if err := json.NewDecoder(gz).Decode(&s); err != nil {
+		return nil, err
+	}
+	if s.Version != FormatVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d, expected %d", s.Version, FormatVersion)
+	}
+
+	return &s, nil
+}
@@ -0,0 +1,29 @@
+#!/usr/bin/env bash
+
+# Regenerates the deepcopy functions, clientset, listers and informers of the
+# API types under pkg/apis with k8s.io/code-generator.
+
+set -o errexit
+set -o nounset
+set -o pipefail
+
+readonly PROJECT_ROOT=$(cd "$(dirname "${BASH_SOURCE[0]}")/.." && pwd)
+readonly PROJECT_MODULE=github.com/lqshow/access-kubernetes-cluster
+readonly CODEGEN_VERSION=v0.19.0
+readonly CODEGEN_PKG=${CODEGEN_PKG:-$(go env GOPATH)/pkg/mod/k8s.io/code-generator@${CODEGEN_VERSION}}
+
+if [ ! -d "${CODEGEN_PKG}" ]; then
+  go mod download k8s.io/code-generator@${CODEGEN_VERSION}
+fi
+
+# generate-groups.sh writes to ${output-base}/${PROJECT_MODULE}
+readonly OUTPUT_BASE=$(mktemp -d)
+trap 'rm -rf "${OUTPUT_BASE}"' EXIT
+
+bash "${CODEGEN_PKG}/generate-groups.sh" "deepcopy,client,informer,lister" \
+  ${PROJECT_MODULE}/pkg/generated ${PROJECT_MODULE}/pkg/apis \
+  clusterwatch:v1alpha1 \
+  --output-base "${OUTPUT_BASE}" \
+  --go-header-file "${PROJECT_ROOT}/script/boilerplate.go.txt"
+
+cp -r "${OUTPUT_BASE}/${PROJECT_MODULE}/pkg/." "${PROJECT_ROOT}/pkg/"
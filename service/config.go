@@ -3,6 +3,7 @@ package service
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
@@ -25,6 +26,189 @@ type Config struct {
 	KubeNamespace string `default:"default" envconfig:"KUBE_NAMESPACE"`
 
 	WorkerThreadiness int `default:"3" split_words:"true"`
+
+	// WatchNamespaces restricts the informer to a list of namespaces, one
+	// informer factory is created per namespace. When both it and
+	// WatchNamespaceSelector are empty KubeNamespace is watched, an empty
+	// KubeNamespace means all namespaces.
+	WatchNamespaces []string `default:"" split_words:"true"`
+	// WatchNamespaceSelector is a label selector, namespaces are watched while
+	// they match it.
+	WatchNamespaceSelector string `default:"" split_words:"true"`
+
+	// Label and field selectors applied to the list/watch of each resource.
+	PodLabelSelector        string `default:"" split_words:"true"`
+	PodFieldSelector        string `default:"" split_words:"true"`
+	DeploymentLabelSelector string `default:"" split_words:"true"`
+	DeploymentFieldSelector string `default:"" split_words:"true"`
+	NodeLabelSelector       string `default:"" split_words:"true"`
+	NodeFieldSelector       string `default:"" split_words:"true"`
+
+	// Resync periods of the informers, 0 disables resync. A resync delivers
+	// every cached object to the update handlers again.
+	PodResyncPeriod        time.Duration `default:"0" split_words:"true"`
+	DeploymentResyncPeriod time.Duration `default:"0" split_words:"true"`
+	NodeResyncPeriod       time.Duration `default:"0" split_words:"true"`
+
+	// WatchResources are watched with dynamic informers, as
+	// group/version/resource (version/resource for the core group) or as
+	// Kind.group resolved through discovery, e.g. apps/v1/statefulsets,Job.batch
+	WatchResources []string `default:"" split_words:"true"`
+	// WatchCustomResourceGroups are API groups whose custom resources are
+	// watched as soon as their CRD is installed, "*" watches all of them.
+	WatchCustomResourceGroups []string `default:"" split_words:"true"`
+	// Selectors and resync period of the dynamic informers.
+	DynamicLabelSelector string        `default:"" split_words:"true"`
+	DynamicFieldSelector string        `default:"" split_words:"true"`
+	DynamicResyncPeriod  time.Duration `default:"0" split_words:"true"`
+
+	// ClusterWatchEnabled reconciles ClusterWatch resources into watches, the
+	// ClusterWatch CRD must be installed. ClusterWatchStatusPeriod is the
+	// period their status is refreshed with.
+	ClusterWatchEnabled      bool          `default:"false" split_words:"true"`
+	ClusterWatchStatusPeriod time.Duration `default:"30s" split_words:"true"`
+
+	// SnapshotPath is the file the informer stores are written to every
+	// SnapshotPeriod, queries are served from it at start until the informers
+	// have synchronized. Snapshots are disabled when empty.
+	SnapshotPath   string        `default:"" split_words:"true"`
+	SnapshotPeriod time.Duration `default:"5m" split_words:"true"`
+
+	// HistoryPath is the file changes of the watched objects are appended to,
+	// the history is disabled when empty. Records older than HistoryMaxAge
+	// are dropped, then the oldest records while there are more than
+	// HistoryMaxRecords or they take more than HistoryMaxBytes.
+	HistoryPath        string        `default:"" split_words:"true"`
+	HistoryMaxAge      time.Duration `default:"168h" split_words:"true"`
+	HistoryMaxRecords  int64         `default:"100000" split_words:"true"`
+	HistoryMaxBytes    int64         `default:"268435456" split_words:"true"`
+	HistoryPrunePeriod time.Duration `default:"1m" split_words:"true"`
+
+	// EventSinksConfig is a YAML file of sinks the events of the watched
+	// objects are sent to, see artifacts/event-sinks.yaml. No sinks are used
+	// when empty.
+	EventSinksConfig string `default:"" split_words:"true"`
+	// EventPipelineConfig is a YAML file of pipelines matching, transforming
+	// and routing the events to the sinks, see artifacts/event-pipeline.yaml.
+	// When set the events reach the sinks only through the pipelines.
+	EventPipelineConfig string `default:"" split_words:"true"`
+
+	// RulesConfig is a YAML file of CEL rules evaluated against the watched
+	// objects on every add and update, see artifacts/rules.yaml. No rules
+	// are evaluated when empty.
+	RulesConfig string `default:"" split_words:"true"`
+
+	// AlertsConfig is a YAML file of the notification channels and routes of
+	// the alerts raised for pod problems and stalled rollouts, see
+	// artifacts/alerts.yaml. Alerting is disabled when empty.
+	AlertsConfig string `default:"" split_words:"true"`
+
+	// ReloaderEnabled rolls the pods of Deployments, StatefulSets and
+	// DaemonSets annotated with informer.lqshow.io/reload=true when a
+	// ConfigMap or Secret they reference changes. ReloaderNamespace
+	// restricts it to a namespace, all namespaces when empty.
+	ReloaderEnabled   bool   `default:"false" split_words:"true"`
+	ReloaderNamespace string `default:"" split_words:"true"`
+
+	// TTLEnabled deletes the objects of TTLResources annotated with
+	// informer.lqshow.io/ttl or informer.lqshow.io/expires-at once expired,
+	// with TTLPropagationPolicy (Background, Foreground or Orphan).
+	// TTLNamespace restricts namespaced resources to a namespace, all
+	// namespaces when empty. TTLDryRun only reports expired objects.
+	TTLEnabled           bool     `default:"false" split_words:"true"`
+	TTLResources         []string `default:"v1/namespaces,apps/v1/deployments,batch/v1/jobs,v1/configmaps" split_words:"true"`
+	TTLNamespace         string   `default:"" split_words:"true"`
+	TTLPropagationPolicy string   `default:"Background" split_words:"true"`
+	TTLDryRun            bool     `default:"false" split_words:"true"`
+
+	// DownscalerEnabled scales Deployments and StatefulSets to zero outside
+	// the uptime schedule annotated with informer.lqshow.io/uptime on them or
+	// their namespace, e.g. "Mon-Fri 08:00-20:00 Europe/Berlin", evaluated
+	// every DownscalerPeriod. DownscalerNamespace restricts it to a
+	// namespace, all namespaces when empty.
+	DownscalerEnabled   bool          `default:"false" split_words:"true"`
+	DownscalerNamespace string        `default:"" split_words:"true"`
+	DownscalerPeriod    time.Duration `default:"1m" split_words:"true"`
+
+	// NamespaceTemplatesConfig is a YAML file of templated manifests applied
+	// to new and existing namespaces with server-side apply, see
+	// artifacts/namespace-templates.yaml. The applied objects are re-applied
+	// when they drift and every NamespaceProvisionerResync. Namespaces are
+	// not provisioned when empty.
+	NamespaceTemplatesConfig   string        `default:"" split_words:"true"`
+	NamespaceProvisionerResync time.Duration `default:"10m" split_words:"true"`
+
+	// OwnerGraphEnabled tracks the ownerReferences of the watched objects, the
+	// controllers owning pods are watched in the watched namespaces.
+	OwnerGraphEnabled bool `default:"false" split_words:"true"`
+
+	// PodHealthEnabled analyzes the container statuses of the watched pods for
+	// crash loops, OOMKills, image pull failures, config errors and init
+	// containers stuck for PodInitContainerTimeout. A container restarting
+	// PodRestartThreshold times within PodRestartWindow is reported as well.
+	PodHealthEnabled        bool          `default:"true" split_words:"true"`
+	PodRestartWindow        time.Duration `default:"10m" split_words:"true"`
+	PodRestartThreshold     int           `default:"3" split_words:"true"`
+	PodInitContainerTimeout time.Duration `default:"10m" split_words:"true"`
+
+	// PodGCEnabled deletes the Succeeded and Failed pods of the watched
+	// namespaces, evicted pods included, PodGCMinAge after they finished,
+	// keeping the PodGCKeepPerOwner most recent pods of every controller.
+	// PodGCNamespaces restricts it to namespaces, pods of
+	// PodGCExcludeNamespaces are kept. Deletes are limited to PodGCDeleteRate
+	// per second. PodGCDryRun only reports the pods.
+	PodGCEnabled           bool          `default:"false" split_words:"true"`
+	PodGCMinAge            time.Duration `default:"1h" split_words:"true"`
+	PodGCKeepPerOwner      int           `default:"1" split_words:"true"`
+	PodGCNamespaces        []string      `default:"" split_words:"true"`
+	PodGCExcludeNamespaces []string      `default:"kube-system" split_words:"true"`
+	PodGCDeleteRate        float32       `default:"5" split_words:"true"`
+	PodGCDryRun            bool          `default:"false" split_words:"true"`
+
+	// NodeTimelineSize is the number of changes kept per node, the changes
+	// of a deleted node are kept for NodeTimelineRetention.
+	NodeTimelineSize      int           `default:"100" split_words:"true"`
+	NodeTimelineRetention time.Duration `default:"1h" split_words:"true"`
+	// RolloutHistorySize is the number of finished rollouts kept per
+	// deployment. Stalled rollouts are detected when deployments are
+	// reconciled, see DeploymentReconcilePeriod.
+	RolloutHistorySize int `default:"10" split_words:"true"`
+
+	// Reconcile periods re-enqueue every known key so level-triggered
+	// reconcilers can correct drift, 0 disables periodic reconciliation.
+	PodReconcilePeriod        time.Duration `default:"0" split_words:"true"`
+	DeploymentReconcilePeriod time.Duration `default:"0" split_words:"true"`
+	// ReconcileJitter spreads periodic reconciliation over up to
+	// period*(1+jitter) so replicas and controllers don't fire together.
+	ReconcileJitter float64 `default:"0.1" split_words:"true"`
+
+	// DiffIgnorePaths are JSON pointers skipped when diffing updated objects,
+	// a "*" segment matches any key or index. Unset, diff.DefaultIgnorePaths
+	// are skipped.
+	DiffIgnorePaths []string `split_words:"true"`
+
+	// EventComponent is the source component of Kubernetes Events recorded
+	// by the reconcilers.
+	EventComponent string `default:"informer-example" split_words:"true"`
+	// Events of an object over the burst are limited to EventQPS, similar
+	// events are aggregated once EventMaxEvents occur within
+	// EventMaxIntervalSeconds.
+	EventBurstSize          int     `default:"25" split_words:"true"`
+	EventQPS                float32 `default:"0.0033" split_words:"true"`
+	EventMaxEvents          int     `default:"10" split_words:"true"`
+	EventMaxIntervalSeconds int     `default:"600" split_words:"true"`
+
+	// ListenAddress is the address the informer HTTP server binds to.
+	ListenAddress string `default:":8080" split_words:"true"`
+
+	// Leader election settings, only one replica of the informer processes
+	// events at a time when enabled.
+	LeaderElect                 bool          `default:"false" split_words:"true"`
+	LeaderElectionLeaseName     string        `default:"informer-example" split_words:"true"`
+	LeaderElectionNamespace     string        `default:"default" split_words:"true"`
+	LeaderElectionLeaseDuration time.Duration `default:"15s" split_words:"true"`
+	LeaderElectionRenewDeadline time.Duration `default:"10s" split_words:"true"`
+	LeaderElectionRetryPeriod   time.Duration `default:"2s" split_words:"true"`
 }
 
 func DefaultConfig() *Config {